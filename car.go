@@ -10,6 +10,7 @@ import (
 
 	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-unixfsnode/data/builder"
 	carv1 "github.com/ipld/go-car"
 	"github.com/ipld/go-car/v2"
@@ -22,19 +23,12 @@ import (
 	"github.com/multiformats/go-multihash"
 )
 
-// createCar creates a car
-func createCar(input string, output string) (cid.Cid, error) {
-	// make a cid with the right length that we eventually will patch with the root.
-	hasher, err := multihash.GetHasher(multihash.SHA2_256)
+// createCar creates a car, the DAG is laid out with opts if it is not nil
+func createCar(input string, output string, opts *ImportOptions) (cid.Cid, error) {
+	proxyRoot, err := placeholderRoot(opts)
 	if err != nil {
 		return cid.Cid{}, err
 	}
-	digest := hasher.Sum([]byte{})
-	hash, err := multihash.Encode(digest, multihash.SHA2_256)
-	if err != nil {
-		return cid.Cid{}, err
-	}
-	proxyRoot := cid.NewCidV1(uint64(multicodec.DagPb), hash)
 
 	cdest, err := blockstore.OpenReadWrite(output, []cid.Cid{proxyRoot})
 	if err != nil {
@@ -42,11 +36,26 @@ func createCar(input string, output string) (cid.Cid, error) {
 	}
 
 	// Write the unixfs blocks into the store.
-	root, err := writeFiles(context.TODO(), true, cdest, input)
+	var root cid.Cid
+	if opts == nil {
+		root, err = writeFiles(context.TODO(), true, cdest, input)
+	} else {
+		var nd format.Node
+		nd, err = importPath(context.TODO(), input, opts, &blockSink{put: func(blk blocks.Block) error {
+			return cdest.Put(context.TODO(), blk)
+		}})
+		if nd != nil {
+			root = nd.Cid()
+		}
+	}
 	if err != nil {
 		return cid.Cid{}, err
 	}
 
+	if err := checkRoot(root); err != nil {
+		return cid.Cid{}, err
+	}
+
 	if err := cdest.Finalize(); err != nil {
 		return cid.Cid{}, err
 	}
@@ -145,6 +154,69 @@ func CalculateCid(r io.Reader) (cid.Cid, error) {
 	return root.Cid, nil
 }
 
+// placeholderRoot makes a cid with the right length that we eventually will patch with the root.
+func placeholderRoot(opts *ImportOptions) (cid.Cid, error) {
+	if opts != nil {
+		return opts.placeholderRoot()
+	}
+
+	hasher, err := multihash.GetHasher(multihash.SHA2_256)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	digest := hasher.Sum([]byte{})
+	hash, err := multihash.Encode(digest, multihash.SHA2_256)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return cid.NewCidV1(uint64(multicodec.DagPb), hash), nil
+}
+
+// checkRoot makes sure the root can be patched into the placeholder of the car header
+func checkRoot(root cid.Cid) error {
+	if root.Prefix().MhType == multihash.IDENTITY {
+		return fmt.Errorf("root %s is inlined, the data is not larger than the inline limit", root.String())
+	}
+	return nil
+}
+
+// calculatePathCid calculates the root CID of a file or folder without storing any block,
+// the result equals to the root returned by createCar for the same path and opts.
+func calculatePathCid(filePath string, opts *ImportOptions) (cid.Cid, error) {
+	if opts != nil {
+		discard := &blockSink{put: func(blocks.Block) error { return nil }}
+		nd, err := importPath(context.TODO(), filePath, opts, discard)
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		return nd.Cid(), nil
+	}
+
+	ls := cidlink.DefaultLinkSystem()
+	ls.TrustedStorage = true
+
+	ls.StorageReadOpener = func(_ ipld.LinkContext, l ipld.Link) (io.Reader, error) {
+		return nil, nil
+	}
+
+	ls.StorageWriteOpener = func(_ ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		return io.Discard, func(l ipld.Link) error {
+			return nil
+		}, nil
+	}
+
+	link, _, err := builder.BuildUnixFSRecursive(filePath, &ls)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	root, ok := link.(cidlink.Link)
+	if !ok {
+		return cid.Cid{}, fmt.Errorf("could not interpret %s", link)
+	}
+	return root.Cid, nil
+}
+
 // CarStream is an interface that combines io.ReadWriter, io.ReaderAt, io.WriterAt, io.Seeker.
 type CarStream interface {
 	io.ReadWriter
@@ -153,19 +225,12 @@ type CarStream interface {
 	io.Seeker
 }
 
-// createCarStream creates a car using a CarStream.
-func createCarStream(r io.Reader, carStream CarStream) (cid.Cid, error) {
-	// make a cid with the right length that we eventually will patch with the root.
-	hasher, err := multihash.GetHasher(multihash.SHA2_256)
-	if err != nil {
-		return cid.Cid{}, err
-	}
-	digest := hasher.Sum([]byte{})
-	hash, err := multihash.Encode(digest, multihash.SHA2_256)
+// createCarStream creates a car using a CarStream, the DAG is laid out with opts if it is not nil
+func createCarStream(r io.Reader, carStream CarStream, opts *ImportOptions) (cid.Cid, error) {
+	proxyRoot, err := placeholderRoot(opts)
 	if err != nil {
 		return cid.Cid{}, err
 	}
-	proxyRoot := cid.NewCidV1(uint64(multicodec.DagPb), hash)
 	// proxyRoot, err := CalculateCID(r)
 	// if err != nil {
 	// 	return cid.Cid{}, err
@@ -177,11 +242,15 @@ func createCarStream(r io.Reader, carStream CarStream) (cid.Cid, error) {
 	}
 
 	// Write the unixfs blocks into the store.
-	root, err := writeBuffer(context.TODO(), r, wCar)
+	root, err := writeBuffer(context.TODO(), r, wCar, opts)
 	if err != nil {
 		return cid.Cid{}, err
 	}
 
+	if err := checkRoot(root); err != nil {
+		return cid.Cid{}, err
+	}
+
 	if err := wCar.Finalize(); err != nil {
 		return cid.Cid{}, err
 	}
@@ -190,8 +259,18 @@ func createCarStream(r io.Reader, carStream CarStream) (cid.Cid, error) {
 }
 
 // writeBuffer writes data to the car using a CarStream.
-func writeBuffer(ctx context.Context, r io.Reader, wCar carstorage.WritableCar) (cid.Cid, error) {
+func writeBuffer(ctx context.Context, r io.Reader, wCar carstorage.WritableCar, opts *ImportOptions) (cid.Cid, error) {
 	sCar := wCar.(*carstorage.StorageCar)
+	if opts != nil {
+		nd, err := importReader(r, opts, &blockSink{put: func(blk blocks.Block) error {
+			return sCar.Put(ctx, blk.Cid().KeyString(), blk.RawData())
+		}})
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		return nd.Cid(), nil
+	}
+
 	ls := cidlink.DefaultLinkSystem()
 	ls.TrustedStorage = true
 
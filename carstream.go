@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-unixfsnode/data/builder"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// dagWalker builds a UnixFS DAG, passes every block to put and returns the root.
+// It must build the same DAG every time it is called.
+type dagWalker func(put func(blocks.Block) error) (cid.Cid, error)
+
+// pathWalker builds the DAG of a file or folder, the import with opts stops when ctx is done
+func pathWalker(ctx context.Context, filePath string, opts *ImportOptions) dagWalker {
+	return func(put func(blocks.Block) error) (cid.Cid, error) {
+		if opts != nil {
+			nd, err := importPath(ctx, filePath, opts, &blockSink{put: put})
+			if err != nil {
+				return cid.Cid{}, err
+			}
+			return nd.Cid(), nil
+		}
+
+		link, _, err := builder.BuildUnixFSRecursive(filePath, blockLinkSystem(put))
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		return linkCid(link)
+	}
+}
+
+// sourceWalker builds the DAG of the data opened by open
+func sourceWalker(open SourceFunc, opts *ImportOptions) dagWalker {
+	return func(put func(blocks.Block) error) (cid.Cid, error) {
+		r, err := open()
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		defer r.Close()
+
+		if opts != nil {
+			nd, err := importReader(r, opts, &blockSink{put: put})
+			if err != nil {
+				return cid.Cid{}, err
+			}
+			return nd.Cid(), nil
+		}
+
+		link, _, err := builder.BuildUnixFSFile(r, "", blockLinkSystem(put))
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		return linkCid(link)
+	}
+}
+
+// blockLinkSystem returns a link system which passes every stored block to put
+func blockLinkSystem(put func(blocks.Block) error) *ipld.LinkSystem {
+	ls := cidlink.DefaultLinkSystem()
+	ls.TrustedStorage = true
+
+	ls.StorageReadOpener = func(_ ipld.LinkContext, l ipld.Link) (io.Reader, error) {
+		return nil, fmt.Errorf("can not read %s from a streaming car", l.String())
+	}
+
+	ls.StorageWriteOpener = func(_ ipld.LinkContext) (io.Writer, ipld.BlockWriteCommitter, error) {
+		buf := bytes.NewBuffer(nil)
+		return buf, func(l ipld.Link) error {
+			c, err := linkCid(l)
+			if err != nil {
+				return err
+			}
+			blk, err := blocks.NewBlockWithCid(buf.Bytes(), c)
+			if err != nil {
+				return err
+			}
+			return put(blk)
+		}, nil
+	}
+
+	return &ls
+}
+
+func linkCid(l ipld.Link) (cid.Cid, error) {
+	cl, ok := l.(cidlink.Link)
+	if !ok {
+		return cid.Undef, fmt.Errorf("could not interpret %s", l)
+	}
+	return cl.Cid, nil
+}
+
+// carPlan is a CARv1 which is generated again every time it is opened,
+// so it is never stored in memory or on disk.
+type carPlan struct {
+	root cid.Cid
+	size int64
+	walk dagWalker
+
+	// changed is set once an opened car has another root, the data was modified after it was planned
+	changed atomic.Bool
+}
+
+// planCar builds the DAG once to get the root and the size of the car
+func planCar(walk dagWalker) (*carPlan, error) {
+	var (
+		size int64
+		seen = cid.NewSet()
+	)
+
+	root, err := walk(func(blk blocks.Block) error {
+		if seen.Visit(blk.Cid()) {
+			size += int64(util.LdSize(blk.Cid().Bytes(), blk.RawData()))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkRoot(root); err != nil {
+		return nil, err
+	}
+
+	headerSize, err := carv1.HeaderSize(&carv1.CarHeader{Roots: []cid.Cid{root}, Version: 1})
+	if err != nil {
+		return nil, err
+	}
+
+	return &carPlan{root: root, size: size + int64(headerSize), walk: walk}, nil
+}
+
+// open builds the DAG again and streams it as a car, duplicated blocks are written once.
+func (p *carPlan) open() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{p.root}, Version: 1}, pw); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+
+		seen := cid.NewSet()
+		root, err := p.walk(func(blk blocks.Block) error {
+			if !seen.Visit(blk.Cid()) {
+				return nil
+			}
+			return util.LdWrite(pw, blk.Cid().Bytes(), blk.RawData())
+		})
+		if err == nil && !root.Equals(p.root) {
+			p.changed.Store(true)
+			err = fmt.Errorf("root %s changed to %s, the data is modified during upload", p.root.String(), root.String())
+		}
+
+		pw.CloseWithError(err)
+	}()
+
+	return &carReader{PipeReader: pr, remaining: p.size, done: done}, nil
+}
+
+// carReader is the streaming car with known size
+type carReader struct {
+	*io.PipeReader
+	remaining int64
+	done      chan struct{}
+}
+
+func (r *carReader) Read(p []byte) (int, error) {
+	n, err := r.PipeReader.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+// Close stops generating the car, it returns after the source is no longer read
+func (r *carReader) Close() error {
+	err := r.PipeReader.Close()
+	<-r.done
+	return err
+}
+
+// Len returns the number of the unread bytes
+func (r *carReader) Len() int {
+	return int(r.remaining)
+}
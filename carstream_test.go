@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	carv1 "github.com/ipld/go-car"
+)
+
+func TestUploadStreamingCar(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 2<<20)
+	rand.New(rand.NewSource(5)).Read(data)
+
+	// the duplicated files must be written into the car once
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "sub", "c.txt"), []byte("hello titan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock     sync.Mutex
+		received []byte
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+
+		lock.Lock()
+		received = b
+		lock.Unlock()
+		json.NewEncoder(w).Encode(UploadFileResult{})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return []*client.Endpoint{{CandidateAddr: node.URL}} },
+	}
+	s := &storage{webAPI: web}
+
+	root, err := s.UploadFilesWithPath(context.Background(), dir, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect, err := calculatePathCid(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !root.Equals(expect) {
+		t.Fatalf("expect root %s, got %s", expect, root)
+	}
+
+	if size := web.created[0].AssetSize; size != int64(len(received)) {
+		t.Fatalf("asset size %d does not match the uploaded car size %d", size, len(received))
+	}
+
+	cr, err := carv1.NewCarReader(bytes.NewReader(received))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cr.Header.Roots) != 1 || !cr.Header.Roots[0].Equals(root) {
+		t.Fatalf("unexpected car roots %v", cr.Header.Roots)
+	}
+
+	seen := make(map[string]bool)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[blk.Cid().KeyString()] {
+			t.Fatalf("block %s is duplicated", blk.Cid())
+		}
+		seen[blk.Cid().KeyString()] = true
+	}
+}
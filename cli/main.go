@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 	"time"
 
 	storage "github.com/Titannet-dao/titan-storage-sdk"
+	"github.com/Titannet-dao/titan-storage-sdk/s3gateway"
+	"github.com/Titannet-dao/titan-storage-sdk/webdavfs"
+	"github.com/ipfs/go-cid"
 	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
+	"golang.org/x/net/webdav"
 )
 
 func getTitanURLAndAPIKeyFromEnv() (string, string, error) {
@@ -75,10 +84,28 @@ var uploadCmd = &cobra.Command{
 			log.Printf("total size:%d bytes, done %d bytes\n", totalSize, doneSize)
 		}
 
-		makeCar, _ := cmd.Flags().GetBool("make-car")
-		cid, err := s.UploadFilesWithPath(context.Background(), filePath, progress, makeCar)
-		if err != nil {
-			log.Fatal("UploadFilesWithPath ", err)
+		ctx := context.Background()
+		if cmd.Flags().Changed("folder-id") {
+			folderID, _ := cmd.Flags().GetInt("folder-id")
+			ctx = storage.WithFolderID(ctx, folderID)
+		}
+		if folder, _ := cmd.Flags().GetString("folder"); len(folder) > 0 {
+			ctx = storage.WithFolderPath(ctx, folder, true)
+		}
+
+		var cid cid.Cid
+		if journal, _ := cmd.Flags().GetBool("journal"); journal {
+			cid, err = s.UploadWithJournal(ctx, filePath, nil, progress)
+			if err != nil {
+				log.Fatal("UploadWithJournal ", err)
+			}
+		} else {
+			makeCar, _ := cmd.Flags().GetBool("make-car")
+			res, err := s.Upload(ctx, storage.PathSource(filePath), storage.UploadProgress(progress), storage.UploadAsCar(makeCar))
+			if err != nil {
+				log.Fatal("Upload ", err)
+			}
+			cid = res.CID
 		}
 
 		costTime := time.Since(startTime) / time.Millisecond
@@ -169,6 +196,45 @@ var getFileCmd = &cobra.Command{
 			log.Fatal("Initialize error ", err)
 		}
 
+		if folder, _ := cmd.Flags().GetBool("folder"); folder {
+			startTime := time.Now()
+			fileSize := int64(0)
+			progress := func(doneSize int64, totalSize int64) {
+				fileSize = totalSize
+				log.Printf("total size:%d bytes, done %d bytes\n", totalSize, doneSize)
+			}
+
+			include, _ := cmd.Flags().GetStringSlice("include")
+			exclude, _ := cmd.Flags().GetStringSlice("exclude")
+			symlinks, _ := cmd.Flags().GetBool("symlinks")
+			opts := &storage.DirectoryOptions{Include: include, Exclude: exclude, Symlinks: symlinks, Progress: progress}
+
+			if err := s.DownloadDirectory(context.Background(), cid, outFileName, opts); err != nil {
+				log.Fatal("DownloadDirectory ", err)
+			}
+
+			costTime := time.Since(startTime) / time.Millisecond
+			log.Printf("get %s success cost %d ms, size %d bytes", cid, costTime, fileSize)
+			return
+		}
+
+		if resume, _ := cmd.Flags().GetBool("resume"); resume {
+			startTime := time.Now()
+			fileSize := int64(0)
+			progress := func(doneSize int64, totalSize int64) {
+				fileSize = totalSize
+				log.Printf("total size:%d bytes, done %d bytes\n", totalSize, doneSize)
+			}
+
+			if err := s.DownloadToFile(context.Background(), cid, outFileName, &storage.DownloadOptions{Progress: progress}); err != nil {
+				log.Fatal("DownloadToFile ", err)
+			}
+
+			costTime := time.Since(startTime) / time.Millisecond
+			log.Printf("get %s success cost %d ms, size %d bytes", cid, costTime, fileSize)
+			return
+		}
+
 		reader, _, err := s.GetFileWithCid(context.Background(), cid)
 		if err != nil {
 			log.Fatal("UploadFilesWithPath ", err)
@@ -325,10 +391,8 @@ var listFolderCmd = &cobra.Command{
 			log.Fatal("Initialize error ", err)
 		}
 
-		rsp, err := s.ListGroups(cmd.Context(), parentID, count, start)
-		if err != nil {
-			log.Fatal("CreateGroup ", err)
-		}
+		folders := s.IterFolders(cmd.Context(), parentID, &storage.IterOptions{PageSize: count})
+		defer folders.Close()
 
 		tw := NewTableWriter(
 			Col("ID"),
@@ -340,8 +404,12 @@ var listFolderCmd = &cobra.Command{
 			Col("CreatedTime"),
 		)
 
-		for _, group := range rsp.AssetGroups {
-			// asset := rets.AssetOverviews[w]
+		for i := 0; i < end && folders.Next(); i++ {
+			if i < start {
+				continue
+			}
+
+			group := folders.Value()
 			m := map[string]interface{}{
 				"ID":          group.ID,
 				"Name":        group.Name,
@@ -355,8 +423,12 @@ var listFolderCmd = &cobra.Command{
 			tw.Write(m)
 		}
 
+		if err := folders.Err(); err != nil {
+			log.Fatal("ListGroups ", err)
+		}
+
 		tw.Flush(os.Stdout)
-		fmt.Println("Total ", rsp.Total)
+		fmt.Println("Total ", folders.Total())
 
 	},
 }
@@ -384,6 +456,246 @@ var deleteFolderCmd = &cobra.Command{
 	},
 }
 
+var moveFileCmd = &cobra.Command{
+	Use:     "mv",
+	Short:   "move file to folder",
+	Example: "mv your-file-cid target-folder-id",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		rootCID := args[0]
+		folderID, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatal("invalid folder id ", err)
+		}
+
+		titanURL, apiKey, err := getTitanURLAndAPIKeyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s, err := storage.Initialize(&storage.Config{TitanURL: titanURL, APIKey: apiKey})
+		if err != nil {
+			log.Fatal("Initialize error ", err)
+		}
+
+		if err = s.MoveAsset(cmd.Context(), rootCID, folderID); err != nil {
+			log.Fatal("MoveAsset ", err)
+		}
+
+		log.Printf("move %s to folder %d success", rootCID, folderID)
+	},
+}
+
+var renameFolderCmd = &cobra.Command{
+	Use:     "rename",
+	Short:   "rename a folder",
+	Example: "folder rename folder-id new-name",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		folderID, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatal("invalid folder id ", err)
+		}
+
+		titanURL, apiKey, err := getTitanURLAndAPIKeyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s, err := storage.Initialize(&storage.Config{TitanURL: titanURL, APIKey: apiKey})
+		if err != nil {
+			log.Fatal("Initialize error ", err)
+		}
+
+		if err = s.RenameFolder(cmd.Context(), int64(folderID), args[1]); err != nil {
+			log.Fatal("RenameFolder ", err)
+		}
+
+		log.Printf("rename folder %d to %s success", folderID, args[1])
+	},
+}
+
+var moveFolderCmd = &cobra.Command{
+	Use:     "mv",
+	Short:   "move a folder into the target parent folder",
+	Example: "folder mv folder-id target-parent-id",
+	Args:    cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		folderID, err := strconv.Atoi(args[0])
+		if err != nil {
+			log.Fatal("invalid folder id ", err)
+		}
+		parentID, err := strconv.Atoi(args[1])
+		if err != nil {
+			log.Fatal("invalid parent id ", err)
+		}
+
+		titanURL, apiKey, err := getTitanURLAndAPIKeyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s, err := storage.Initialize(&storage.Config{TitanURL: titanURL, APIKey: apiKey})
+		if err != nil {
+			log.Fatal("Initialize error ", err)
+		}
+
+		if err = s.MoveFolder(cmd.Context(), folderID, parentID); err != nil {
+			log.Fatal("MoveFolder ", err)
+		}
+
+		log.Printf("move folder %d to %d success", folderID, parentID)
+	},
+}
+
+var shareCmd = &cobra.Command{
+	Use:     "share",
+	Short:   "create a shared link of a file",
+	Example: "share your-file-cid",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		titanURL, apiKey, err := getTitanURLAndAPIKeyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s, err := storage.Initialize(&storage.Config{TitanURL: titanURL, APIKey: apiKey})
+		if err != nil {
+			log.Fatal("Initialize error ", err)
+		}
+
+		link, err := s.CreateSharedLink(cmd.Context(), args[0], 0)
+		if err != nil {
+			log.Fatal("CreateSharedLink ", err)
+		}
+
+		fmt.Println("URL ", link)
+	},
+}
+
+var gatewayCmd = &cobra.Command{
+	Use:   "gateway",
+	Short: "serve the titan storage through other protocols",
+}
+
+var gatewayS3Cmd = &cobra.Command{
+	Use:     "s3",
+	Short:   "serve the titan storage through the S3 API, the buckets are the top level folders",
+	Example: "gateway s3 --listen :9000 --config /path/to/s3-gateway.json",
+	Run: func(cmd *cobra.Command, args []string) {
+		listen, _ := cmd.Flags().GetString("listen")
+		config, _ := cmd.Flags().GetString("config")
+
+		if len(config) == 0 {
+			log.Fatal("Please specify the --config file of the access keys")
+		}
+
+		creds, err := s3gateway.LoadCredentials(config)
+		if err != nil {
+			log.Fatal("LoadCredentials ", err)
+		}
+
+		titanURL, apiKey, err := getTitanURLAndAPIKeyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s, err := storage.Initialize(&storage.Config{TitanURL: titanURL, APIKey: apiKey})
+		if err != nil {
+			log.Fatal("Initialize error ", err)
+		}
+
+		s.SetAreas(context.Background(), []string{getAreaIDFromEnv()})
+
+		g := s3gateway.New(s3gateway.NewBackend(s), creds)
+		defer g.Close()
+
+		log.Printf("S3 gateway listening on %s", listen)
+		if err = serveHTTP(cmd.Context(), listen, g); err != nil {
+			log.Print("serve ", err)
+		}
+	},
+}
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve the titan storage as a file server",
+}
+
+var serveWebdavCmd = &cobra.Command{
+	Use:     "webdav",
+	Short:   "serve the titan storage through WebDAV, the folders are the collections",
+	Example: "serve webdav --listen :8080 --username titan --password your_password",
+	Run: func(cmd *cobra.Command, args []string) {
+		listen, _ := cmd.Flags().GetString("listen")
+		username, _ := cmd.Flags().GetString("username")
+		password, _ := cmd.Flags().GetString("password")
+
+		if len(password) == 0 {
+			password = os.Getenv("WEBDAV_PASSWORD")
+		}
+
+		if len(username) > 0 && len(password) == 0 {
+			log.Fatal("Please specify the --password or the environment variable WEBDAV_PASSWORD with --username")
+		}
+
+		titanURL, apiKey, err := getTitanURLAndAPIKeyFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		s, err := storage.Initialize(&storage.Config{TitanURL: titanURL, APIKey: apiKey})
+		if err != nil {
+			log.Fatal("Initialize error ", err)
+		}
+
+		s.SetAreas(context.Background(), []string{getAreaIDFromEnv()})
+
+		var handler http.Handler = &webdav.Handler{
+			FileSystem: webdavfs.New(webdavfs.NewBackend(s)),
+			LockSystem: webdav.NewMemLS(),
+			Logger: func(r *http.Request, err error) {
+				if err != nil {
+					log.Printf("%s %s: %s", r.Method, r.URL.Path, err.Error())
+				}
+			},
+		}
+
+		if len(username) > 0 {
+			handler = webdavfs.BasicAuth(handler, username, password)
+		}
+
+		log.Printf("WebDAV server listening on %s", listen)
+		if err = serveHTTP(cmd.Context(), listen, handler); err != nil {
+			log.Print("serve ", err)
+		}
+	},
+}
+
+// serveHTTP serves handler at addr until it is interrupted
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
 var docCmd = &cobra.Command{
 	Use:   "gendoc",
 	Short: "Generate markdown documentation",
@@ -397,6 +709,9 @@ var docCmd = &cobra.Command{
 
 func init() {
 	uploadCmd.Flags().Bool("make-car", true, "make car")
+	uploadCmd.Flags().Bool("journal", false, "record the upload in a journal, uploading the same file again after a failure reuses its cid and nodes")
+	uploadCmd.Flags().Int("folder-id", 0, "upload into the folder, 0 is the root folder")
+	uploadCmd.Flags().String("folder", "", "upload into the folder path, e.g. /invoices/2026/10, the missing folders are created")
 
 	listFilesCmd.Flags().Int("group-id", 0, "the group id")
 	listFilesCmd.Flags().Int("page-size", 20, "Limit the page size")
@@ -404,6 +719,11 @@ func init() {
 
 	getFileCmd.Flags().String("cid", "", "the cid of file")
 	getFileCmd.Flags().String("out", "", "the path to save file")
+	getFileCmd.Flags().Bool("resume", false, "download into a checkpointed file and resume the interrupted download of the same file")
+	getFileCmd.Flags().Bool("folder", false, "download a folder and recreate it under the out path")
+	getFileCmd.Flags().StringSlice("include", nil, "only download the files matching these patterns, with --folder")
+	getFileCmd.Flags().StringSlice("exclude", nil, "skip the files and folders matching these patterns, with --folder")
+	getFileCmd.Flags().Bool("symlinks", false, "recreate the symlinks of the folder, with --folder")
 
 	createFolderCmd.Flags().StringP("name", "n", "", "special the name for group")
 	createFolderCmd.Flags().Int("parentID", 0, "special the parent for group")
@@ -413,6 +733,13 @@ func init() {
 	listFolderCmd.Flags().IntP("end", "e", 20, "special the end for list")
 
 	deleteFolderCmd.Flags().Int("groupID", 0, "special the group id")
+
+	gatewayS3Cmd.Flags().String("listen", ":9000", "the address to listen on")
+	gatewayS3Cmd.Flags().String("config", "", `the JSON file of the access keys, e.g. {"region": "us-east-1", "keys": {"AKID": "secret"}}`)
+
+	serveWebdavCmd.Flags().String("listen", ":8080", "the address to listen on")
+	serveWebdavCmd.Flags().String("username", "", "require the basic auth with the username")
+	serveWebdavCmd.Flags().String("password", "", "the password of the basic auth, it is read from the environment variable WEBDAV_PASSWORD if it is empty")
 }
 
 func Execute() {
@@ -422,12 +749,22 @@ func Execute() {
 	rootCmd.AddCommand(getFileCmd)
 	rootCmd.AddCommand(deleteFileCmd)
 	rootCmd.AddCommand(getURLCmd)
+	rootCmd.AddCommand(moveFileCmd)
 	rootCmd.AddCommand(folderCmd)
+	rootCmd.AddCommand(shareCmd)
+	rootCmd.AddCommand(gatewayCmd)
+	rootCmd.AddCommand(serveCmd)
 	rootCmd.AddCommand(docCmd)
 
 	folderCmd.AddCommand(createFolderCmd)
 	folderCmd.AddCommand(listFolderCmd)
 	folderCmd.AddCommand(deleteFolderCmd)
+	folderCmd.AddCommand(renameFolderCmd)
+	folderCmd.AddCommand(moveFolderCmd)
+
+	gatewayCmd.AddCommand(gatewayS3Cmd)
+
+	serveCmd.AddCommand(serveWebdavCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// The sentinel errors of the web API, an *APIError matches them with errors.Is.
+var (
+	ErrAssetNotFound = errors.New("asset not found")
+	// ErrNotFound is a 404 without the error code of the web API, e.g. the path is not served by TitanURL
+	ErrNotFound      = errors.New("not found")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrAlreadyExists = errors.New("already exists")
+	ErrRateLimited   = errors.New("rate limited")
+	// ErrNotSupported is returned by the methods the web API has no endpoint for
+	ErrNotSupported = errors.New("not supported by the web API")
+)
+
+// The Result.Err codes of the web API, a failed request has Result.Code -1 and one of them in Result.Err
+const (
+	errCodeNotFound                 = 1001
+	errCodeAssetExists              = isAssetAlreadyExist
+	errCodeUserStorageSizeNotEnough = 1018
+)
+
+// errCodes maps the Result.Err codes of the web API to the sentinel errors
+var errCodes = map[int]error{
+	errCodeNotFound:                 ErrAssetNotFound,
+	errCodeAssetExists:              ErrAlreadyExists,
+	errCodeUserStorageSizeNotEnough: ErrQuotaExceeded,
+}
+
+// statusErrors maps the HTTP status codes to the sentinel errors, e.g. 401 of an expired token
+var statusErrors = map[int]error{
+	http.StatusUnauthorized:          ErrUnauthorized,
+	http.StatusForbidden:             ErrUnauthorized,
+	http.StatusNotFound:              ErrNotFound,
+	http.StatusConflict:              ErrAlreadyExists,
+	http.StatusRequestEntityTooLarge: ErrQuotaExceeded,
+	http.StatusInsufficientStorage:   ErrQuotaExceeded,
+	http.StatusTooManyRequests:       ErrRateLimited,
+}
+
+// APIError is a failed request of the web API
+type APIError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Code and Err are Result.Code and Result.Err, they are 0 if the status is not 200
+	Code int
+	Err  int
+	// Msg is Result.Msg, or the body if the status is not 200
+	Msg string
+	// Path is the path of the request
+	Path string
+}
+
+// NewAPIError returns the error of rsp, ret is the decoded result or nil if the status is not 200
+func NewAPIError(rsp *http.Response, ret *Result) *APIError {
+	e := &APIError{StatusCode: rsp.StatusCode}
+	if rsp.Request != nil && rsp.Request.URL != nil {
+		e.Path = rsp.Request.URL.Path
+	}
+
+	if ret != nil {
+		e.Code, e.Err, e.Msg = ret.Code, ret.Err, ret.Msg
+	} else {
+		buf, _ := io.ReadAll(io.LimitReader(rsp.Body, 4096))
+		e.Msg = string(buf)
+	}
+
+	return e
+}
+
+func (e *APIError) Error() string {
+	if e.StatusCode != http.StatusOK {
+		return fmt.Sprintf("status code %d, %s, path: %s", e.StatusCode, e.Msg, e.Path)
+	}
+	return fmt.Sprintf("code: %d, err: %d, msg: %s, path: %s", e.Code, e.Err, e.Msg, e.Path)
+}
+
+// Is reports whether the error is one of the sentinel errors
+func (e *APIError) Is(target error) bool {
+	if err, ok := errCodes[e.Err]; ok {
+		return err == target
+	}
+	if err, ok := statusErrors[e.StatusCode]; ok {
+		return err == target
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/rand"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries      = 3
+	defaultRetryMinDelay   = 200 * time.Millisecond
+	defaultRetryMaxDelay   = 5 * time.Second
+	defaultDownloadTimeout = 30 * time.Second
+)
+
+// Options are the settings of every HTTP call made by the SDK,
+// the web API, the uploads to the candidate nodes and the downloads from the L1 nodes.
+// A nil *Options uses the defaults.
+type Options struct {
+	// HTTPClient is used for all calls as it is, the other transport settings are ignored
+	HTTPClient *http.Client
+	// Transport is the RoundTripper of the calls, Proxy and RootCAs are ignored if it is set
+	Transport http.RoundTripper
+	// Proxy returns the proxy of a request, default is http.ProxyFromEnvironment
+	Proxy func(*http.Request) (*neturl.URL, error)
+	// RootCAs verifies the certificates of the web API and the candidate nodes,
+	// the L1 nodes use self-signed certificates which are not verified.
+	RootCAs *x509.CertPool
+
+	// APITimeout limits every attempt of a web API call, 0 means no limit
+	APITimeout time.Duration
+	// UploadTimeout limits every upload request to a node, 0 means no limit
+	UploadTimeout time.Duration
+	// DownloadTimeout limits every range request to a node, default is 30s
+	DownloadTimeout time.Duration
+
+	// MaxRetries is the number of retries of the idempotent web API calls, 0 or -1 disables retrying.
+	// NewOptions sets it to 3 unless WithRetry is given.
+	MaxRetries int
+	// RetryMinDelay and RetryMaxDelay bound the exponential backoff between the retries
+	RetryMinDelay time.Duration
+	RetryMaxDelay time.Duration
+
+	// retrySet is true if MaxRetries is set by WithRetry, so 0 is kept
+	retrySet bool
+
+	once       sync.Once
+	client     *http.Client
+	nodeClient *http.Client
+}
+
+// Option sets a field of Options
+type Option func(*Options)
+
+// WithHTTPClient makes all calls use c
+func WithHTTPClient(c *http.Client) Option {
+	return func(o *Options) {
+		o.HTTPClient = c
+	}
+}
+
+// WithTransport makes all calls use rt
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *Options) {
+		o.Transport = rt
+	}
+}
+
+// WithProxy sends all calls through the proxy at proxyURL
+func WithProxy(proxyURL *neturl.URL) Option {
+	return func(o *Options) {
+		o.Proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// WithRootCAs verifies the certificates of the web API and the candidate nodes with pool
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(o *Options) {
+		o.RootCAs = pool
+	}
+}
+
+// WithAPITimeout limits every attempt of a web API call
+func WithAPITimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.APITimeout = d
+	}
+}
+
+// WithUploadTimeout limits every upload request to a node
+func WithUploadTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.UploadTimeout = d
+	}
+}
+
+// WithDownloadTimeout limits every range request to a node
+func WithDownloadTimeout(d time.Duration) Option {
+	return func(o *Options) {
+		o.DownloadTimeout = d
+	}
+}
+
+// WithRetry sets the retries of the idempotent web API calls,
+// the delay grows exponentially from minDelay to maxDelay with jitter.
+func WithRetry(maxRetries int, minDelay, maxDelay time.Duration) Option {
+	return func(o *Options) {
+		o.MaxRetries = maxRetries
+		o.retrySet = true
+		o.RetryMinDelay = minDelay
+		o.RetryMaxDelay = maxDelay
+	}
+}
+
+// NewOptions returns the Options set by opts, the unset fields are the defaults
+func NewOptions(opts ...Option) *Options {
+	o := &Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if !o.retrySet {
+		o.MaxRetries = defaultMaxRetries
+	}
+	if o.RetryMinDelay <= 0 {
+		o.RetryMinDelay = defaultRetryMinDelay
+	}
+	if o.RetryMaxDelay < o.RetryMinDelay {
+		o.RetryMaxDelay = defaultRetryMaxDelay
+	}
+	if o.DownloadTimeout == 0 {
+		o.DownloadTimeout = defaultDownloadTimeout
+	}
+
+	return o
+}
+
+// defaultOptions is used by a nil *Options
+var defaultOptions = NewOptions()
+
+// Client returns the client of the web API and the uploads
+func (o *Options) Client() *http.Client {
+	if o == nil {
+		return defaultOptions.Client()
+	}
+
+	o.init()
+	return o.client
+}
+
+// NodeClient returns the client of the L1 nodes, it does not verify their certificates
+func (o *Options) NodeClient() *http.Client {
+	if o == nil {
+		return defaultOptions.NodeClient()
+	}
+
+	o.init()
+	return o.nodeClient
+}
+
+func (o *Options) init() {
+	o.once.Do(func() {
+		switch {
+		case o.HTTPClient != nil:
+			o.client = o.HTTPClient
+			o.nodeClient = o.HTTPClient
+		case o.Transport != nil:
+			o.client = &http.Client{Transport: o.Transport}
+			o.nodeClient = o.client
+		default:
+			if o.Proxy == nil && o.RootCAs == nil {
+				o.client = http.DefaultClient
+			} else {
+				o.client = &http.Client{Transport: o.newTransport(&tls.Config{RootCAs: o.RootCAs})}
+			}
+			o.nodeClient = &http.Client{Transport: o.newTransport(&tls.Config{InsecureSkipVerify: true})}
+		}
+	})
+}
+
+func (o *Options) newTransport(tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	if o.Proxy != nil {
+		t.Proxy = o.Proxy
+	}
+	return t
+}
+
+// UploadContext returns the context of an upload request
+func (o *Options) UploadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o == nil {
+		return defaultOptions.UploadContext(ctx)
+	}
+	return withTimeout(ctx, o.UploadTimeout)
+}
+
+// DownloadContext returns the context of a range request
+func (o *Options) DownloadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o == nil {
+		return defaultOptions.DownloadContext(ctx)
+	}
+	return withTimeout(ctx, o.DownloadTimeout)
+}
+
+func withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	if d <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// retries returns the number of retries of an idempotent call
+func (o *Options) retries() int {
+	if o.MaxRetries < 0 {
+		return 0
+	}
+	return o.MaxRetries
+}
+
+// backoff returns the delay before the retry after attempt, with jitter
+func (o *Options) backoff(attempt int) time.Duration {
+	delay := o.RetryMinDelay << attempt
+	if delay > o.RetryMaxDelay || delay <= 0 {
+		delay = o.RetryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Do sends req with the client of the web API, every attempt is limited by APITimeout and
+// the idempotent requests are retried with backoff if they fail by the network, a 5xx status
+// or rate limiting. The body of the response is read, so it is not affected by the timeout of the attempt.
+func (o *Options) Do(req *http.Request, idempotent bool) (*http.Response, error) {
+	if o == nil {
+		return defaultOptions.Do(req, idempotent)
+	}
+
+	retries := 0
+	if idempotent {
+		retries = o.retries()
+	}
+
+	for attempt := 0; ; attempt++ {
+		rsp, err := o.doOnce(req)
+		if attempt >= retries || !shouldRetry(rsp, err) || req.Context().Err() != nil {
+			return rsp, err
+		}
+
+		select {
+		case <-time.After(o.backoff(attempt)):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+
+		// the body was read by the failed attempt
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+func (o *Options) doOnce(req *http.Request) (*http.Response, error) {
+	ctx, cancel := withTimeout(req.Context(), o.APITimeout)
+	defer cancel()
+
+	rsp, err := o.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+	rsp.Body = io.NopCloser(bytes.NewReader(body))
+	rsp.Request = req
+
+	return rsp, nil
+}
+
+func shouldRetry(rsp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return rsp.StatusCode >= http.StatusInternalServerError || rsp.StatusCode == http.StatusTooManyRequests
+}
@@ -51,16 +51,16 @@ type Webserver interface {
 	ListAssetSummary(ctx context.Context, userID string, parent, limit, offset int) (*ListAssetSummaryRsp, error)
 	// DeleteGroup delete a group
 	DeleteGroup(ctx context.Context, userID string, groupID int) error
-	// RenameGroup rename group
-	RenameGroup(ctx context.Context, userID, newName string, groupID int) error
-	// MoveAssetToGroup move a asset to group
-	MoveAssetToGroup(ctx context.Context, userID, cid string, groupID int) error
-	// MoveAssetGroup move a asset group
-	MoveAssetGroup(ctx context.Context, userID string, groupID, targetGroupID int) error
+	// RenameGroup rename group, the web API does not support it yet
+	RenameGroup(ctx context.Context, newName string, groupID int) error
+	// MoveAssetToGroup move a asset to group, the web API does not support it yet
+	MoveAssetToGroup(ctx context.Context, cid string, groupID int) error
+	// MoveAssetGroup move a asset group, the web API does not support it yet
+	MoveAssetGroup(ctx context.Context, groupID, targetGroupID int) error
 	// GetAPPKeyPermissions get the permissions of user app key
 	GetAPPKeyPermissions(ctx context.Context, userID, keyName string) ([]string, error)
 	// GetNodeUploadInfo
-	GetNodeUploadInfo(ctx context.Context, userID, area string, urlMode bool) (*UploadInfo, error)
+	GetNodeUploadInfo(ctx context.Context, userID, area string, urlMode, encrypted bool) (*UploadInfo, error)
 	// AssetTransferReport
 	AssetTransferReport(ctx context.Context, req AssetTransferReq) error
 
@@ -74,14 +74,19 @@ type Webserver interface {
 var _ Webserver = (*webserver)(nil)
 
 // NewWebserver creates a new Scheduler instance with the specified URL, headers, and options.
-func NewWebserver(url string, apiKey, token string) Webserver {
-	return &webserver{url: url, apiKey: apiKey, token: token, client: http.DefaultClient}
+func NewWebserver(url string, apiKey, token string, opts ...Option) Webserver {
+	return NewWebserverWithOptions(url, apiKey, token, NewOptions(opts...))
+}
+
+// NewWebserverWithOptions creates a new Scheduler instance which shares opts with the other HTTP calls.
+func NewWebserverWithOptions(url string, apiKey, token string, opts *Options) Webserver {
+	return &webserver{url: url, apiKey: apiKey, token: token, opts: opts}
 }
 
 type webserver struct {
 	// client *Client
-	url    string
-	client *http.Client
+	url  string
+	opts *Options
 
 	apiKey string
 	token  string
@@ -96,14 +101,13 @@ func (s *webserver) GetVipInfo(ctx context.Context) (*VipInfo, error) {
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -118,7 +122,7 @@ func (s *webserver) GetVipInfo(ctx context.Context) (*VipInfo, error) {
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	vipInfo := &VipInfo{}
@@ -149,14 +153,13 @@ func (s *webserver) ListAreaIDs(ctx context.Context) ([]string, error) {
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -171,7 +174,7 @@ func (s *webserver) ListAreaIDs(ctx context.Context) ([]string, error) {
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	var listAreas = &ListAreaID{}
@@ -210,6 +213,7 @@ func (s *webserver) CreateAsset(ctx context.Context, caReq *CreateAssetReq) (*Cr
 		AssetType: caReq.AssetType,
 		AssetSize: caReq.AssetSize,
 		GroupID:   int64(caReq.GroupID),
+		Encrypted: caReq.Encrypted,
 	}
 
 	jsonBytes, err := json.Marshal(postData)
@@ -226,14 +230,13 @@ func (s *webserver) CreateAsset(ctx context.Context, caReq *CreateAssetReq) (*Cr
 	req.Header.Set("Content-Type", "application/json")
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, false)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -251,7 +254,7 @@ func (s *webserver) CreateAsset(ctx context.Context, caReq *CreateAssetReq) (*Cr
 		if ret.Err == isAssetAlreadyExist {
 			return &CreateAssetRsp{IsAlreadyExist: true, Endpoints: nil}, nil
 		}
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	endpoints := make([]*Endpoint, 0)
@@ -274,14 +277,13 @@ func (s *webserver) DeleteAsset(ctx context.Context, userID, assetCID string) er
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, false)
 	if err != nil {
 		return err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -296,7 +298,7 @@ func (s *webserver) DeleteAsset(ctx context.Context, userID, assetCID string) er
 	}
 
 	if ret.Code != 0 {
-		return fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return NewAPIError(rsp, ret)
 	}
 
 	return nil
@@ -312,14 +314,13 @@ func (s *webserver) ShareAsset(ctx context.Context, userID, areaID, assetCID str
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -334,7 +335,7 @@ func (s *webserver) ShareAsset(ctx context.Context, userID, areaID, assetCID str
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	result := &ShareAssetResult{}
@@ -367,14 +368,13 @@ func (s *webserver) ListAssets(ctx context.Context, parent, pageSize, page int,
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -389,7 +389,7 @@ func (s *webserver) ListAssets(ctx context.Context, parent, pageSize, page int,
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	type Object struct {
@@ -445,14 +445,13 @@ func (s *webserver) RenameAsset(ctx context.Context, assetCID string, newName st
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, false)
 	if err != nil {
 		return err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("status code %d %s", rsp.StatusCode, string(buf))
+		return NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -467,7 +466,7 @@ func (s *webserver) RenameAsset(ctx context.Context, assetCID string, newName st
 	}
 
 	if ret.Code != 0 {
-		return fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return NewAPIError(rsp, ret)
 	}
 	return nil
 }
@@ -482,14 +481,13 @@ func (s *webserver) CreateGroup(ctx context.Context, name string, parent int) (*
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, false)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -504,7 +502,7 @@ func (s *webserver) CreateGroup(ctx context.Context, name string, parent int) (*
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	data := struct {
@@ -528,13 +526,13 @@ func (s *webserver) ListGroups(ctx context.Context, parent, pageSize, page int)
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("status code %d", rsp.StatusCode)
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -549,7 +547,7 @@ func (s *webserver) ListGroups(ctx context.Context, parent, pageSize, page int)
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	listAssetGroupRsp := &ListAssetGroupRsp{}
@@ -576,14 +574,13 @@ func (s *webserver) DeleteGroup(ctx context.Context, userID string, gid int) err
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, false)
 	if err != nil {
 		return err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("status code %d %s", rsp.StatusCode, string(buf))
+		return NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -598,24 +595,24 @@ func (s *webserver) DeleteGroup(ctx context.Context, userID string, gid int) err
 	}
 
 	if ret.Code != 0 {
-		return fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return NewAPIError(rsp, ret)
 	}
 	return nil
 }
 
 // RenameGroup rename group
-func (s *webserver) RenameGroup(ctx context.Context, userID, newName string, groupID int) error {
-	return fmt.Errorf("not implemnet")
+func (s *webserver) RenameGroup(ctx context.Context, newName string, groupID int) error {
+	return fmt.Errorf("rename group %w", ErrNotSupported)
 }
 
 // MoveAssetToGroup move a asset to group
-func (s *webserver) MoveAssetToGroup(ctx context.Context, userID, cid string, groupID int) error {
-	return fmt.Errorf("not implemnet")
+func (s *webserver) MoveAssetToGroup(ctx context.Context, cid string, groupID int) error {
+	return fmt.Errorf("move asset %w", ErrNotSupported)
 }
 
 // MoveAssetGroup move a asset group
-func (s *webserver) MoveAssetGroup(ctx context.Context, userID string, groupID, targetGroupID int) error {
-	return fmt.Errorf("not implemnet")
+func (s *webserver) MoveAssetGroup(ctx context.Context, groupID, targetGroupID int) error {
+	return fmt.Errorf("move group %w", ErrNotSupported)
 }
 
 // GetAPPKeyPermissions get the permissions of user app key
@@ -624,8 +621,8 @@ func (s *webserver) GetAPPKeyPermissions(ctx context.Context, userID, keyName st
 }
 
 // GetNodeUploadInfo
-func (s *webserver) GetNodeUploadInfo(ctx context.Context, userID, area string, urlMode bool) (*UploadInfo, error) {
-	url := fmt.Sprintf("%s/api/v1/storage/get_upload_info?encrypted=false&need_trace=true", s.url)
+func (s *webserver) GetNodeUploadInfo(ctx context.Context, userID, area string, urlMode, encrypted bool) (*UploadInfo, error) {
+	url := fmt.Sprintf("%s/api/v1/storage/get_upload_info?encrypted=%t&need_trace=true", s.url, encrypted)
 	if urlMode {
 		url += "&urlMode=true"
 	}
@@ -642,14 +639,13 @@ func (s *webserver) GetNodeUploadInfo(ctx context.Context, userID, area string,
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -664,7 +660,7 @@ func (s *webserver) GetNodeUploadInfo(ctx context.Context, userID, area string,
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	uploadNodes := &UploadInfo{}
@@ -698,7 +694,7 @@ func (s *webserver) AssetTransferReport(ctx context.Context, req AssetTransferRe
 	// 	TransferType: transferType,
 	// }
 
-	if req.State == AssetTransferStateSuccess {
+	if req.State == AssetTransferStateSuccess && req.CostMs > 0 {
 		// bytes per second
 		req.Rate = req.TotalSize / req.CostMs * 1000
 	}
@@ -716,14 +712,13 @@ func (s *webserver) AssetTransferReport(ctx context.Context, req AssetTransferRe
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("apikey", s.apiKey)
 
-	rsp, err := s.client.Do(request)
+	rsp, err := s.do(request, false)
 	if err != nil {
 		return err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -738,7 +733,7 @@ func (s *webserver) AssetTransferReport(ctx context.Context, req AssetTransferRe
 	}
 
 	if ret.Code != 0 {
-		return fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return NewAPIError(rsp, ret)
 	}
 
 	return nil
@@ -755,14 +750,13 @@ func (s *webserver) GetUserStorage(ctx context.Context) (*UserStorageInfo, error
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -777,7 +771,7 @@ func (s *webserver) GetUserStorage(ctx context.Context) (*UserStorageInfo, error
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	storageInfo := &UserStorageInfo{}
@@ -800,14 +794,13 @@ func (s *webserver) GetAssetCount(ctx context.Context) (*AssetCountInfo, error)
 
 	s.setCredential(req)
 
-	rsp, err := s.client.Do(req)
+	rsp, err := s.do(req, true)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d %s", rsp.StatusCode, string(buf))
+		return nil, NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -822,7 +815,7 @@ func (s *webserver) GetAssetCount(ctx context.Context) (*AssetCountInfo, error)
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, NewAPIError(rsp, ret)
 	}
 
 	assetCount := &AssetCountInfo{}
@@ -864,3 +857,8 @@ func CIDToHash(cidString string) (string, error) {
 
 	return cid.Hash().String(), nil
 }
+
+// do sends the request with the options of the web API, see Options.Do
+func (s *webserver) do(req *http.Request, idempotent bool) (*http.Response, error) {
+	return s.opts.Do(req, idempotent)
+}
@@ -22,6 +22,8 @@ type AssetProperty struct {
 	AssetType string
 	NodeID    string
 	GroupID   int
+	// Encrypted marks the asset encrypted by the client
+	Encrypted bool
 }
 
 type CreateAssetReq struct {
@@ -2,8 +2,13 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 const url = "http://120.79.221.36:10089"
@@ -110,3 +115,95 @@ func TestListAssets(t *testing.T) {
 		fmt.Printf("assetOverview assetName %s  AssetRecord %#v\n", assetOverview.UserAssetDetail.AssetName, *assetOverview.AssetRecord)
 	}
 }
+
+func TestAPIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/storage/get_vip_info":
+			http.Error(w, "token expired", http.StatusUnauthorized)
+		case "/api/v1/storage/share_asset":
+			w.Write([]byte(`{"code":-1,"err":1001,"msg":"Not Found"}`))
+		case "/api/v1/storage/get_asset_group_list":
+			http.NotFound(w, r)
+		case "/api/v1/storage/create_asset":
+			w.Write([]byte(`{"code":-1,"err":1018,"msg":"user storage size not enough"}`))
+		default:
+			w.Write([]byte(`{"code":-1,"err":1017,"msg":"asset exists"}`))
+		}
+	}))
+	defer srv.Close()
+
+	webserver := NewWebserver(srv.URL, key, "")
+
+	_, err := webserver.GetVipInfo(context.Background())
+	if !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expect ErrUnauthorized, got %v", err)
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Path != "/api/v1/storage/get_vip_info" {
+		t.Fatalf("unexpected api error %#v", apiErr)
+	}
+
+	_, err = webserver.ShareAsset(context.Background(), "", "", "cid")
+	if !errors.Is(err, ErrAssetNotFound) || errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expect ErrAssetNotFound, got %v", err)
+	}
+
+	// a 404 without the error code does not tell the asset is missing
+	_, err = webserver.ListAssets(context.Background(), 0, 10, 1, "cid", 0)
+	if !errors.Is(err, ErrNotFound) || errors.Is(err, ErrAssetNotFound) {
+		t.Fatalf("expect ErrNotFound, got %v", err)
+	}
+
+	_, err = webserver.CreateAsset(context.Background(), &CreateAssetReq{})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expect ErrQuotaExceeded, got %v", err)
+	}
+
+	err = webserver.DeleteAsset(context.Background(), "", "cid")
+	if !errors.Is(err, ErrAlreadyExists) {
+		t.Fatalf("expect ErrAlreadyExists, got %v", err)
+	}
+}
+
+func TestWebserverRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1)%3 != 0 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"code":0,"data":{"user_id":"u"}}`))
+	}))
+	defer srv.Close()
+
+	webserver := NewWebserver(srv.URL, key, "", WithRetry(2, time.Millisecond, 10*time.Millisecond), WithAPITimeout(time.Second))
+
+	// the idempotent call succeeds after 2 retries
+	if _, err := webserver.GetVipInfo(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("%d calls, want 3", calls.Load())
+	}
+
+	// the others are sent once
+	calls.Store(0)
+	if err := webserver.DeleteAsset(context.Background(), "", "cid"); err == nil {
+		t.Fatal("expect the delete to fail")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("%d calls, want 1", calls.Load())
+	}
+
+	// 0 retries disables retrying
+	calls.Store(0)
+	webserver = NewWebserver(srv.URL, key, "", WithRetry(0, time.Millisecond, 10*time.Millisecond))
+	if _, err := webserver.GetVipInfo(context.Background()); err == nil {
+		t.Fatal("expect the call to fail")
+	}
+	if calls.Load() != 1 {
+		t.Fatalf("%d calls, want 1", calls.Load())
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/go-cid"
+)
+
+type dedupKey struct{}
+
+// WithDedup returns a context which makes the uploads called with it deduplicated or not,
+// instead of Config.Dedup
+//
+// Deprecated: use Upload with UploadDedup
+func WithDedup(ctx context.Context, dedup bool) context.Context {
+	return context.WithValue(ctx, dedupKey{}, dedup)
+}
+
+// dedupUpload returns if the upload with the options o is deduplicated
+func (s *storage) dedupUpload(o *uploadOptions) bool {
+	if o.dedup != nil {
+		return *o.dedup
+	}
+	return s.dedup
+}
+
+// localCid calculates the CID of the data opened by open with the import options of the upload,
+// nil options lay out the data as CalculateCid does
+func localCid(open SourceFunc, opts *ImportOptions) (cid.Cid, error) {
+	r, err := open()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	defer r.Close()
+
+	return CalculateCidWithOptions(r, opts)
+}
+
+// assetExists reports whether root is stored in the titan storage of the user
+func (s *storage) assetExists(ctx context.Context, root cid.Cid) (bool, error) {
+	rsp, err := s.GetItemDetails(ctx, root.String(), 0)
+	if err != nil {
+		if errors.Is(err, client.ErrAssetNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// the web API may ignore the cid filter, so compare the cid of every asset
+	for _, asset := range rsp.AssetOverviews {
+		if asset.AssetRecord != nil && asset.AssetRecord.CID == root.String() {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
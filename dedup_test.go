@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestUploadDedup(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(9)).Read(data)
+
+	root, err := CalculateCid(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePath := filepath.Join(t.TempDir(), "data.bin")
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock    sync.Mutex
+		uploads int
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		uploads++
+		lock.Unlock()
+
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, _ := CalculateCid(f)
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: c.String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return []*client.Endpoint{{}} },
+		nodes:     func() []*client.NodeUploadInfo { return []*client.NodeUploadInfo{{UploadURL: node.URL, NodeID: "n1"}} },
+		assets:    []string{root.String()},
+	}
+	s := &storage{webAPI: web}
+	ctx := WithDedup(context.Background(), true)
+
+	// the stored file is not sent again
+	res, err := s.Upload(context.Background(), PathSource(filePath), UploadDedup(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.CID.Equals(root) || !res.AlreadyExisted || uploads != 0 || len(web.created) != 0 {
+		t.Fatalf("unexpected result %+v after %d uploads", res, uploads)
+	}
+
+	// the node tells the stream exists
+	web.uploadExists = true
+	res, err = s.UploadStreamWithResult(WithDedup(context.Background(), false), bytes.NewReader(data), "data.bin", nil)
+	if err == nil {
+		t.Fatal("expect the existing stream to fail without dedup")
+	}
+
+	web.assets = nil
+	res, err = s.UploadStreamWithResult(ctx, io.MultiReader(bytes.NewReader(data)), "data.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.CID.Equals(root) || !res.AlreadyExisted || uploads != 0 {
+		t.Fatalf("unexpected result %+v after %d uploads", res, uploads)
+	}
+
+	// a new file is uploaded
+	web.uploadExists = false
+	res, err = s.UploadFilesWithResult(ctx, filePath, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.CID.Equals(root) || res.AlreadyExisted || uploads != 1 || len(web.created) != 1 {
+		t.Fatalf("unexpected result %+v after %d uploads", res, uploads)
+	}
+}
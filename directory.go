@@ -0,0 +1,483 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	unixfspb "github.com/ipfs/boxo/ipld/unixfs/pb"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/multiformats/go-multihash"
+)
+
+// DirectoryOptions are the options of DownloadDirectory
+type DirectoryOptions struct {
+	// Include and Exclude are path.Match patterns, they are matched against the slash separated
+	// path relative to the folder and against the base name. If Include is not empty only the
+	// files matching one of them are downloaded, the files and folders matching Exclude are skipped.
+	Include []string
+	Exclude []string
+	// Symlinks recreates the symlinks, they are skipped by default.
+	// The targets must be relative and stay inside the destination.
+	Symlinks bool
+	// Progress reports the bytes of the files written
+	Progress ProgressFunc
+}
+
+// dirEntry is a file, folder or symlink of the downloaded DAG
+type dirEntry struct {
+	path   string
+	kind   unixfspb.Data_DataType
+	node   format.Node
+	size   int64
+	target string
+}
+
+// DownloadDirectory downloads a folder asset as a car and recreates it under destDir,
+// an asset of a single file is written to destDir with its file name.
+// Every block is verified against the asset CID.
+func (s *storage) DownloadDirectory(ctx context.Context, assetCID, destDir string, opts *DirectoryOptions) error {
+	if opts == nil {
+		opts = &DirectoryOptions{}
+	}
+
+	root, err := cid.Decode(assetCID)
+	if err != nil {
+		return fmt.Errorf("decode cid %s failed, %s", assetCID, err.Error())
+	}
+
+	res, err := s.GetURL(ctx, assetCID)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	size, err := s.downloadDirectory(ctx, root, res, destDir, opts)
+
+	report := &client.AssetTransferReq{
+		CostMs:       time.Since(start).Milliseconds(),
+		TotalSize:    size,
+		TransferType: client.AssetTransferTypeDownload,
+		Cid:          assetCID,
+		State:        client.AssetTransferStateSuccess,
+		TraceID:      res.TraceID,
+	}
+	if err != nil {
+		report.State = client.AssetTransferStateFailed
+		report.Log = err.Error()
+	}
+	s.sendTransferReport(report)
+
+	return err
+}
+
+// downloadDirectory stores the car into a temporary blockstore, then writes the entries to destDir.
+// It returns the size of the files written.
+func (s *storage) downloadDirectory(ctx context.Context, root cid.Cid, res *client.ShareAssetResult, destDir string, opts *DirectoryOptions) (int64, error) {
+	tmp, err := os.MkdirTemp("", "titan-download-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(tmp)
+
+	bs, err := blockstore.OpenReadWrite(filepath.Join(tmp, "asset.car"), []cid.Cid{root})
+	if err != nil {
+		return 0, err
+	}
+	defer bs.Discard()
+
+	if len(res.URLs) == 0 {
+		return 0, fmt.Errorf("no url to download %s", root.String())
+	}
+
+	for _, u := range res.URLs {
+		if err = fetchCarBlocks(ctx, s.opts.NodeClient(), u, bs); err == nil {
+			break
+		}
+		log.Printf("download %s from %s failed, %s", root.String(), u, err.Error())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	dag := &blockDAG{bs: bs}
+	nd, err := dag.Get(ctx, root)
+	if err != nil {
+		return 0, err
+	}
+
+	// a single file is written with its name
+	name := ""
+	if kind, err := nodeKind(nd); err != nil {
+		return 0, err
+	} else if kind != unixfs.TDirectory && kind != unixfs.THAMTShard {
+		name = res.FileName
+		if name == "" {
+			name = root.String()
+		}
+		if !validEntryName(name) {
+			return 0, fmt.Errorf("invalid file name %q", name)
+		}
+	}
+
+	var entries []dirEntry
+	if err = planEntries(ctx, dag, nd, name, opts, &entries); err != nil {
+		return 0, err
+	}
+	if err = checkSymlinks(entries); err != nil {
+		return 0, err
+	}
+
+	return writeEntries(ctx, dag, destDir, entries, opts)
+}
+
+// fetchCarBlocks downloads the car from rawURL and puts every verified block into bs
+func fetchCarBlocks(ctx context.Context, c *http.Client, rawURL string, bs *blockstore.ReadWrite) error {
+	body, err := openCar(ctx, c, rawURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	br := bufio.NewReader(body)
+	if _, err := carv1.ReadHeader(br); err != nil {
+		return fmt.Errorf("read car header error %w", err)
+	}
+
+	for {
+		c, data, err := util.ReadNode(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read block error %w", err)
+		}
+
+		if err := verifyBlock(c, data); err != nil {
+			return err
+		}
+
+		blk, err := blocks.NewBlockWithCid(data, c)
+		if err != nil {
+			return err
+		}
+		if err := bs.Put(ctx, blk); err != nil {
+			return err
+		}
+	}
+}
+
+// planEntries collects the entries under nd, the entry names are checked before anything is written
+func planEntries(ctx context.Context, dag format.DAGService, nd format.Node, rel string, opts *DirectoryOptions, entries *[]dirEntry) error {
+	kind, err := nodeKind(nd)
+	if err != nil {
+		return err
+	}
+
+	switch kind {
+	case unixfs.TDirectory, unixfs.THAMTShard:
+		if rel != "" {
+			*entries = append(*entries, dirEntry{path: rel, kind: unixfs.TDirectory})
+		}
+
+		dir, err := uio.NewDirectoryFromNode(dag, nd)
+		if err != nil {
+			return err
+		}
+
+		return dir.ForEachLink(ctx, func(l *format.Link) error {
+			if !validEntryName(l.Name) {
+				return fmt.Errorf("invalid entry name %q in %q", l.Name, rel)
+			}
+
+			childPath := path.Join(rel, l.Name)
+			if matchAny(opts.Exclude, childPath) {
+				return nil
+			}
+
+			child, err := dag.Get(ctx, l.Cid)
+			if err != nil {
+				return err
+			}
+			return planEntries(ctx, dag, child, childPath, opts, entries)
+		})
+
+	case unixfs.TSymlink:
+		if !opts.Symlinks {
+			return nil
+		}
+
+		fsNode, err := unixfs.ExtractFSNode(nd)
+		if err != nil {
+			return err
+		}
+
+		*entries = append(*entries, dirEntry{path: rel, kind: unixfs.TSymlink, target: string(fsNode.Data())})
+
+	default:
+		if len(opts.Include) > 0 && !matchAny(opts.Include, rel) {
+			return nil
+		}
+
+		size, err := nodeFileSize(nd)
+		if err != nil {
+			return err
+		}
+		*entries = append(*entries, dirEntry{path: rel, kind: unixfs.TFile, node: nd, size: size})
+	}
+
+	return nil
+}
+
+// writeEntries writes the entries to destDir, the symlinks are created last
+// so no file is written through them.
+func writeEntries(ctx context.Context, dag format.DAGService, destDir string, entries []dirEntry, opts *DirectoryOptions) (int64, error) {
+	var totalSize, doneSize int64
+	for _, e := range entries {
+		totalSize += e.size
+	}
+
+	if err := os.MkdirAll(destDir, 0o755); err != nil {
+		return 0, err
+	}
+
+	reporter := func(n int64) {
+		if n > 0 {
+			doneSize += n
+			if opts.Progress != nil {
+				opts.Progress(doneSize, totalSize)
+			}
+		}
+	}
+
+	for _, e := range entries {
+		target := filepath.Join(destDir, filepath.FromSlash(e.path))
+
+		switch e.kind {
+		case unixfs.TDirectory:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return doneSize, err
+			}
+
+		case unixfs.TFile:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return doneSize, err
+			}
+			if err := writeEntryFile(ctx, dag, e.node, target, reporter); err != nil {
+				return doneSize, err
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if e.kind != unixfs.TSymlink {
+			continue
+		}
+
+		target := filepath.Join(destDir, filepath.FromSlash(e.path))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return doneSize, err
+		}
+		if err := os.Symlink(filepath.FromSlash(e.target), target); err != nil {
+			return doneSize, err
+		}
+	}
+
+	return doneSize, nil
+}
+
+func writeEntryFile(ctx context.Context, dag format.DAGService, nd format.Node, filePath string, reporter func(int64)) error {
+	r, err := uio.NewDagReader(ctx, nd, dag)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.OpenFile(filePath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, &ProgressReader{Reader: r, Reporter: reporter})
+	return err
+}
+
+// nodeKind returns the UnixFS type of nd, raw blocks are files
+func nodeKind(nd format.Node) (unixfspb.Data_DataType, error) {
+	if _, ok := nd.(*merkledag.RawNode); ok {
+		return unixfs.TFile, nil
+	}
+
+	fsNode, err := unixfs.ExtractFSNode(nd)
+	if err != nil {
+		return 0, err
+	}
+
+	switch kind := fsNode.Type(); kind {
+	case unixfs.TRaw:
+		return unixfs.TFile, nil
+	case unixfs.TFile, unixfs.TDirectory, unixfs.THAMTShard, unixfs.TSymlink:
+		return kind, nil
+	default:
+		return 0, fmt.Errorf("unsupported unixfs type %s of %s", kind.String(), nd.Cid().String())
+	}
+}
+
+func nodeFileSize(nd format.Node) (int64, error) {
+	if raw, ok := nd.(*merkledag.RawNode); ok {
+		return int64(len(raw.RawData())), nil
+	}
+
+	fsNode, err := unixfs.ExtractFSNode(nd)
+	if err != nil {
+		return 0, err
+	}
+	return int64(fsNode.FileSize()), nil
+}
+
+// validEntryName rejects the names which could escape the folder
+func validEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\\x00")
+}
+
+// checkSymlinks rejects the symlinks whose target leaves the folder, the targets are
+// checked once every entry is known since a target may pass through another symlink
+func checkSymlinks(entries []dirEntry) error {
+	links := make(map[string]bool)
+	for _, e := range entries {
+		if e.kind == unixfs.TSymlink {
+			links[e.path] = true
+		}
+	}
+
+	for _, e := range entries {
+		if e.kind == unixfs.TSymlink && !validSymlink(e.path, e.target, links) {
+			return fmt.Errorf("symlink %q points to %q outside of the folder", e.path, e.target)
+		}
+	}
+	return nil
+}
+
+// validSymlink checks the target of the symlink at rel is relative, stays inside the folder
+// and does not pass through any of the links, whose own targets are not followed here
+func validSymlink(rel, target string, links map[string]bool) bool {
+	if target == "" || path.IsAbs(target) || filepath.IsAbs(target) || strings.Contains(target, "\\") {
+		return false
+	}
+
+	var parts []string
+	if dir := path.Dir(rel); dir != "." {
+		parts = strings.Split(dir, "/")
+	}
+
+	elems := strings.Split(target, "/")
+	for i, elem := range elems {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(parts) == 0 {
+				return false
+			}
+			parts = parts[:len(parts)-1]
+		default:
+			parts = append(parts, elem)
+			// the last element may be a link, it is resolved by whoever opens it
+			if i < len(elems)-1 && links[strings.Join(parts, "/")] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchAny reports whether the path or its base name matches one of the patterns
+func matchAny(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(p)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// blockDAG is a read only format.DAGService of the blocks in a blockstore
+type blockDAG struct {
+	bs *blockstore.ReadWrite
+}
+
+var errReadOnly = errors.New("the dag is read only")
+
+func (d *blockDAG) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	var blk blocks.Block
+	if c.Prefix().MhType == multihash.IDENTITY {
+		dmh, err := multihash.Decode(c.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if blk, err = blocks.NewBlockWithCid(dmh.Digest, c); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if blk, err = d.bs.Get(ctx, c); err != nil {
+			return nil, fmt.Errorf("block %s is missing in the car, %w", c.String(), err)
+		}
+	}
+
+	switch c.Type() {
+	case cid.Raw:
+		return merkledag.DecodeRawBlock(blk)
+	case cid.DagProtobuf:
+		return merkledag.DecodeProtobufBlock(blk)
+	default:
+		return nil, fmt.Errorf("unsupported codec %d of %s", c.Type(), c.String())
+	}
+}
+
+func (d *blockDAG) GetMany(ctx context.Context, cids []cid.Cid) <-chan *format.NodeOption {
+	ch := make(chan *format.NodeOption, len(cids))
+	for _, c := range cids {
+		nd, err := d.Get(ctx, c)
+		ch <- &format.NodeOption{Node: nd, Err: err}
+	}
+	close(ch)
+	return ch
+}
+
+func (d *blockDAG) Add(ctx context.Context, nd format.Node) error {
+	return errReadOnly
+}
+
+func (d *blockDAG) AddMany(ctx context.Context, nds []format.Node) error {
+	return errReadOnly
+}
+
+func (d *blockDAG) Remove(ctx context.Context, c cid.Cid) error {
+	return errReadOnly
+}
+
+func (d *blockDAG) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return errReadOnly
+}
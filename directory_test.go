@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+)
+
+func TestDownloadDirectory(t *testing.T) {
+	src := t.TempDir()
+	files := map[string]string{
+		"a.txt":         "hello",
+		"b.log":         "skipped by exclude",
+		"sub/c.txt":     strings.Repeat("c", 300<<10),
+		"sub/deep/d.md": "not included",
+	}
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("many/f%02d.txt", i)] = fmt.Sprint(i)
+	}
+	for name, content := range files {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../a.txt", filepath.Join(src, "sub", "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	// shard the big folders
+	sharding := uio.HAMTShardingSize
+	uio.HAMTShardingSize = 256
+	defer func() { uio.HAMTShardingSize = sharding }()
+
+	plan, err := planCar(pathWalker(context.Background(), src, &ImportOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := plan.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	car, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sharded := false
+	cr, err := carv1.NewCarReader(bytes.NewReader(car))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		blk, err := cr.Next()
+		if err != nil {
+			break
+		}
+		if nd, err := merkledag.DecodeProtobufBlock(blk); err == nil {
+			if fsNode, err := unixfs.ExtractFSNode(nd); err == nil && fsNode.Type() == unixfs.THAMTShard {
+				sharded = true
+			}
+		}
+	}
+	if !sharded {
+		t.Fatal("expect a sharded folder in the car")
+	}
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(car)
+	}))
+	defer node.Close()
+
+	s := &storage{webAPI: &fakeWebserver{urls: func() []string { return []string{node.URL} }}}
+	dest := t.TempDir()
+
+	var done, total int64
+	opts := &DirectoryOptions{
+		Include:  []string{"*.txt"},
+		Exclude:  []string{"*.log", "deep"},
+		Symlinks: true,
+		Progress: func(doneSize, totalSize int64) { done, total = doneSize, totalSize },
+	}
+	if err := s.DownloadDirectory(context.Background(), plan.root.String(), dest, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		b, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+		if strings.HasSuffix(name, ".txt") {
+			if err != nil || string(b) != content {
+				t.Fatalf("%s is not downloaded, %v", name, err)
+			}
+		} else if err == nil {
+			t.Fatalf("%s should be filtered", name)
+		}
+	}
+
+	if target, err := os.Readlink(filepath.Join(dest, "sub", "link")); err != nil || target != "../a.txt" {
+		t.Fatalf("symlink is not created, %s %v", target, err)
+	}
+
+	if done == 0 || done != total {
+		t.Fatalf("progress %d of %d", done, total)
+	}
+}
+
+func TestDownloadDirectoryTraversal(t *testing.T) {
+	file := merkledag.NewRawNode([]byte("evil"))
+	dir := unixfs.EmptyDirNode()
+	if err := dir.AddNodeLink("../evil", file); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{dir.Cid()}, Version: 1}, buf); err != nil {
+		t.Fatal(err)
+	}
+	util.LdWrite(buf, dir.Cid().Bytes(), dir.RawData())
+	util.LdWrite(buf, file.Cid().Bytes(), file.RawData())
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(buf.Bytes())
+	}))
+	defer node.Close()
+
+	s := &storage{webAPI: &fakeWebserver{urls: func() []string { return []string{node.URL} }}}
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+
+	if err := s.DownloadDirectory(context.Background(), dir.Cid().String(), dest, nil); err == nil {
+		t.Fatal("expect the traversal to fail")
+	}
+
+	if _, err := os.Stat(filepath.Join(parent, "evil")); !os.IsNotExist(err) {
+		t.Fatal("file is written outside of the destination")
+	}
+}
+
+func TestDownloadDirectorySymlinkChain(t *testing.T) {
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	// each target stays inside the folder, but e leaves it through d/ln
+	if err := os.Symlink("..", filepath.Join(src, "d", "ln")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("d/ln/..", filepath.Join(src, "e")); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := planCar(pathWalker(context.Background(), src, &ImportOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := plan.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	car, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(car)
+	}))
+	defer node.Close()
+
+	s := &storage{webAPI: &fakeWebserver{urls: func() []string { return []string{node.URL} }}}
+	dest := filepath.Join(t.TempDir(), "dest")
+
+	if err := s.DownloadDirectory(context.Background(), plan.root.String(), dest, &DirectoryOptions{Symlinks: true}); err == nil {
+		t.Fatal("expect the symlink chain to fail")
+	}
+
+	if _, err := os.Lstat(filepath.Join(dest, "e")); !os.IsNotExist(err) {
+		t.Fatal("symlink through another symlink is created")
+	}
+}
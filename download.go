@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	byterange "github.com/Titannet-dao/titan-storage-sdk/range"
+	"github.com/ipfs/go-cid"
+)
+
+// downloadRangeSize is the size of the ranges fetched by DownloadToFile
+const downloadRangeSize = 1 << 20
+
+// DownloadOptions are the options of DownloadToFile
+type DownloadOptions struct {
+	// VerifyCID calculates the CID of the downloaded file before it is moved into place,
+	// the file must be uploaded with ImportOptions to get the same CID
+	VerifyCID     bool
+	ImportOptions *ImportOptions
+	// Progress is called after every range is written
+	Progress ProgressFunc
+}
+
+// DownloadToFile downloads the asset into filePath. The ranges are written into filePath.part
+// and recorded in the checkpoint filePath.part.json, calling it again after a failure only
+// fetches the missing ranges. The file is renamed to filePath after it is complete,
+// and decrypted in place if it is encrypted and its key is found.
+func (s *storage) DownloadToFile(ctx context.Context, assetCID, filePath string, opts *DownloadOptions) error {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+
+	res, err := s.GetURL(ctx, assetCID)
+	if err != nil {
+		return err
+	}
+
+	cp := loadCheckpoint(filePath, assetCID, downloadRangeSize)
+	cp.progress = opts.Progress
+	defer cp.close()
+
+	start := time.Now()
+	fileSize, err := byterange.NewWithOptions(downloadRangeSize, s.opts).WriteFile(ctx, res, cp)
+
+	report := &client.AssetTransferReq{
+		CostMs:       time.Since(start).Milliseconds(),
+		TotalSize:    fileSize,
+		TransferType: client.AssetTransferTypeDownload,
+		Cid:          assetCID,
+		State:        client.AssetTransferStateFailed,
+		TraceID:      res.TraceID,
+	}
+	defer s.sendTransferReport(report)
+
+	if err != nil {
+		report.Log = err.Error()
+		return err
+	}
+
+	if err = cp.commit(fileSize, opts); err != nil {
+		report.Log = err.Error()
+		return err
+	}
+
+	if err = s.decryptFile(ctx, filePath); err != nil {
+		report.Log = err.Error()
+		return err
+	}
+
+	report.State = client.AssetTransferStateSuccess
+	return nil
+}
+
+// downloadCheckpoint is a byterange.RangeWriter which writes the ranges into a sparse file,
+// the written ranges are recorded in a bitmap which is saved next to the file.
+type downloadCheckpoint struct {
+	Cid       string `json:"cid"`
+	Size      int64  `json:"size"`
+	RangeSize int64  `json:"range_size"`
+	Ranges    []byte `json:"ranges"`
+
+	lock     sync.Mutex
+	filePath string
+	file     *os.File
+	doneSize int64
+	progress ProgressFunc
+}
+
+// loadCheckpoint loads the checkpoint of the download to filePath,
+// a checkpoint of another asset is ignored
+func loadCheckpoint(filePath, assetCID string, rangeSize int64) *downloadCheckpoint {
+	cp := &downloadCheckpoint{filePath: filePath}
+
+	if b, err := os.ReadFile(cp.checkpointPath()); err == nil {
+		if err = json.Unmarshal(b, cp); err != nil {
+			log.Printf("ignore broken download checkpoint: %s", err.Error())
+		}
+	}
+
+	if cp.Cid != assetCID || cp.RangeSize != rangeSize {
+		cp.Cid = assetCID
+		cp.RangeSize = rangeSize
+		cp.Size = -1
+		cp.Ranges = nil
+	}
+
+	return cp
+}
+
+func (cp *downloadCheckpoint) partPath() string {
+	return cp.filePath + ".part"
+}
+
+func (cp *downloadCheckpoint) checkpointPath() string {
+	return cp.filePath + ".part.json"
+}
+
+// Open prepares the sparse file, the checkpoint is reset if the file is missing or the size changed
+func (cp *downloadCheckpoint) Open(fileSize int64) error {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	if _, err := os.Stat(cp.partPath()); err != nil || cp.Size != fileSize {
+		cp.Size = fileSize
+		cp.Ranges = make([]byte, (cp.rangeCount()+7)/8)
+	}
+
+	f, err := os.OpenFile(cp.partPath(), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err = f.Truncate(fileSize); err != nil {
+		f.Close()
+		return err
+	}
+	cp.file = f
+
+	cp.doneSize = 0
+	for i := 0; i < cp.rangeCount(); i++ {
+		if cp.has(i) {
+			cp.doneSize += cp.rangeLength(i)
+		}
+	}
+
+	return cp.save()
+}
+
+func (cp *downloadCheckpoint) WriteAt(p []byte, off int64) (int, error) {
+	return cp.file.WriteAt(p, off)
+}
+
+// Has reports whether the range at index is written
+func (cp *downloadCheckpoint) Has(index int) bool {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	return cp.has(index)
+}
+
+// Done records the range at index as written, the range is synced to the disk before the bitmap is saved,
+// so a crash never leaves a range recorded which is not written.
+func (cp *downloadCheckpoint) Done(index int) error {
+	if err := cp.file.Sync(); err != nil {
+		return err
+	}
+
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	if cp.has(index) {
+		return nil
+	}
+
+	cp.Ranges[index/8] |= 1 << (index % 8)
+	cp.doneSize += cp.rangeLength(index)
+	if cp.progress != nil {
+		cp.progress(cp.doneSize, cp.Size)
+	}
+
+	return cp.save()
+}
+
+func (cp *downloadCheckpoint) has(index int) bool {
+	return index/8 < len(cp.Ranges) && cp.Ranges[index/8]&(1<<(index%8)) != 0
+}
+
+func (cp *downloadCheckpoint) rangeCount() int {
+	return int((cp.Size + cp.RangeSize - 1) / cp.RangeSize)
+}
+
+func (cp *downloadCheckpoint) rangeLength(index int) int64 {
+	start := int64(index) * cp.RangeSize
+	if start+cp.RangeSize > cp.Size {
+		return cp.Size - start
+	}
+	return cp.RangeSize
+}
+
+// save writes the checkpoint to a temporary file and renames it, so it is never half written
+func (cp *downloadCheckpoint) save() error {
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := cp.checkpointPath() + ".tmp"
+	if err = os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cp.checkpointPath())
+}
+
+// commit checks the downloaded file and moves it into place
+func (cp *downloadCheckpoint) commit(fileSize int64, opts *DownloadOptions) error {
+	if err := cp.file.Sync(); err != nil {
+		return err
+	}
+
+	info, err := cp.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if info.Size() != fileSize || cp.doneSize != fileSize {
+		return fmt.Errorf("downloaded %d bytes of %d, file size %d", cp.doneSize, fileSize, info.Size())
+	}
+
+	if opts.VerifyCID {
+		if _, err = cp.file.Seek(0, 0); err != nil {
+			return err
+		}
+
+		root, err := CalculateCidWithOptions(cp.file, opts.ImportOptions)
+		if err != nil {
+			return err
+		}
+
+		if expect, err := cid.Decode(cp.Cid); err != nil || !root.Equals(expect) {
+			// the data is broken, download it again next time
+			cp.close()
+			os.Remove(cp.partPath())
+			os.Remove(cp.checkpointPath())
+			return fmt.Errorf("cid of the downloaded file is %s, expect %s", root.String(), cp.Cid)
+		}
+	}
+
+	cp.close()
+	if err = os.Rename(cp.partPath(), cp.filePath); err != nil {
+		return err
+	}
+	return os.Remove(cp.checkpointPath())
+}
+
+func (cp *downloadCheckpoint) close() {
+	if cp.file != nil {
+		cp.file.Close()
+		cp.file = nil
+	}
+}
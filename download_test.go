@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDownloadToFileResume(t *testing.T) {
+	data := make([]byte, 5*downloadRangeSize+123)
+	rand.New(rand.NewSource(7)).Read(data)
+
+	root, err := CalculateCid(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock    sync.Mutex
+		fetched int
+	)
+	node := newFakeNode(data, func(r *http.Request) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Header.Get("Range") != "bytes=0-1" {
+			fetched++
+		}
+		return true
+	})
+	defer node.Close()
+
+	web := &fakeWebserver{urls: func() []string { return []string{node.URL} }}
+	s := &storage{webAPI: web}
+	filePath := filepath.Join(t.TempDir(), "data.bin")
+
+	// interrupt the first download after 2 ranges
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := &DownloadOptions{Progress: func(doneSize, totalSize int64) {
+		if doneSize >= 2*downloadRangeSize {
+			cancel()
+		}
+	}}
+	if err := s.DownloadToFile(ctx, root.String(), filePath, opts); err == nil {
+		t.Fatal("expect the interrupted download to fail")
+	}
+
+	if _, err := os.Stat(filePath + ".part.json"); err != nil {
+		t.Fatal("checkpoint is not saved, ", err)
+	}
+
+	lock.Lock()
+	fetched = 0
+	lock.Unlock()
+
+	if err := s.DownloadToFile(context.Background(), root.String(), filePath, &DownloadOptions{VerifyCID: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if fetched >= 6 {
+		t.Fatalf("the resumed download fetched all %d ranges again", fetched)
+	}
+
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("downloaded file does not match the data")
+	}
+
+	if _, err := os.Stat(filePath + ".part.json"); !os.IsNotExist(err) {
+		t.Fatal("checkpoint is not removed")
+	}
+}
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// The uploads are encrypted with chunked AES-256-GCM before the car is made or the form is sent.
+// Every upload has its own key derived from the key of the KeyProvider and a random salt.
+//
+//	header: magic "TITANENC" | version 1 | chunk size uint32 | salt [32]byte | key id length uint8 | key id
+//	chunks: the sealed chunks of chunk size, the last one may be shorter or empty
+//
+// The nonce of a chunk is its index, the last byte of the nonce is 1 for the last chunk,
+// so the chunks can not be reordered, dropped or truncated. The header is the additional data of every chunk.
+const (
+	encryptMagic          = "TITANENC"
+	encryptVersion        = 1
+	encryptSaltSize       = 32
+	encryptKeySize        = 32
+	defaultEncryptChunk   = 64 << 10
+	maxEncryptChunk       = 16 << 20
+	encryptKeyDerivedInfo = "titan-storage-sdk chunked aes-256-gcm"
+)
+
+var errEncryptedData = errors.New("encrypted data is broken or truncated")
+
+type encryptKey struct{}
+
+// WithEncryption returns a context which makes the uploads called with it encrypted or not,
+// instead of Config.EncryptUploads
+func WithEncryption(ctx context.Context, encrypt bool) context.Context {
+	return context.WithValue(ctx, encryptKey{}, encrypt)
+}
+
+// encryptUpload returns if the upload called with ctx is encrypted
+func (s *storage) encryptUpload(ctx context.Context) bool {
+	if encrypt, ok := ctx.Value(encryptKey{}).(bool); ok {
+		return encrypt
+	}
+	return s.encrypt
+}
+
+// encrypter seals the data of one upload, the readers it returns produce the same bytes for the same data,
+// so a source can be opened again for a retry or by the concurrent uploads.
+type encrypter struct {
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+}
+
+// newEncrypter returns the encrypter of the upload called with ctx, or nil if it is not encrypted
+func (s *storage) newEncrypter(ctx context.Context) (*encrypter, error) {
+	if !s.encryptUpload(ctx) {
+		return nil, nil
+	}
+
+	if s.keys == nil {
+		return nil, fmt.Errorf("encryption requires a KeyProvider")
+	}
+
+	keyID, key, err := s.keys.EncryptionKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("key id %s is longer than 255 bytes", keyID)
+	}
+
+	salt := make([]byte, encryptSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	header := &bytes.Buffer{}
+	header.WriteString(encryptMagic)
+	header.WriteByte(encryptVersion)
+	binary.Write(header, binary.BigEndian, uint32(defaultEncryptChunk))
+	header.Write(salt)
+	header.WriteByte(byte(len(keyID)))
+	header.WriteString(keyID)
+
+	aead, err := newChunkAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encrypter{aead: aead, header: header.Bytes(), chunkSize: defaultEncryptChunk}, nil
+}
+
+// newChunkAEAD returns the cipher of the file with salt
+func newChunkAEAD(key, salt []byte) (cipher.AEAD, error) {
+	if len(key) != encryptKeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptKeySize, len(key))
+	}
+
+	fileKey := make([]byte, encryptKeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(encryptKeyDerivedInfo)), fileKey); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(nonce []byte, index uint64, last bool) []byte {
+	clear(nonce)
+	binary.BigEndian.PutUint64(nonce[len(nonce)-9:], index)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// reader returns the encrypted data of r
+func (e *encrypter) reader(r io.Reader) io.Reader {
+	return &encryptReader{
+		e:     e,
+		r:     bufio.NewReader(r),
+		plain: make([]byte, e.chunkSize),
+		nonce: make([]byte, e.aead.NonceSize()),
+		out:   e.header,
+	}
+}
+
+// source returns a SourceFunc which opens the encrypted data of open
+func (e *encrypter) source(open SourceFunc) SourceFunc {
+	return func() (io.ReadCloser, error) {
+		r, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{Reader: e.reader(r), Closer: r}, nil
+	}
+}
+
+type encryptReader struct {
+	e     *encrypter
+	r     *bufio.Reader
+	plain []byte
+	nonce []byte
+	index uint64
+	// sealed is the buffer of the chunks, out is the part not read yet
+	sealed []byte
+	out    []byte
+	done   bool
+}
+
+func (er *encryptReader) Read(p []byte) (int, error) {
+	for len(er.out) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.seal(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, er.out)
+	er.out = er.out[n:]
+	return n, nil
+}
+
+// seal encrypts the next chunk
+func (er *encryptReader) seal() error {
+	n, err := io.ReadFull(er.r, er.plain)
+	switch err {
+	case nil:
+		// the chunk is the last one if nothing follows it
+		if _, err = er.r.Peek(1); err == io.EOF {
+			er.done = true
+		} else if err != nil {
+			return err
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		er.done = true
+	default:
+		return err
+	}
+
+	er.sealed = er.e.aead.Seal(er.sealed[:0], chunkNonce(er.nonce, er.index, er.done), er.plain[:n], er.e.header)
+	er.out = er.sealed
+	er.index++
+	return nil
+}
+
+// decryptReader opens the chunks sealed by encryptReader
+type decryptReader struct {
+	r         *bufio.Reader
+	aead      cipher.AEAD
+	header    []byte
+	chunkSize int
+	sealed    []byte
+	nonce     []byte
+	index     uint64
+	out       []byte
+	done      bool
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.out) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, dr.out)
+	dr.out = dr.out[n:]
+	return n, nil
+}
+
+// open decrypts the next chunk
+func (dr *decryptReader) open() error {
+	n, err := io.ReadFull(dr.r, dr.sealed)
+	switch err {
+	case nil:
+		if _, err = dr.r.Peek(1); err == io.EOF {
+			dr.done = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		dr.done = true
+	case io.EOF:
+		// the last chunk is never empty, it has a tag at least
+		return errEncryptedData
+	default:
+		return err
+	}
+
+	out, err := dr.aead.Open(dr.sealed[:0], chunkNonce(dr.nonce, dr.index, dr.done), dr.sealed[:n], dr.header)
+	if err != nil {
+		return fmt.Errorf("decrypt chunk %d failed: %w", dr.index, errEncryptedData)
+	}
+
+	dr.out = out
+	dr.index++
+	return nil
+}
+
+// readHeader reads the header of the encrypted data, ok is false if r is not encrypted
+func readHeader(r *bufio.Reader) (header []byte, chunkSize int, salt []byte, keyID string, ok bool, err error) {
+	prefix, err := r.Peek(len(encryptMagic) + 1 + 4 + encryptSaltSize + 1)
+	if err != nil || string(prefix[:len(encryptMagic)]) != encryptMagic {
+		// too short or not encrypted
+		return nil, 0, nil, "", false, nil
+	}
+
+	if version := prefix[len(encryptMagic)]; version != encryptVersion {
+		return nil, 0, nil, "", false, fmt.Errorf("unsupported encryption version %d", version)
+	}
+
+	chunkSize = int(binary.BigEndian.Uint32(prefix[len(encryptMagic)+1:]))
+	if chunkSize <= 0 || chunkSize > maxEncryptChunk {
+		return nil, 0, nil, "", false, fmt.Errorf("invalid encryption chunk size %d", chunkSize)
+	}
+
+	keyIDLen := int(prefix[len(prefix)-1])
+	header = make([]byte, len(prefix)+keyIDLen)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return nil, 0, nil, "", false, errEncryptedData
+	}
+
+	salt = header[len(encryptMagic)+1+4 : len(encryptMagic)+1+4+encryptSaltSize]
+	return header, chunkSize, salt, string(header[len(prefix):]), true, nil
+}
+
+// decrypt returns the decrypted data of r if it is encrypted and the key is available, otherwise the data as it is
+func (s *storage) decrypt(ctx context.Context, r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if s.keys == nil {
+		return br, nil
+	}
+
+	header, chunkSize, salt, keyID, ok, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return br, nil
+	}
+
+	key, err := s.keys.DecryptionKey(ctx, keyID)
+	if err != nil {
+		if errors.Is(err, ErrKeyNotFound) {
+			log.Printf("key %s of the encrypted data is not found, return the data as it is", keyID)
+			return io.MultiReader(bytes.NewReader(header), br), nil
+		}
+		return nil, err
+	}
+
+	aead, err := newChunkAEAD(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:         br,
+		aead:      aead,
+		header:    header,
+		chunkSize: chunkSize,
+		sealed:    make([]byte, chunkSize+aead.Overhead()),
+		nonce:     make([]byte, aead.NonceSize()),
+	}, nil
+}
+
+// decryptReadCloser is decrypt of an io.ReadCloser
+func (s *storage) decryptReadCloser(ctx context.Context, rc io.ReadCloser) (io.ReadCloser, error) {
+	if s.keys == nil {
+		return rc, nil
+	}
+
+	r, err := s.decrypt(ctx, rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return &readCloser{Reader: r, Closer: rc}, nil
+}
+
+// decryptFile decrypts the file at filePath in place if it is encrypted and the key is available
+func (s *storage) decryptFile(ctx context.Context, filePath string) error {
+	if s.keys == nil {
+		return nil
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := s.decrypt(ctx, f)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.(*decryptReader); !ok {
+		return nil
+	}
+
+	tmp := filePath + ".decrypt"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(out, r); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err = out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, filePath)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
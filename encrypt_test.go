@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	keys, err := NewPassphraseKeyProvider("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &storage{keys: keys, encrypt: true}
+
+	for _, size := range []int{0, 1, defaultEncryptChunk, defaultEncryptChunk + 1, 3*defaultEncryptChunk + 17} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(int64(size))).Read(data)
+
+		enc, err := s.newEncrypter(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sealed, err := io.ReadAll(enc.reader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the same encrypter seals the same bytes again, so the uploads can be retried
+		again, _ := io.ReadAll(enc.reader(bytes.NewReader(data)))
+		if !bytes.Equal(sealed, again) {
+			t.Fatalf("size %d: the encrypted data changes", size)
+		}
+
+		r, err := s.decrypt(context.Background(), bytes.NewReader(sealed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(plain, data) {
+			t.Fatalf("size %d: decrypted data does not match", size)
+		}
+
+		// flipped, truncated or extended data fails
+		broken := [][]byte{
+			append(append([]byte{}, sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1),
+			sealed[:len(sealed)-1],
+			append(append([]byte{}, sealed...), 0),
+		}
+		if size > defaultEncryptChunk {
+			// the first chunk alone
+			broken = append(broken, sealed[:len(enc.header)+defaultEncryptChunk+16])
+		}
+		for i, b := range broken {
+			r, err := s.decrypt(context.Background(), bytes.NewReader(b))
+			if err == nil {
+				_, err = io.ReadAll(r)
+			}
+			if err == nil {
+				t.Fatalf("size %d: broken data %d is decrypted", size, i)
+			}
+		}
+	}
+
+	// another provider of the passphrase has its own salt and decrypts the data of the first one
+	same, _ := NewPassphraseKeyProvider("secret")
+	id, _, _ := keys.EncryptionKey(context.Background())
+	sameID, _, _ := same.EncryptionKey(context.Background())
+	if id == sameID || !strings.HasPrefix(id, passphraseKeyPrefix) {
+		t.Fatalf("the key ids %s and %s are not random", id, sameID)
+	}
+	enc, _ := (&storage{keys: same, encrypt: true}).newEncrypter(context.Background())
+	sealed, _ := io.ReadAll(enc.reader(strings.NewReader("hello")))
+	r, err := s.decrypt(context.Background(), bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(r); err != nil || string(b) != "hello" {
+		t.Fatalf("decrypt with the same passphrase returns %q, %v", b, err)
+	}
+
+	// another passphrase fails
+	other, _ := NewPassphraseKeyProvider("other")
+	r, err = (&storage{keys: other}).decrypt(context.Background(), bytes.NewReader(sealed))
+	if err == nil {
+		_, err = io.ReadAll(r)
+	}
+	if !errors.Is(err, errEncryptedData) {
+		t.Fatalf("decrypt with another passphrase returns %v", err)
+	}
+
+	// the data of an unknown key is returned as it is
+	keyring, err := NewKeyring(filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = (&storage{keys: keyring}).decrypt(context.Background(), bytes.NewReader(sealed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(r); !bytes.Equal(b, sealed) {
+		t.Fatal("the data of an unknown key is changed")
+	}
+}
+
+func TestOpenEncryptedAsset(t *testing.T) {
+	keys, _ := NewPassphraseKeyProvider("secret")
+	enc, _ := (&storage{keys: keys, encrypt: true}).newEncrypter(context.Background())
+	sealed, _ := io.ReadAll(enc.reader(strings.NewReader("hello")))
+
+	node := newFakeNode(sealed, nil)
+	defer node.Close()
+
+	s := &storage{webAPI: &fakeWebserver{urls: func() []string { return []string{node.URL} }}, keys: keys}
+	if _, err := s.OpenAsset(context.Background(), "cid"); !errors.Is(err, ErrEncryptedAsset) {
+		t.Fatalf("open an encrypted asset returns %v", err)
+	}
+}
+
+func TestEncryptedUpload(t *testing.T) {
+	data := make([]byte, 200<<10)
+	rand.New(rand.NewSource(8)).Read(data)
+
+	var (
+		lock     sync.Mutex
+		received [][]byte
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+
+		lock.Lock()
+		received = append(received, b)
+		lock.Unlock()
+
+		root, _ := CalculateCid(bytes.NewReader(b))
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: root.String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return nil },
+		nodes: func() []*client.NodeUploadInfo {
+			return []*client.NodeUploadInfo{{UploadURL: node.URL, NodeID: "n1"}, {UploadURL: node.URL, NodeID: "n2"}}
+		},
+	}
+
+	keyringPath := filepath.Join(t.TempDir(), "keyring.json")
+	keys, err := NewKeyring(keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &storage{webAPI: web, keys: keys, encrypt: true}
+
+	ctx := WithUploadStrategy(context.Background(), UploadFanOut)
+	root, err := s.UploadStreamV2(ctx, io.MultiReader(bytes.NewReader(data)), "data.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 2 || !bytes.Equal(received[0], received[1]) {
+		t.Fatal("the nodes received different data")
+	}
+	sealed := received[0]
+	if !bytes.HasPrefix(sealed, []byte(encryptMagic)) || bytes.Contains(sealed, data[:1024]) {
+		t.Fatal("the uploaded data is not encrypted")
+	}
+	if len(web.created) != 1 || !web.created[0].Encrypted {
+		t.Fatal("the asset is not created as encrypted")
+	}
+
+	// the rotated keyring still decrypts the asset after it is loaded again
+	if _, err = keys.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if keys, err = NewKeyring(keyringPath); err != nil {
+		t.Fatal(err)
+	}
+	s.keys = keys
+
+	served := newFakeNode(sealed, nil)
+	defer served.Close()
+	web.urls = func() []string { return []string{served.URL} }
+
+	filePath := filepath.Join(t.TempDir(), "data.bin")
+	if err = s.DownloadToFile(context.Background(), root.String(), filePath, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("downloaded file is not decrypted")
+	}
+
+	// the data pulled by a node can not be encrypted
+	if _, err = s.SubmitURLUpload(context.Background(), "https://example.com/file.bin"); err == nil {
+		t.Fatal("expect the encrypted url upload to fail")
+	}
+}
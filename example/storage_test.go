@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -114,9 +115,9 @@ func ExampleStorage_GetItemDetails() {
 
 // ExampleStorage_CreateSharedLink Share file/folder data
 func ExampleStorage_CreateSharedLink() {
-	shareLink, err := ts.CreateSharedLink(ctx, "bafkreib5arnexhnsn6etb4xs7ywm52iey3i7xkxgjxm4dhw5njxmz2dn4i", 123)
+	shareLink, err := ts.CreateSharedLink(ctx, "bafkreib5arnexhnsn6etb4xs7ywm52iey3i7xkxgjxm4dhw5njxmz2dn4i", 0)
 	if err != nil {
-		fmt.Printf("GetItemDetails Error:%v", err)
+		fmt.Printf("CreateSharedLink Error:%v", err)
 		return
 	}
 
@@ -145,6 +146,30 @@ func ExampleStorage_UploadAsset() {
 	fmt.Println(cid.String())
 }
 
+// ExampleStorage_Upload Upload a file, folder, reader, bytes or url with options
+func ExampleStorage_Upload() {
+	res, err := ts.Upload(ctx, storage.PathSource("test.png"),
+		storage.UploadFolderID(0),
+		storage.UploadShareURL(),
+		storage.UploadRetries(2),
+		storage.UploadProgress(func(doneSize, totalSize int64) {
+			fmt.Println(totalSize, doneSize)
+		}),
+	)
+	if err != nil {
+		var uploadErr *storage.UploadError
+		if errors.As(err, &uploadErr) {
+			for _, attempt := range uploadErr.Attempts {
+				fmt.Println(attempt.NodeID, attempt.Err)
+			}
+		}
+		fmt.Printf("Upload error:%v", err)
+		return
+	}
+
+	fmt.Println(res.CID.String(), res.NodeID, res.Size, res.Elapsed, res.URL)
+}
+
 // ExampleStorage_DownloadAsset Download files/folders
 func ExampleStorage_DownloadAsset() {
 	body, name, err := ts.DownloadAsset(ctx, "bafkreib5arnexhnsn6etb4xs7ywm52iey3i7xkxgjxm4dhw5njxmz2dn4i")
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+// fakeWebserver is an in-memory client.Webserver for tests,
+// the methods not overridden here panic if called.
+type fakeWebserver struct {
+	client.Webserver
+
+	lock      sync.Mutex
+	endpoints func() []*client.Endpoint
+	nodes     func() []*client.NodeUploadInfo
+	urls      func() []string
+	created   []client.CreateAssetReq
+	reports   []client.AssetTransferReq
+	groups    []*client.AssetGroup
+	moved     [][2]int
+	// assets are the stored cids in the folders of assetFolders, 0 by default,
+	// uploadExists is the AlreadyExists of GetNodeUploadInfo
+	assets       []string
+	assetFolders map[string]int
+	assetNames   map[string]string
+	assetSizes   map[string]int64
+	uploadExists bool
+	// assetURLs returns the share urls of an asset instead of urls if it is set
+	assetURLs func(cid string) []string
+	// calls counts the calls of the methods by name
+	calls map[string]int
+}
+
+func (f *fakeWebserver) CreateAsset(ctx context.Context, req *client.CreateAssetReq) (*client.CreateAssetRsp, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.created = append(f.created, *req)
+	eps := f.endpoints()
+	return &client.CreateAssetRsp{IsAlreadyExist: len(eps) == 0, Endpoints: eps}, nil
+}
+
+func (f *fakeWebserver) AssetTransferReport(ctx context.Context, req client.AssetTransferReq) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.reports = append(f.reports, req)
+	return nil
+}
+
+func (f *fakeWebserver) GetNodeUploadInfo(ctx context.Context, userID, area string, urlMode, encrypted bool) (*client.UploadInfo, error) {
+	return &client.UploadInfo{List: f.nodes(), AlreadyExists: f.uploadExists}, nil
+}
+
+func (f *fakeWebserver) ListAssets(ctx context.Context, parent, pageSize, page int, cid string, folderID int) (*client.ListAssetRecordRsp, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var overviews []*client.AssetOverview
+	for _, asset := range f.assets {
+		name := asset
+		if len(f.assetNames[asset]) > 0 {
+			name = f.assetNames[asset]
+		}
+
+		if (cid == "" && f.assetFolders[asset] == parent) || cid == asset {
+			overviews = append(overviews, &client.AssetOverview{
+				AssetRecord:     &client.AssetRecord{CID: asset},
+				UserAssetDetail: &client.UserAssetDetail{AssetName: name, TotalSize: f.assetSizes[asset]},
+			})
+		}
+	}
+
+	rsp := &client.ListAssetRecordRsp{Total: len(overviews), AssetOverviews: overviews}
+	if pageSize > 0 {
+		rsp.AssetOverviews = nil
+		if start := (page - 1) * pageSize; start < len(overviews) {
+			rsp.AssetOverviews = overviews[start:min(start+pageSize, len(overviews))]
+		}
+	}
+	return rsp, nil
+}
+
+func (f *fakeWebserver) ShareAsset(ctx context.Context, userID, areaID, assetCID string) (*client.ShareAssetResult, error) {
+	if f.assetURLs != nil {
+		return &client.ShareAssetResult{AssetCID: assetCID, URLs: f.assetURLs(assetCID)}, nil
+	}
+	return &client.ShareAssetResult{AssetCID: assetCID, URLs: f.urls()}, nil
+}
+
+// newFakeNode returns a L1 node which serves data by ranges,
+// get is called before every range request and the request fails if it returns false.
+func newFakeNode(data []byte, get func(r *http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			// titan.Version
+			w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":"1"}`))
+			return
+		}
+
+		if get != nil && !get(r) {
+			http.Error(w, "node busy", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func (f *fakeWebserver) ListGroups(ctx context.Context, parent, pageSize, page int) (*client.ListAssetGroupRsp, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.count("ListGroups")
+
+	var children []*client.AssetGroup
+	for _, g := range f.groups {
+		if g.Parent == parent {
+			children = append(children, g)
+		}
+	}
+
+	rsp := &client.ListAssetGroupRsp{Total: len(children)}
+	if start := (page - 1) * pageSize; start < len(children) {
+		end := min(start+pageSize, len(children))
+		rsp.AssetGroups = children[start:end]
+	}
+	return rsp, nil
+}
+
+func (f *fakeWebserver) CreateGroup(ctx context.Context, name string, parent int) (*client.AssetGroup, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	id := 1
+	for _, g := range f.groups {
+		id = max(id, g.ID+1)
+	}
+
+	group := &client.AssetGroup{ID: id, Name: name, Parent: parent}
+	f.groups = append(f.groups, group)
+	return group, nil
+}
+
+func (f *fakeWebserver) MoveAssetGroup(ctx context.Context, groupID, targetGroupID int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, g := range f.groups {
+		if g.ID == groupID {
+			g.Parent = targetGroupID
+		}
+	}
+	f.moved = append(f.moved, [2]int{groupID, targetGroupID})
+	return nil
+}
+
+// count counts the call of method, f.lock must be held
+func (f *fakeWebserver) count(method string) {
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[method]++
+}
+
+func (f *fakeWebserver) RenameGroup(ctx context.Context, newName string, groupID int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, g := range f.groups {
+		if g.ID == groupID {
+			g.Name = newName
+		}
+	}
+	return nil
+}
+
+func (f *fakeWebserver) DeleteGroup(ctx context.Context, userID string, groupID int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, g := range f.groups {
+		if g.ID == groupID {
+			f.groups = append(f.groups[:i], f.groups[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeWebserver) RenameAsset(ctx context.Context, assetCID string, newName string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.assetNames == nil {
+		f.assetNames = make(map[string]string)
+	}
+	f.assetNames[assetCID] = newName
+	return nil
+}
+
+func (f *fakeWebserver) MoveAssetToGroup(ctx context.Context, cid string, groupID int) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.assetFolders == nil {
+		f.assetFolders = make(map[string]int)
+	}
+	f.assetFolders[cid] = groupID
+	return nil
+}
+
+func (f *fakeWebserver) DeleteAsset(ctx context.Context, userID, assetCID string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for i, asset := range f.assets {
+		if asset == assetCID {
+			f.assets = append(f.assets[:i], f.assets[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+// ErrFolderNotFound is returned if a folder of a folder path does not exist
+var ErrFolderNotFound = errors.New("folder not found")
+
+// folderCacheTTL is how long the subfolders of a folder are cached,
+// the cache is dropped once this process changes a folder.
+var folderCacheTTL = time.Minute
+
+// folderCache caches the group tree by the subfolders of every folder
+type folderCache struct {
+	lock    sync.Mutex
+	entries map[int]*cachedFolders
+}
+
+type cachedFolders struct {
+	groups []*client.AssetGroup
+	expire time.Time
+}
+
+func (c *folderCache) get(parent int) ([]*client.AssetGroup, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, ok := c.entries[parent]
+	if !ok || time.Now().After(entry.expire) {
+		return nil, false
+	}
+	return entry.groups, true
+}
+
+func (c *folderCache) put(parent int, groups []*client.AssetGroup) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[int]*cachedFolders)
+	}
+	c.entries[parent] = &cachedFolders{groups: groups, expire: time.Now().Add(folderCacheTTL)}
+}
+
+// reset drops the cache, it is called after every change of the folders
+func (c *folderCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = nil
+}
+
+// subfolders returns the subfolders of parent from the cache, they are listed if they are not cached
+func (s *storage) subfolders(ctx context.Context, parent int) ([]*client.AssetGroup, error) {
+	if groups, ok := s.folders.get(parent); ok {
+		return groups, nil
+	}
+
+	it := s.IterFolders(ctx, parent, nil)
+	defer it.Close()
+
+	var groups []*client.AssetGroup
+	for it.Next() {
+		groups = append(groups, it.Value())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	s.folders.put(parent, groups)
+	return groups, nil
+}
+
+type folderKey struct{}
+
+// folderTarget is the folder of an upload, by id or by path
+type folderTarget struct {
+	id     int
+	path   string
+	create bool
+	byPath bool
+}
+
+// WithFolderID returns a context which makes the uploads called with it go into the folder
+// instead of Config.GroupID, 0 is the root folder
+func WithFolderID(ctx context.Context, folderID int) context.Context {
+	return context.WithValue(ctx, folderKey{}, folderTarget{id: folderID})
+}
+
+// WithFolderPath returns a context which makes the uploads called with it go into the folder at folderPath
+// instead of Config.GroupID, e.g. /invoices/2026/10, the missing folders are created if create is true.
+func WithFolderPath(ctx context.Context, folderPath string, create bool) context.Context {
+	return context.WithValue(ctx, folderKey{}, folderTarget{path: folderPath, create: create, byPath: true})
+}
+
+// uploadGroup returns the folder of the upload called with ctx, the folder path is resolved
+func (s *storage) uploadGroup(ctx context.Context) (int, error) {
+	target, ok := ctx.Value(folderKey{}).(folderTarget)
+	if !ok {
+		return s.groupID, nil
+	}
+
+	if !target.byPath {
+		return target.id, nil
+	}
+	return s.ResolveFolder(ctx, target.path, target.create)
+}
+
+// splitFolderPath returns the names of the folders in folderPath, it is empty for the root folder
+func splitFolderPath(folderPath string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(folderPath, "/") {
+		switch name {
+		case "":
+		case ".", "..":
+			return nil, fmt.Errorf("invalid folder path %s", folderPath)
+		default:
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// ResolveFolder returns the id of the folder at folderPath, e.g. /invoices/2026/10, "/" is the root folder 0.
+// The missing folders are created if create is true, otherwise ErrFolderNotFound is returned.
+func (s *storage) ResolveFolder(ctx context.Context, folderPath string, create bool) (int, error) {
+	names, err := splitFolderPath(folderPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// the folders are created one by one, so the concurrent uploads don't create the same folder twice
+	if create {
+		s.folderLock.Lock()
+		defer s.folderLock.Unlock()
+	}
+
+	parent := 0
+	for i, name := range names {
+		id, found, err := s.findFolder(ctx, parent, name)
+		if err == nil && !found && create {
+			// the folder may be created by another process after it was cached
+			s.folders.reset()
+			id, found, err = s.findFolder(ctx, parent, name)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		if !found {
+			if !create {
+				return 0, fmt.Errorf("%s: %w", "/"+strings.Join(names[:i+1], "/"), ErrFolderNotFound)
+			}
+
+			group, err := s.webAPI.CreateGroup(ctx, name, parent)
+			s.folders.reset()
+			if err != nil {
+				return 0, fmt.Errorf("create folder %s failed: %w", name, err)
+			}
+			id = group.ID
+		}
+
+		parent = id
+	}
+
+	return parent, nil
+}
+
+// findFolder returns the id of the folder name in parent
+func (s *storage) findFolder(ctx context.Context, parent int, name string) (int, bool, error) {
+	group, err := s.findGroup(ctx, parent, name)
+	if err != nil || group == nil {
+		return 0, false, err
+	}
+	return group.ID, true, nil
+}
+
+// findGroup returns the folder name in parent, or nil if it does not exist
+func (s *storage) findGroup(ctx context.Context, parent int, name string) (*client.AssetGroup, error) {
+	groups, err := s.subfolders(ctx, parent)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, group := range groups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestMoveFolder(t *testing.T) {
+	// 1 -> 2 -> 3, 4
+	web := &fakeWebserver{groups: []*client.AssetGroup{
+		{ID: 1, Parent: 0}, {ID: 2, Parent: 1}, {ID: 3, Parent: 2}, {ID: 4, Parent: 0},
+	}}
+	s := &storage{webAPI: web}
+
+	for _, target := range []int{1, 2, 3} {
+		if err := s.MoveFolder(context.Background(), 1, target); err == nil {
+			t.Fatalf("expect moving folder 1 into %d to fail", target)
+		}
+	}
+	if len(web.moved) != 0 {
+		t.Fatal("the refused moves are sent")
+	}
+
+	if err := s.MoveFolder(context.Background(), 2, 4); err != nil {
+		t.Fatal(err)
+	}
+	// 2 is no longer under 1
+	if err := s.MoveFolder(context.Background(), 1, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(web.moved) != 2 || web.moved[0] != [2]int{2, 4} || web.moved[1] != [2]int{1, 3} {
+		t.Fatalf("unexpected moves %v", web.moved)
+	}
+}
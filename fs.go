@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+// FolderFS is a read-only fs.FS of a folder in the titan storage, the folders are the directories
+// and the assets are the files. The files are read by ranges, so they can seek and read at any offset.
+// The assets are read as they are stored, the encrypted assets are not decrypted.
+type FolderFS struct {
+	s    *storage
+	ctx  context.Context
+	root int
+
+	// shares caches the share urls of the assets opened
+	lock   sync.Mutex
+	shares map[string]*cachedShare
+}
+
+// shareCacheTTL is how long the share urls of an asset are cached, they carry tokens which expire
+var shareCacheTTL = 5 * time.Minute
+
+type cachedShare struct {
+	res    *client.ShareAssetResult
+	expire time.Time
+}
+
+var (
+	_ fs.FS         = (*FolderFS)(nil)
+	_ fs.ReadDirFS  = (*FolderFS)(nil)
+	_ fs.StatFS     = (*FolderFS)(nil)
+	_ fs.ReadFileFS = (*FolderFS)(nil)
+)
+
+// FS returns a fs.FS of the folder rootFolderID, 0 is the root folder. ctx is used by all calls of the FS.
+func (s *storage) FS(ctx context.Context, rootFolderID int) *FolderFS {
+	return &FolderFS{s: s, ctx: ctx, root: rootFolderID, shares: make(map[string]*cachedShare)}
+}
+
+// lookup returns the entry of name, it is a path of fs.FS
+func (fsys *FolderFS) lookup(op, name string) (*PathEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	// "." is the root folder, the other names have no leading slash
+	p := name
+	if p == "." {
+		p = ""
+	}
+
+	entry, err := fsys.s.lookupIn(fsys.ctx, fsys.root, p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return entry, nil
+}
+
+// Open opens the folder or asset name
+func (fsys *FolderFS) Open(name string) (fs.File, error) {
+	entry, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &pathInfo{entry: entry, name: path.Base(name)}
+	if entry.IsFolder() {
+		return &dirFile{fsys: fsys, path: name, entry: entry, info: info}, nil
+	}
+	return &assetFile{fsys: fsys, path: name, entry: entry, info: info}, nil
+}
+
+// Stat returns the fs.FileInfo of the folder or asset name, its Sys is the *PathEntry
+func (fsys *FolderFS) Stat(name string) (fs.FileInfo, error) {
+	entry, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return &pathInfo{entry: entry, name: path.Base(name)}, nil
+}
+
+// ReadDir returns the entries of the folder name sorted by name
+func (fsys *FolderFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.IsFolder() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	entries, err := fsys.readDir(entry)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	return entries, nil
+}
+
+func (fsys *FolderFS) readDir(dir *PathEntry) ([]fs.DirEntry, error) {
+	entries, err := fsys.s.readDir(fsys.ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	dirEntries := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		dirEntries = append(dirEntries, fs.FileInfoToDirEntry(&pathInfo{entry: entry, name: entry.Name()}))
+	}
+
+	sort.Slice(dirEntries, func(i, j int) bool {
+		return dirEntries[i].Name() < dirEntries[j].Name()
+	})
+	return dirEntries, nil
+}
+
+// ReadFile returns the content of the asset name
+func (fsys *FolderFS) ReadFile(name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	af, ok := f.(*assetFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+
+	r, err := af.reader()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, r.Size())
+	if _, err = io.ReadFull(io.NewSectionReader(r, 0, r.Size()), data); err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+// share returns the share urls of the asset, they are cached to open the asset again without waiting,
+// cached is true if they are returned from the cache
+func (fsys *FolderFS) share(assetCID string) (res *client.ShareAssetResult, cached bool, err error) {
+	fsys.lock.Lock()
+	entry, ok := fsys.shares[assetCID]
+	fsys.lock.Unlock()
+	if ok && time.Now().Before(entry.expire) {
+		return entry.res, true, nil
+	}
+
+	res, err = fsys.s.GetURL(fsys.ctx, assetCID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fsys.lock.Lock()
+	fsys.shares[assetCID] = &cachedShare{res: res, expire: time.Now().Add(shareCacheTTL)}
+	fsys.lock.Unlock()
+
+	return res, false, nil
+}
+
+// forgetShare drops the cached share urls of the asset, e.g. their tokens are expired
+func (fsys *FolderFS) forgetShare(assetCID string) {
+	fsys.lock.Lock()
+	delete(fsys.shares, assetCID)
+	fsys.lock.Unlock()
+}
+
+// pathInfo is the fs.FileInfo of a PathEntry
+type pathInfo struct {
+	entry *PathEntry
+	name  string
+}
+
+func (fi *pathInfo) Name() string {
+	return fi.name
+}
+
+func (fi *pathInfo) Size() int64 {
+	if fi.entry.IsFolder() {
+		return 0
+	}
+	return fi.entry.Size()
+}
+
+func (fi *pathInfo) Mode() fs.FileMode {
+	if fi.entry.IsFolder() {
+		return fs.ModeDir | 0o555
+	}
+	return 0o444
+}
+
+func (fi *pathInfo) ModTime() time.Time {
+	return fi.entry.ModTime()
+}
+
+func (fi *pathInfo) IsDir() bool {
+	return fi.entry.IsFolder()
+}
+
+func (fi *pathInfo) Sys() interface{} {
+	return fi.entry
+}
+
+// dirFile is an opened folder
+type dirFile struct {
+	fsys    *FolderFS
+	path    string
+	entry   *PathEntry
+	info    *pathInfo
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.fsys.readDir(d.entry)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.path, Err: err}
+		}
+		d.entries, d.loaded = entries, true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// assetFile is an opened asset, it is downloaded by ranges once it is read
+type assetFile struct {
+	fsys  *FolderFS
+	path  string
+	entry *PathEntry
+	info  *pathInfo
+	r     AssetReader
+}
+
+func (f *assetFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// reader returns the reader of the asset, the asset is opened by the first call
+func (f *assetFile) reader() (AssetReader, error) {
+	if f.r != nil {
+		return f.r, nil
+	}
+
+	// an empty asset can not be read by ranges
+	if f.entry.Size() == 0 {
+		f.r = emptyAsset{bytes.NewReader(nil)}
+		return f.r, nil
+	}
+
+	res, cached, err := f.fsys.share(f.entry.CID())
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: f.path, Err: err}
+	}
+
+	r, err := f.fsys.s.openAsset(f.fsys.ctx, f.entry.CID(), res)
+	if err != nil && cached && !errors.Is(err, ErrEncryptedAsset) {
+		// the cached urls may be expired, open the asset with new ones
+		f.fsys.forgetShare(f.entry.CID())
+		if res, _, err = f.fsys.share(f.entry.CID()); err == nil {
+			r, err = f.fsys.s.openAsset(f.fsys.ctx, f.entry.CID(), res)
+		}
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: f.path, Err: err}
+	}
+
+	f.r = r
+	return r, nil
+}
+
+func (f *assetFile) Read(p []byte) (int, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, err
+	}
+	return r.Read(p)
+}
+
+// ReadAt implements io.ReaderAt
+func (f *assetFile) ReadAt(p []byte, off int64) (int, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, err
+	}
+	return r.ReadAt(p, off)
+}
+
+// Seek implements io.Seeker
+func (f *assetFile) Seek(offset int64, whence int) (int64, error) {
+	r, err := f.reader()
+	if err != nil {
+		return 0, err
+	}
+	return r.Seek(offset, whence)
+}
+
+func (f *assetFile) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	return f.r.Close()
+}
+
+// emptyAsset is the AssetReader of an empty asset
+type emptyAsset struct {
+	*bytes.Reader
+}
+
+func (emptyAsset) Close() error {
+	return nil
+}
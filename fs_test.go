@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestFS(t *testing.T) {
+	data := map[string][]byte{"c1": make([]byte, 3000), "c2": []byte("hello titan"), "c3": nil}
+	rand.New(rand.NewSource(7)).Read(data["c1"])
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":"1"}`))
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data[strings.TrimPrefix(r.URL.Path, "/")]))
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		groups:       []*client.AssetGroup{{ID: 1, Name: "photos"}, {ID: 2, Name: "2026", Parent: 1}},
+		assets:       []string{"c1", "c2", "c3"},
+		assetFolders: map[string]int{"c1": 2, "c2": 1},
+		assetNames:   map[string]string{"c1": "a.jpg", "c2": "b.txt", "c3": "empty.txt"},
+		assetSizes:   map[string]int64{"c1": int64(len(data["c1"])), "c2": int64(len(data["c2"]))},
+		assetURLs:    func(cid string) []string { return []string{node.URL + "/" + cid} },
+	}
+	s := &storage{webAPI: web}
+	fsys := s.FS(context.Background(), 0)
+
+	if err := fstest.TestFS(fsys, "photos/2026/a.jpg", "photos/b.txt", "empty.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := fs.ReadFile(fsys, "photos/b.txt")
+	if err != nil || string(buf) != "hello titan" {
+		t.Fatalf("read %q, error %v", buf, err)
+	}
+
+	// the file seeks by ranges
+	f, err := fsys.Open("photos/2026/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	off := int64(2345)
+	if _, err = f.(io.Seeker).Seek(off, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	buf = make([]byte, 100)
+	if _, err = io.ReadFull(f, buf); err != nil || !bytes.Equal(buf, data["c1"][off:off+100]) {
+		t.Fatalf("read wrong data after seek, error %v", err)
+	}
+
+	// the root of the FS is a folder
+	sub, err := fs.ReadDir(s.FS(context.Background(), 1), ".")
+	if err != nil || len(sub) != 2 || sub[0].Name() != "2026" || !sub[0].IsDir() || sub[1].Name() != "b.txt" {
+		t.Fatalf("unexpected entries %v, error %v", sub, err)
+	}
+
+	if _, err = fsys.Open("/photos"); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("expect invalid, got %v", err)
+	}
+	if _, err = fsys.Stat("photos/none"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expect not exist, got %v", err)
+	}
+}
+
+func TestFSCarAsset(t *testing.T) {
+	data := make([]byte, 600<<10)
+	rand.New(rand.NewSource(11)).Read(data)
+
+	src := filepath.Join(t.TempDir(), "a.bin")
+	if err := os.WriteFile(src, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the server records the size of the car, the node serves the content
+	plan, err := planCar(pathWalker(context.Background(), src, &ImportOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.size <= int64(len(data)) {
+		t.Fatalf("car size %d is not larger than the content", plan.size)
+	}
+
+	var (
+		lock  sync.Mutex
+		sizes int
+	)
+	node := newFakeNode(data, func(r *http.Request) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.Header.Get("Range") == "bytes=0-1" {
+			sizes++
+		}
+		return true
+	})
+	defer node.Close()
+
+	web := &fakeWebserver{
+		assets:     []string{plan.root.String()},
+		assetNames: map[string]string{plan.root.String(): "a.bin"},
+		assetSizes: map[string]int64{plan.root.String(): plan.size},
+		urls:       func() []string { return []string{node.URL} },
+	}
+	s := &storage{webAPI: web}
+	fsys := s.FS(context.Background(), 0)
+
+	if err := fstest.TestFS(fsys, "a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	lock.Lock()
+	sizes = 0
+	lock.Unlock()
+
+	info, err := fs.Stat(fsys, "a.bin")
+	if err != nil || info.Size() != int64(len(data)) {
+		t.Fatalf("unexpected info %v, error %v", info, err)
+	}
+
+	entries, err := s.ReadDir(context.Background(), "/")
+	if err != nil || len(entries) != 1 || entries[0].Size() != int64(len(data)) {
+		t.Fatalf("unexpected entries %v, error %v", entries, err)
+	}
+
+	// the size is cached
+	lock.Lock()
+	defer lock.Unlock()
+	if sizes != 0 {
+		t.Fatalf("the size is fetched %d times", sizes)
+	}
+}
+
+func TestFSShareExpired(t *testing.T) {
+	data := []byte("hello titan")
+
+	var (
+		lock  sync.Mutex
+		token int
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":"1"}`))
+			return
+		}
+
+		// only the token of the last share is valid
+		lock.Lock()
+		valid := r.URL.Query().Get("token") == strconv.Itoa(token)
+		lock.Unlock()
+		if !valid {
+			http.Error(w, "token expired", http.StatusUnauthorized)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		assets:     []string{"c1"},
+		assetNames: map[string]string{"c1": "a.txt"},
+		assetSizes: map[string]int64{"c1": int64(len(data))},
+		assetURLs: func(cid string) []string {
+			lock.Lock()
+			defer lock.Unlock()
+			token++
+			return []string{fmt.Sprintf("%s/%s?token=%d", node.URL, cid, token)}
+		},
+	}
+	s := &storage{webAPI: web}
+	fsys := s.FS(context.Background(), 0)
+
+	for i := 0; i < 2; i++ {
+		buf, err := fs.ReadFile(fsys, "a.txt")
+		if err != nil || !bytes.Equal(buf, data) {
+			t.Fatalf("read %q, error %v", buf, err)
+		}
+
+		// the cached urls expire
+		lock.Lock()
+		token++
+		lock.Unlock()
+	}
+}
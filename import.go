@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/trickle"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+	_ "github.com/multiformats/go-multihash/register/blake3"
+)
+
+// ImportOptions sets how the data is chunked and laid out into a UnixFS DAG.
+// The same options produce the same CID as `ipfs add` of kubo with the equivalent flags.
+//
+// The zero value lays out CIDv0 with dag-pb leaves, sha2-256, fixed size chunks of 256 KiB and
+// the balanced layout, as `ipfs add` of kubo does without flags. A nil *ImportOptions keeps the
+// layout this package has always used (CIDv1 with raw leaves, sha2-256).
+type ImportOptions struct {
+	// Chunker is the chunking algorithm, same as --chunker of `ipfs add`:
+	// "size-<bytes>", "rabin", "rabin-<min>-<avg>-<max>" or "buzhash", default is "size-262144"
+	Chunker string
+	// RawLeaves stores the file data in raw leaves instead of dag-pb leaves,
+	// kubo enables it by default for CIDv1
+	RawLeaves bool
+	// CidVersion is 0 or 1, it is raised to 1 if HashFunction is not sha2-256
+	CidVersion int
+	// HashFunction is "sha2-256" or "blake3", default is "sha2-256"
+	HashFunction string
+	// Trickle uses the trickle layout instead of the balanced layout
+	Trickle bool
+	// InlineLimit inlines the blocks not larger than InlineLimit bytes into their CID
+	// with the identity hash, 0 disables inlining
+	InlineLimit int
+}
+
+type importOptionsKey struct{}
+
+// WithImportOptions returns a context which makes the uploads called with it use opts
+// instead of the ones set on Config
+func WithImportOptions(ctx context.Context, opts *ImportOptions) context.Context {
+	return context.WithValue(ctx, importOptionsKey{}, opts)
+}
+
+// importOptions returns the import options of the upload called with ctx
+func (s *storage) importOptions(ctx context.Context) *ImportOptions {
+	if opts, ok := ctx.Value(importOptionsKey{}).(*ImportOptions); ok {
+		return opts
+	}
+	return s.importOpts
+}
+
+// prefix returns the CID prefix of the dag-pb nodes
+func (o *ImportOptions) prefix() (cid.Prefix, error) {
+	var hashCode uint64 = multihash.SHA2_256
+	switch o.HashFunction {
+	case "", "sha2-256":
+	case "blake3":
+		hashCode = multihash.BLAKE3
+	default:
+		return cid.Prefix{}, fmt.Errorf("unsupported hash function %s", o.HashFunction)
+	}
+
+	version := o.CidVersion
+	if hashCode != multihash.SHA2_256 {
+		version = 1
+	}
+
+	prefix, err := merkledag.PrefixForCidVersion(version)
+	if err != nil {
+		return cid.Prefix{}, err
+	}
+
+	prefix.MhType = hashCode
+	prefix.MhLength = -1
+	return prefix, nil
+}
+
+// cidBuilder returns the builder of all CIDs in the DAG
+func (o *ImportOptions) cidBuilder() (cid.Builder, error) {
+	prefix, err := o.prefix()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.InlineLimit > 0 {
+		return inlineBuilder{Builder: prefix, limit: o.InlineLimit}, nil
+	}
+	return prefix, nil
+}
+
+// placeholderRoot returns a CID with the same length as a root which is not inlined,
+// it is written into the car header before the real root is known
+func (o *ImportOptions) placeholderRoot() (cid.Cid, error) {
+	prefix, err := o.prefix()
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return prefix.Sum([]byte{})
+}
+
+// inlineBuilder uses the identity hash for the data not larger than limit
+type inlineBuilder struct {
+	cid.Builder
+	limit int
+}
+
+func (b inlineBuilder) Sum(data []byte) (cid.Cid, error) {
+	if len(data) > b.limit {
+		return b.Builder.Sum(data)
+	}
+	return cid.V1Builder{Codec: b.GetCodec(), MhType: multihash.IDENTITY}.Sum(data)
+}
+
+func (b inlineBuilder) WithCodec(c uint64) cid.Builder {
+	return inlineBuilder{Builder: b.Builder.WithCodec(c), limit: b.limit}
+}
+
+// blockSink is a write only format.DAGService which passes every block to put,
+// inlined blocks are skipped since their data is in the CID.
+type blockSink struct {
+	put func(blocks.Block) error
+}
+
+func (bs *blockSink) Add(ctx context.Context, nd format.Node) error {
+	if nd.Cid().Prefix().MhType == multihash.IDENTITY {
+		return nil
+	}
+	return bs.put(nd)
+}
+
+func (bs *blockSink) AddMany(ctx context.Context, nds []format.Node) error {
+	for _, nd := range nds {
+		if err := bs.Add(ctx, nd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *blockSink) Get(ctx context.Context, c cid.Cid) (format.Node, error) {
+	return nil, format.ErrNotFound{Cid: c}
+}
+
+func (bs *blockSink) GetMany(ctx context.Context, cids []cid.Cid) <-chan *format.NodeOption {
+	ch := make(chan *format.NodeOption, len(cids))
+	for _, c := range cids {
+		ch <- &format.NodeOption{Err: format.ErrNotFound{Cid: c}}
+	}
+	close(ch)
+	return ch
+}
+
+func (bs *blockSink) Remove(ctx context.Context, c cid.Cid) error {
+	return nil
+}
+
+func (bs *blockSink) RemoveMany(ctx context.Context, cids []cid.Cid) error {
+	return nil
+}
+
+// importReader imports the data of r as a UnixFS file
+func importReader(r io.Reader, opts *ImportOptions, dserv format.DAGService) (format.Node, error) {
+	builder, err := opts.cidBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	spl, err := chunker.FromString(r, opts.Chunker)
+	if err != nil {
+		return nil, err
+	}
+
+	params := helpers.DagBuilderParams{
+		Dagserv:    dserv,
+		RawLeaves:  opts.RawLeaves,
+		CidBuilder: builder,
+		Maxlinks:   helpers.DefaultLinksPerBlock,
+	}
+
+	db, err := params.New(spl)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Trickle {
+		return trickle.Layout(db)
+	}
+	return balanced.Layout(db)
+}
+
+// importPath imports a file, a symlink or a folder recursively as a UnixFS DAG
+func importPath(ctx context.Context, p string, opts *ImportOptions, dserv format.DAGService) (format.Node, error) {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := opts.cidBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(p)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := unixfs.SymlinkData(target)
+		if err != nil {
+			return nil, err
+		}
+
+		nd := merkledag.NodeWithData(data)
+		if err := nd.SetCidBuilder(builder); err != nil {
+			return nil, err
+		}
+		return nd, dserv.Add(ctx, nd)
+
+	case info.IsDir():
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, err
+		}
+
+		dir := uio.NewDirectory(dserv)
+		dir.SetCidBuilder(builder)
+
+		for _, entry := range entries {
+			child, err := importPath(ctx, filepath.Join(p, entry.Name()), opts, dserv)
+			if err != nil {
+				return nil, err
+			}
+
+			if err := dir.AddChild(ctx, entry.Name(), child); err != nil {
+				return nil, err
+			}
+		}
+
+		nd, err := dir.GetNode()
+		if err != nil {
+			return nil, err
+		}
+		return nd, dserv.Add(ctx, nd)
+
+	default:
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		return importReader(f, opts, dserv)
+	}
+}
+
+// CalculateCidWithOptions calculates the CID for the given reader with the import options,
+// it is the same as CalculateCid if opts is nil.
+func CalculateCidWithOptions(r io.Reader, opts *ImportOptions) (cid.Cid, error) {
+	if opts == nil {
+		return CalculateCid(r)
+	}
+
+	discard := &blockSink{put: func(blocks.Block) error { return nil }}
+	nd, err := importReader(r, opts, discard)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return nd.Cid(), nil
+}
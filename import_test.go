@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/multiformats/go-multihash"
+)
+
+func TestImportOptions(t *testing.T) {
+	// the CIDs produced by kubo for an empty file and an empty folder
+	cases := []struct {
+		opts *ImportOptions
+		cid  string
+	}{
+		{&ImportOptions{}, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{&ImportOptions{CidVersion: 1, RawLeaves: true}, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+	}
+
+	for _, c := range cases {
+		root, err := CalculateCidWithOptions(bytes.NewReader(nil), c.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if root.String() != c.cid {
+			t.Fatalf("expect cid %s, got %s", c.cid, root.String())
+		}
+	}
+
+	dir := t.TempDir()
+	root, err := calculatePathCid(dir, &ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.String() != "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn" {
+		t.Fatalf("unexpected empty folder cid %s", root.String())
+	}
+
+	// the car root must match the locally calculated cid for every layout
+	data := make([]byte, 3<<20)
+	rand.New(rand.NewSource(4)).Read(data)
+	if err := os.WriteFile(filepath.Join(dir, "data.bin"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	layouts := []*ImportOptions{
+		{Chunker: "size-1048576", RawLeaves: true, CidVersion: 1},
+		{Chunker: "rabin", Trickle: true},
+		{Chunker: "buzhash", HashFunction: "blake3", InlineLimit: 32},
+	}
+	for _, opts := range layouts {
+		expect, err := calculatePathCid(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		root, err := createCar(dir, filepath.Join(t.TempDir(), "data.car"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !root.Equals(expect) {
+			t.Fatalf("car root %s does not match %s with %+v", root, expect, opts)
+		}
+
+		if opts.HashFunction == "blake3" && root.Prefix().MhType != multihash.BLAKE3 {
+			t.Fatalf("expect a blake3 cid, got %s", root)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+const defaultIterPageSize = 100
+
+// IterOptions are the options of IterAssets and IterFolders
+type IterOptions struct {
+	// PageSize is the number of entries fetched by a request, default is 100
+	PageSize int
+}
+
+// Iterator walks through the pages of a list, the next page is fetched while the current one is read.
+// It is used as:
+//
+//	it := s.IterAssets(ctx, folderID, nil)
+//	defer it.Close()
+//	for it.Next() {
+//		asset := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type Iterator[T any] struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	pages  chan iterPage[T]
+
+	lock   sync.Mutex
+	total  int
+	items  []T
+	value  T
+	err    error
+	done   bool
+	closed bool
+}
+
+type iterPage[T any] struct {
+	items []T
+	total int
+	err   error
+}
+
+// pageFunc returns the entries of the page and the total number of entries
+type pageFunc[T any] func(ctx context.Context, pageSize, page int) ([]T, int, error)
+
+func newIterator[T any](ctx context.Context, opts *IterOptions, fetch pageFunc[T]) *Iterator[T] {
+	pageSize := defaultIterPageSize
+	if opts != nil && opts.PageSize > 0 {
+		pageSize = opts.PageSize
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	it := &Iterator[T]{ctx: ctx, cancel: cancel, pages: make(chan iterPage[T], 1)}
+	go it.fetch(pageSize, fetch)
+	return it
+}
+
+// fetch sends the pages until the last one, an error or the cancellation of the context
+func (it *Iterator[T]) fetch(pageSize int, fetch pageFunc[T]) {
+	defer close(it.pages)
+
+	for page, count := 1, 0; ; page++ {
+		items, total, err := fetch(it.ctx, pageSize, page)
+		if err == nil && it.ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case it.pages <- iterPage[T]{items: items, total: total, err: err}:
+		case <-it.ctx.Done():
+			return
+		}
+
+		count += len(items)
+		if err != nil || len(items) == 0 || count >= total {
+			return
+		}
+	}
+}
+
+// Next moves to the next entry, it returns false at the end of the list or if an error occurred
+func (it *Iterator[T]) Next() bool {
+	for len(it.items) == 0 {
+		if it.done {
+			return false
+		}
+
+		page, ok := <-it.pages
+		if !ok {
+			it.finish(it.ctx.Err())
+			return false
+		}
+		if page.err != nil {
+			it.finish(page.err)
+			return false
+		}
+
+		it.lock.Lock()
+		it.total = page.total
+		it.lock.Unlock()
+		it.items = page.items
+	}
+
+	it.value = it.items[0]
+	it.items = it.items[1:]
+	return true
+}
+
+// finish stops the iterator with err, the cancellation by Close is not an error
+func (it *Iterator[T]) finish(err error) {
+	it.lock.Lock()
+	defer it.lock.Unlock()
+
+	it.done = true
+	if !it.closed {
+		it.err = err
+	}
+	it.cancel()
+}
+
+// Value returns the current entry
+func (it *Iterator[T]) Value() T {
+	return it.value
+}
+
+// Err returns the error which stopped the iterator, it is the error of the context if it was canceled
+func (it *Iterator[T]) Err() error {
+	it.lock.Lock()
+	defer it.lock.Unlock()
+	return it.err
+}
+
+// Total returns the total number of entries reported by the last page
+func (it *Iterator[T]) Total() int {
+	it.lock.Lock()
+	defer it.lock.Unlock()
+	return it.total
+}
+
+// Close stops fetching the pages, it should be called if the iterator is not read to the end
+func (it *Iterator[T]) Close() {
+	it.lock.Lock()
+	it.closed = true
+	it.lock.Unlock()
+
+	it.cancel()
+}
+
+// IterAssets returns an iterator of the assets in the folder
+func (s *storage) IterAssets(ctx context.Context, folderID int, opts *IterOptions) *Iterator[*client.AssetOverview] {
+	return newIterator(ctx, opts, func(ctx context.Context, pageSize, page int) ([]*client.AssetOverview, int, error) {
+		rsp, err := s.webAPI.ListAssets(ctx, folderID, pageSize, page, "", 0)
+		if err != nil {
+			return nil, 0, err
+		}
+		return rsp.AssetOverviews, rsp.Total, nil
+	})
+}
+
+// IterFolders returns an iterator of the subfolders of the folder parentID
+func (s *storage) IterFolders(ctx context.Context, parentID int, opts *IterOptions) *Iterator[*client.AssetGroup] {
+	return newIterator(ctx, opts, func(ctx context.Context, pageSize, page int) ([]*client.AssetGroup, int, error) {
+		rsp, err := s.webAPI.ListGroups(ctx, parentID, pageSize, page)
+		if err != nil {
+			return nil, 0, err
+		}
+		return rsp.AssetGroups, rsp.Total, nil
+	})
+}
+
+// WalkEntry is a folder or an asset visited by Walk, its path is from the folder where the walk started
+type WalkEntry = PathEntry
+
+// WalkFunc is called by Walk for every entry. If it returns fs.SkipDir for a folder the folder is not walked,
+// for an asset the rest of its folder, the subfolders included, is not walked. fs.SkipAll stops the walk,
+// other errors stop the walk and are returned by Walk.
+type WalkFunc func(entry *WalkEntry) error
+
+// Walk visits the assets and the subfolders of folderID recursively,
+// the assets of a folder are visited before its subfolders.
+func (s *storage) Walk(ctx context.Context, folderID int, fn WalkFunc) error {
+	err := s.walk(ctx, folderID, "/", fn)
+	if errors.Is(err, fs.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+func (s *storage) walk(ctx context.Context, folderID int, dir string, fn WalkFunc) error {
+	assets := s.IterAssets(ctx, folderID, nil)
+	defer assets.Close()
+
+	for assets.Next() {
+		asset := assets.Value()
+		err := fn(s.assetEntry(ctx, dir, folderID, asset))
+		if errors.Is(err, fs.SkipDir) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := assets.Err(); err != nil {
+		return err
+	}
+
+	folders := s.IterFolders(ctx, folderID, nil)
+	defer folders.Close()
+
+	for folders.Next() {
+		entry := newFolderEntry(dir, folders.Value())
+
+		err := fn(entry)
+		if errors.Is(err, fs.SkipDir) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err = s.walk(ctx, entry.Folder.ID, entry.Path, fn); err != nil {
+			return err
+		}
+	}
+
+	return folders.Err()
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestIterators(t *testing.T) {
+	web := &fakeWebserver{
+		groups: []*client.AssetGroup{
+			{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c", Parent: 1}, {ID: 4, Name: "d", Parent: 3},
+		},
+		assets:       []string{"r1", "r2", "r3", "a1", "c1", "c2", "d1", "b1"},
+		assetFolders: map[string]int{"a1": 1, "c1": 3, "c2": 3, "d1": 4, "b1": 2},
+	}
+	s := &storage{webAPI: web}
+	ctx := context.Background()
+
+	assets := s.IterAssets(ctx, 0, &IterOptions{PageSize: 2})
+	var cids []string
+	for assets.Next() {
+		cids = append(cids, assets.Value().AssetRecord.CID)
+	}
+	if err := assets.Err(); err != nil || strings.Join(cids, ",") != "r1,r2,r3" || assets.Total() != 3 {
+		t.Fatalf("unexpected assets %v, total %d, error %v", cids, assets.Total(), err)
+	}
+
+	folders := s.IterFolders(ctx, 0, &IterOptions{PageSize: 1})
+	var names []string
+	for folders.Next() {
+		names = append(names, folders.Value().Name)
+	}
+	if err := folders.Err(); err != nil || strings.Join(names, ",") != "a,b" {
+		t.Fatalf("unexpected folders %v, error %v", names, err)
+	}
+
+	var paths []string
+	err := s.Walk(ctx, 0, func(entry *WalkEntry) error {
+		paths = append(paths, entry.Path)
+		if entry.Folder != nil && entry.Folder.Name == "c" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(paths, ","); got != "/r1,/r2,/r3,/a,/a/a1,/a/c,/b,/b/b1" {
+		t.Fatalf("unexpected walk %s", got)
+	}
+
+	// skipping on an asset skips the rest of its folder and the subfolders
+	paths = nil
+	err = s.Walk(ctx, 0, func(entry *WalkEntry) error {
+		paths = append(paths, entry.Path)
+		if entry.Path == "/a/a1" || entry.Path == "/r2" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(paths, ","); got != "/r1,/r2" {
+		t.Fatalf("unexpected walk %s", got)
+	}
+
+	paths = nil
+	err = s.Walk(ctx, 0, func(entry *WalkEntry) error {
+		paths = append(paths, entry.Path)
+		if entry.Path == "/a/a1" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(paths, ","); got != "/r1,/r2,/r3,/a,/a/a1,/b,/b/b1" {
+		t.Fatalf("unexpected walk %s", got)
+	}
+
+	// the canceled iterator stops with the error of the context
+	cctx, cancel := context.WithCancel(ctx)
+	assets = s.IterAssets(cctx, 0, &IterOptions{PageSize: 1})
+	if !assets.Next() {
+		t.Fatal(assets.Err())
+	}
+	cancel()
+	for assets.Next() {
+	}
+	if !errors.Is(assets.Err(), context.Canceled) {
+		t.Fatalf("expect context canceled, got %v", assets.Err())
+	}
+
+	// the closed iterator stops without error
+	assets = s.IterAssets(ctx, 0, &IterOptions{PageSize: 1})
+	assets.Next()
+	assets.Close()
+	for assets.Next() {
+	}
+	if err := assets.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	// endpointTTL is how long the endpoints returned by CreateAsset are trusted,
+	// older endpoints are asked again before the car is sent.
+	endpointTTL = 30 * time.Minute
+	// endpointRefreshes is how many times the endpoints are asked again after the upload failed on all of them
+	endpointRefreshes = 2
+)
+
+// JournalOptions configures an upload made by UploadWithJournal
+type JournalOptions struct {
+	// JournalDir is the directory to keep the upload journals,
+	// default is titan-storage/uploads under the user cache directory
+	JournalDir string
+}
+
+// uploadJournal records an upload which is not finished, so the upload called again for the same file
+// reuses the cid, the size of the car and the endpoints instead of building the DAG again
+type uploadJournal struct {
+	FilePath string    `json:"file_path"`
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Cid      string    `json:"cid"`
+	CarSize  int64     `json:"car_size"`
+
+	Endpoints         []*client.Endpoint `json:"endpoints"`
+	EndpointsIssuedAt time.Time          `json:"endpoints_issued_at"`
+
+	// path is where the journal itself is stored
+	path string
+}
+
+// journalKey returns the key of the journal for the given file or folder and import options,
+// the same data imported with other options has another cid, so it has another journal.
+// The key of a folder covers the sizes and the modification times of everything in it.
+func journalKey(filePath string, opts *ImportOptions) (string, error) {
+	b, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s", filePath, b)
+
+	err = filepath.WalkDir(filePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(filePath, p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "|%s|%s|%d|%d", filepath.ToSlash(rel), info.Mode().Type(), info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loadJournal loads the journal from path, it returns nil if the journal does not exist or can not be used
+func loadJournal(path string) *uploadJournal {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	j := &uploadJournal{}
+	if err := json.Unmarshal(b, j); err != nil {
+		log.Printf("invalid upload journal %s, %s", path, err.Error())
+		return nil
+	}
+	j.path = path
+
+	if _, err := cid.Decode(j.Cid); err != nil || j.CarSize <= 0 {
+		return nil
+	}
+
+	return j
+}
+
+// save writes the journal to disk atomically
+func (j *uploadJournal) save() error {
+	b, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// remove deletes the journal
+func (j *uploadJournal) remove() {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("delete upload journal %s error %s", j.path, err.Error())
+	}
+}
+
+func defaultJournalDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "titan-storage", "uploads")
+}
+
+// UploadWithJournal uploads a file or folder as car and records the upload in a local journal until it is finished.
+// Calling it again after a crash or network failure reuses the cid, the car size and the endpoints of the journal,
+// so the DAG is not built to plan the car again, and it returns at once if the asset was stored before the failure.
+// The upload itself is not resumed: the L1 node receives the car in one request, so every attempt generates the car
+// again and sends it from the start.
+func (s *storage) UploadWithJournal(ctx context.Context, filePath string, opts *JournalOptions, progress ProgressFunc) (cid.Cid, error) {
+	if s.encryptUpload(ctx) {
+		return cid.Cid{}, fmt.Errorf("journaled uploads can not be encrypted, disable encryption of the upload with WithEncryption")
+	}
+
+	if opts == nil {
+		opts = &JournalOptions{}
+	}
+
+	journalDir := opts.JournalDir
+	if journalDir == "" {
+		journalDir = defaultJournalDir()
+	}
+
+	if err := os.MkdirAll(journalDir, 0o755); err != nil {
+		return cid.Cid{}, err
+	}
+
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	fileInfo, err := os.Stat(absPath)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	importOpts := s.importOptions(ctx)
+	key, err := journalKey(absPath, importOpts)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	walk := pathWalker(ctx, absPath, importOpts)
+	journalPath := filepath.Join(journalDir, key+".json")
+
+	var plan *carPlan
+	j := loadJournal(journalPath)
+	if j != nil {
+		root, err := cid.Decode(j.Cid)
+		if err != nil {
+			return cid.Cid{}, err
+		}
+		// the car is checked against the root while it is generated, a modified file fails the upload
+		plan = &carPlan{root: root, size: j.CarSize, walk: walk}
+	} else if j, plan, err = newJournal(journalPath, absPath, fileInfo, walk); err != nil {
+		return cid.Cid{}, err
+	}
+
+	fileType := FileTypeFile
+	if fileInfo.IsDir() {
+		fileType = FileTypeFolder
+	}
+
+	groupID, err := s.uploadGroup(ctx)
+	if err != nil {
+		return cid.Cid{}, err
+	}
+
+	assetProperty := client.AssetProperty{
+		AssetName: fileInfo.Name(),
+		AssetType: string(fileType),
+		NodeID:    s.candidateID,
+		GroupID:   groupID,
+	}
+
+	replanned := false
+	for refreshed := 0; ; refreshed++ {
+		assetProperty.AssetCID, assetProperty.AssetSize = j.Cid, j.CarSize
+
+		if len(j.Endpoints) == 0 || time.Since(j.EndpointsIssuedAt) > endpointTTL {
+			exist, err := s.refreshEndpoints(ctx, j, assetProperty)
+			if err != nil {
+				return cid.Cid{}, err
+			}
+
+			if exist {
+				j.remove()
+				return plan.root, nil
+			}
+		}
+
+		_, _, err := s.uploadToTargets(ctx, endpointTargets(j.Endpoints), plan.open, fileInfo.Name(), j.Cid, newUploadOptions(ctx, UploadProgress(progress)))
+		if err == nil {
+			j.remove()
+			return plan.root, nil
+		}
+
+		// the journal is stale, e.g. a file was modified within the precision of its modification time,
+		// so the asset of the old cid is deleted and the car is planned again once
+		if plan.changed.Load() && !replanned && ctx.Err() == nil {
+			log.Printf("upload journal %s is stale, %s", j.path, err.Error())
+			j.remove()
+			if delErr := s.webAPI.DeleteAsset(ctx, s.userID, j.Cid); delErr != nil {
+				log.Printf("delete asset %s of the stale journal error %s", j.Cid, delErr.Error())
+			}
+
+			if j, plan, err = newJournal(journalPath, absPath, fileInfo, walk); err != nil {
+				return cid.Cid{}, err
+			}
+			replanned, refreshed = true, -1
+			continue
+		}
+
+		if ctx.Err() != nil || refreshed >= endpointRefreshes {
+			return cid.Cid{}, err
+		}
+
+		// the tokens may be expired or the nodes may be gone, ask for the endpoints again
+		log.Printf("upload %s failed on all endpoints, %s", absPath, err.Error())
+		j.Endpoints = nil
+	}
+}
+
+// newJournal plans the car of the data walked by walk and saves a new journal for it
+func newJournal(journalPath, absPath string, fileInfo os.FileInfo, walk dagWalker) (*uploadJournal, *carPlan, error) {
+	plan, err := planCar(walk)
+	if err != nil {
+		return nil, nil, fmt.Errorf("calculate cid error %w", err)
+	}
+
+	j := &uploadJournal{
+		FilePath: absPath,
+		Size:     fileInfo.Size(),
+		ModTime:  fileInfo.ModTime(),
+		Cid:      plan.root.String(),
+		CarSize:  plan.size,
+		path:     journalPath,
+	}
+	if err := j.save(); err != nil {
+		return nil, nil, fmt.Errorf("save upload journal error %w", err)
+	}
+
+	return j, plan, nil
+}
+
+// refreshEndpoints asks the webserver for the endpoints and tokens of the asset,
+// it returns true if the asset already exists.
+func (s *storage) refreshEndpoints(ctx context.Context, j *uploadJournal, assetProperty client.AssetProperty) (bool, error) {
+	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.uploadAreas(ctx)}
+	rsp, err := s.webAPI.CreateAsset(ctx, &req)
+	if err != nil {
+		return false, fmt.Errorf("CreateAsset error %w", err)
+	}
+
+	if rsp.IsAlreadyExist {
+		return true, nil
+	}
+
+	if len(rsp.Endpoints) == 0 {
+		return false, fmt.Errorf("endpoints is empty")
+	}
+
+	j.Endpoints = rsp.Endpoints
+	j.EndpointsIssuedAt = time.Now()
+
+	return false, j.save()
+}
+
+// sendTransferReport sends the transfer report in background
+func (s *storage) sendTransferReport(r *client.AssetTransferReq) {
+	report := *r
+	go func() {
+		if err := s.webAPI.AssetTransferReport(context.Background(), report); err != nil {
+			log.Printf("failed to send transfer report, %s", err.Error())
+		}
+	}()
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	carv1 "github.com/ipld/go-car"
+)
+
+func TestUploadWithJournal(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "data.bin")
+	data := make([]byte, 1<<20+100)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := calculatePathCid(filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock     sync.Mutex
+		requests int
+		fail     = true
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		car, err := carv1.NewCarReader(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			if _, err := car.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		if fail {
+			http.Error(w, "node busy", http.StatusInternalServerError)
+			return
+		}
+
+		if len(car.Header.Roots) != 1 || !car.Header.Roots[0].Equals(root) {
+			http.Error(w, "unexpected root", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: root.String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{endpoints: func() []*client.Endpoint {
+		return []*client.Endpoint{{CandidateAddr: node.URL, Token: "token"}}
+	}}
+	s := &storage{webAPI: web}
+	opts := &JournalOptions{JournalDir: filepath.Join(dir, "journal")}
+
+	if _, err := s.UploadWithJournal(context.Background(), filePath, opts, nil); err == nil {
+		t.Fatal("expect the first upload to fail")
+	}
+
+	// the endpoints are asked again after the upload failed on all of them
+	if len(web.created) != endpointRefreshes+1 || requests != endpointRefreshes+1 {
+		t.Fatalf("expect %d CreateAsset and uploads, got %d and %d", endpointRefreshes+1, len(web.created), requests)
+	}
+
+	entries, _ := os.ReadDir(opts.JournalDir)
+	if len(entries) != 1 {
+		t.Fatalf("expect the journal to be kept, got %d files", len(entries))
+	}
+
+	lock.Lock()
+	requests = 0
+	fail = false
+	lock.Unlock()
+
+	var total int64
+	c, err := s.UploadWithJournal(context.Background(), filePath, opts, func(done, size int64) {
+		total = size
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Equals(root) {
+		t.Fatalf("expect cid %s, got %s", root, c)
+	}
+
+	// the upload called again uses the endpoints of the journal
+	if len(web.created) != endpointRefreshes+1 || requests != 1 {
+		t.Fatalf("expect the endpoints of the journal to be used, got %d CreateAsset and %d uploads", len(web.created), requests)
+	}
+
+	if total <= 0 {
+		t.Fatalf("expect the size of the car to be reported, got %d", total)
+	}
+
+	entries, _ = os.ReadDir(opts.JournalDir)
+	if len(entries) != 0 {
+		t.Fatalf("expect the journal to be removed, got %d files", len(entries))
+	}
+}
+
+func TestUploadWithJournalStale(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "data.bin")
+	data := make([]byte, 64<<10)
+	rand.New(rand.NewSource(2)).Read(data)
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock sync.Mutex
+		fail = true
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		car, err := carv1.NewCarReader(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for {
+			if _, err := car.Next(); err == io.EOF {
+				break
+			} else if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		if fail {
+			http.Error(w, "node busy", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: car.Header.Roots[0].String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{endpoints: func() []*client.Endpoint {
+		return []*client.Endpoint{{CandidateAddr: node.URL, Token: "token"}}
+	}}
+	s := &storage{webAPI: web}
+	opts := &JournalOptions{JournalDir: filepath.Join(dir, "journal")}
+
+	if _, err := s.UploadWithJournal(context.Background(), filePath, opts, nil); err == nil {
+		t.Fatal("expect the first upload to fail")
+	}
+
+	// the same size and modification time, but other data
+	data[0]++
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filePath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	fail = false
+	lock.Unlock()
+
+	root, err := calculatePathCid(filePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.UploadWithJournal(context.Background(), filePath, opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equals(root) {
+		t.Fatalf("expect the cid %s of the modified file, got %s", root, c)
+	}
+
+	entries, _ := os.ReadDir(opts.JournalDir)
+	if len(entries) != 0 {
+		t.Fatalf("expect the journal to be removed, got %d files", len(entries))
+	}
+}
+
+func TestJournalKeyOfFolder(t *testing.T) {
+	dir := t.TempDir()
+	nested := filepath.Join(dir, "a", "b.txt")
+	if err := os.MkdirAll(filepath.Dir(nested), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(nested, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := journalKey(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the folder itself is not changed by a nested file
+	if err := os.WriteFile(nested, []byte("hello titan"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := journalKey(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key == changed {
+		t.Fatal("expect another journal after a nested file changed")
+	}
+}
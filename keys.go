@@ -0,0 +1,225 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// EncryptionPassphraseEnv is the environment variable read by NewEnvKeyProvider if the name is empty
+const EncryptionPassphraseEnv = "TITAN_ENCRYPTION_PASSPHRASE"
+
+const (
+	// passphraseKeyPrefix starts the ids of the passphrase keys, the random salt of the key follows it
+	passphraseKeyPrefix = "passphrase-"
+	passphraseSaltSize  = 16
+)
+
+// ErrKeyNotFound is returned by a KeyProvider which does not have the key of an encrypted asset
+var ErrKeyNotFound = errors.New("encryption key not found")
+
+// KeyProvider manages the 32 bytes keys of the encrypted uploads.
+// The id of the key is stored in the clear with the encrypted data to find the key again when it is downloaded,
+// so it must not be derived from the key.
+type KeyProvider interface {
+	// EncryptionKey returns the key encrypting the new uploads and its id, the id is at most 255 bytes
+	EncryptionKey(ctx context.Context) (keyID string, key []byte, err error)
+	// DecryptionKey returns the key of keyID, or ErrKeyNotFound
+	DecryptionKey(ctx context.Context, keyID string) ([]byte, error)
+}
+
+// Keyring is a KeyProvider which keeps the keys in a local file,
+// the keys replaced by Rotate are kept to decrypt the assets uploaded before.
+type Keyring struct {
+	lock sync.Mutex
+	path string
+	file keyringFile
+}
+
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// NewKeyring loads the keyring at path, the file is created with a new key if it does not exist
+func NewKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err = k.Rotate(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(buf, &k.file); err != nil {
+		return nil, fmt.Errorf("parse keyring %s failed: %v", path, err)
+	}
+
+	if len(k.file.Keys[k.file.Current]) != encryptKeySize {
+		return nil, fmt.Errorf("keyring %s has no valid current key", path)
+	}
+
+	return k, nil
+}
+
+// EncryptionKey returns the current key of the keyring
+func (k *Keyring) EncryptionKey(ctx context.Context) (string, []byte, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	return k.file.Current, k.file.Keys[k.file.Current], nil
+}
+
+// DecryptionKey returns the key of keyID
+func (k *Keyring) DecryptionKey(ctx context.Context, keyID string) ([]byte, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	key, ok := k.file.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s: %w", keyID, ErrKeyNotFound)
+	}
+	return key, nil
+}
+
+// Rotate adds a new key which encrypts the uploads from now on and saves the keyring, it returns the id of the key
+func (k *Keyring) Rotate() (string, error) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	key := make([]byte, encryptKeySize)
+	id := make([]byte, 8)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+
+	file := keyringFile{Current: hex.EncodeToString(id), Keys: map[string][]byte{}}
+	for keyID, key := range k.file.Keys {
+		file.Keys[keyID] = key
+	}
+	file.Keys[file.Current] = key
+
+	if err := saveKeyring(k.path, &file); err != nil {
+		return "", err
+	}
+
+	k.file = file
+	return file.Current, nil
+}
+
+// saveKeyring writes the keyring which only the user can read
+func saveKeyring(path string, file *keyringFile) error {
+	buf, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, buf, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// passphraseProvider derives the keys from a passphrase, every provider encrypts with a key of a random salt.
+// The salt is the id of the key, so another provider of the passphrase derives the key again to decrypt.
+type passphraseProvider struct {
+	passphrase []byte
+	id         string
+
+	lock sync.Mutex
+	// keys are the keys derived by their ids
+	keys map[string][]byte
+}
+
+// NewPassphraseKeyProvider returns a KeyProvider whose keys are derived from passphrase with scrypt
+func NewPassphraseKeyProvider(passphrase string) (KeyProvider, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase can not be empty")
+	}
+
+	salt := make([]byte, passphraseSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key, err := passphraseKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	id := passphraseKeyPrefix + base64.RawURLEncoding.EncodeToString(salt)
+	return &passphraseProvider{passphrase: []byte(passphrase), id: id, keys: map[string][]byte{id: key}}, nil
+}
+
+func passphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, encryptKeySize)
+}
+
+// NewEnvKeyProvider returns a KeyProvider whose key is derived from the passphrase in the environment variable name,
+// EncryptionPassphraseEnv is read if name is empty
+func NewEnvKeyProvider(name string) (KeyProvider, error) {
+	if len(name) == 0 {
+		name = EncryptionPassphraseEnv
+	}
+
+	passphrase := os.Getenv(name)
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+
+	return NewPassphraseKeyProvider(passphrase)
+}
+
+func (p *passphraseProvider) EncryptionKey(ctx context.Context) (string, []byte, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.id, p.keys[p.id], nil
+}
+
+// DecryptionKey derives the key of the salt in keyID, the key is ErrKeyNotFound if keyID is not a passphrase key.
+// A wrong passphrase gives a wrong key, which fails to decrypt the data.
+func (p *passphraseProvider) DecryptionKey(ctx context.Context, keyID string) ([]byte, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if key, ok := p.keys[keyID]; ok {
+		return key, nil
+	}
+
+	salt, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(keyID, passphraseKeyPrefix))
+	if !strings.HasPrefix(keyID, passphraseKeyPrefix) || err != nil || len(salt) != passphraseSaltSize {
+		return nil, fmt.Errorf("key %s: %w", keyID, ErrKeyNotFound)
+	}
+
+	key, err := passphraseKey(string(p.passphrase), salt)
+	if err != nil {
+		return nil, err
+	}
+
+	p.keys[keyID] = key
+	return key, nil
+}
@@ -0,0 +1,441 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	byterange "github.com/Titannet-dao/titan-storage-sdk/range"
+)
+
+// PathEntry is a folder or an asset addressed by its path, only one of Folder and Asset is set
+type PathEntry struct {
+	// Path is the clean path of the entry, e.g. /photos/2026/a.jpg
+	Path string
+	// Parent is the id of the folder containing the entry
+	Parent int
+	Folder *client.AssetGroup
+	Asset  *client.AssetOverview
+	// size returns the size of the asset content, it is set for the entries returned by the storage
+	size func() int64
+}
+
+func newFolderEntry(dir string, group *client.AssetGroup) *PathEntry {
+	return &PathEntry{Path: path.Join(dir, group.Name), Parent: group.Parent, Folder: group}
+}
+
+func newAssetEntry(dir string, parent int, asset *client.AssetOverview) *PathEntry {
+	return &PathEntry{Path: path.Join(dir, assetName(asset)), Parent: parent, Asset: asset}
+}
+
+// assetEntry returns the entry of the asset, the size of its content is fetched from a node
+// the first time it is asked
+func (s *storage) assetEntry(ctx context.Context, dir string, parent int, asset *client.AssetOverview) *PathEntry {
+	entry := newAssetEntry(dir, parent, asset)
+	entry.size = sync.OnceValue(func() int64 {
+		size, err := s.assetSize(ctx, entry.CID())
+		if err != nil {
+			log.Printf("get size of asset %s failed: %s", entry.CID(), err.Error())
+			return entry.recordedSize()
+		}
+		return size
+	})
+	return entry
+}
+
+// assetSizeCache caches the sizes of the asset contents by cid, they never change
+type assetSizeCache struct {
+	lock  sync.Mutex
+	sizes map[string]int64
+}
+
+func (c *assetSizeCache) get(assetCID string) (int64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	size, ok := c.sizes[assetCID]
+	return size, ok
+}
+
+func (c *assetSizeCache) put(assetCID string, size int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.sizes == nil {
+		c.sizes = make(map[string]int64)
+	}
+	c.sizes[assetCID] = size
+}
+
+// assetSize returns the size of the unixfs file of the asset root, the node serves the asset by its content
+// so the size is the one of the ranges, not the size recorded by the server which is the size of the car
+func (s *storage) assetSize(ctx context.Context, assetCID string) (int64, error) {
+	if size, ok := s.sizes.get(assetCID); ok {
+		return size, nil
+	}
+
+	res, err := s.GetURL(ctx, assetCID)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := byterange.NewWithOptions(assetBlockSize, s.opts).FileSize(ctx, res)
+	if err != nil {
+		return 0, err
+	}
+
+	s.sizes.put(assetCID, size)
+	return size, nil
+}
+
+// assetName returns the name of the asset, it is the cid if the asset has no name
+func assetName(asset *client.AssetOverview) string {
+	if asset.UserAssetDetail != nil && len(asset.UserAssetDetail.AssetName) > 0 {
+		return asset.UserAssetDetail.AssetName
+	}
+	if asset.AssetRecord != nil {
+		return asset.AssetRecord.CID
+	}
+	return ""
+}
+
+// Name returns the last element of the path
+func (e *PathEntry) Name() string {
+	return path.Base(e.Path)
+}
+
+// IsFolder reports whether the entry is a folder
+func (e *PathEntry) IsFolder() bool {
+	return e.Folder != nil
+}
+
+// CID returns the cid of the asset, it is empty for a folder
+func (e *PathEntry) CID() string {
+	if e.Asset == nil || e.Asset.AssetRecord == nil {
+		return ""
+	}
+	return e.Asset.AssetRecord.CID
+}
+
+// Size returns the size of the asset content, or the size of the assets in the folder.
+// The size of the content is fetched from a node once for the entries returned by the storage,
+// if it fails or the entry is made by the caller it is the size recorded by the server.
+func (e *PathEntry) Size() int64 {
+	if e.Folder != nil {
+		return e.Folder.AssetSize
+	}
+	if e.size != nil {
+		return e.size()
+	}
+	return e.recordedSize()
+}
+
+// recordedSize is the size of the asset recorded by the server, it is the size of the car for the car uploads
+func (e *PathEntry) recordedSize() int64 {
+	if e.Asset.UserAssetDetail != nil && e.Asset.UserAssetDetail.TotalSize > 0 {
+		return e.Asset.UserAssetDetail.TotalSize
+	}
+	if e.Asset.AssetRecord != nil {
+		return e.Asset.AssetRecord.TotalSize
+	}
+	return 0
+}
+
+// ModTime returns the time the entry was created
+func (e *PathEntry) ModTime() time.Time {
+	if e.Folder != nil {
+		return e.Folder.CreatedTime
+	}
+	if e.Asset.UserAssetDetail != nil {
+		return e.Asset.UserAssetDetail.CreatedTime
+	}
+	return time.Time{}
+}
+
+// rootEntry is the folder rootID at the root of the paths
+func rootEntry(rootID int) *PathEntry {
+	return &PathEntry{Path: "/", Folder: &client.AssetGroup{ID: rootID, Name: "/"}}
+}
+
+// Stat returns the folder or asset at p, e.g. /photos/2026/a.jpg, the folder is returned
+// if a folder and an asset have the same name. The error is a *fs.PathError of fs.ErrNotExist if it does not exist.
+func (s *storage) Stat(ctx context.Context, p string) (*PathEntry, error) {
+	entry, err := s.lookup(ctx, p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: p, Err: err}
+	}
+	return entry, nil
+}
+
+// lookup resolves p through the cached folders and the assets of the last folder
+func (s *storage) lookup(ctx context.Context, p string) (*PathEntry, error) {
+	return s.lookupIn(ctx, 0, p)
+}
+
+// lookupIn is lookup of the paths from the folder rootID
+func (s *storage) lookupIn(ctx context.Context, rootID int, p string) (*PathEntry, error) {
+	names, err := splitFolderPath(p)
+	if err != nil {
+		return nil, fs.ErrInvalid
+	}
+
+	entry := rootEntry(rootID)
+	for i, name := range names {
+		if !entry.IsFolder() {
+			return nil, fs.ErrNotExist
+		}
+
+		group, err := s.findGroup(ctx, entry.Folder.ID, name)
+		if err != nil {
+			return nil, err
+		}
+		if group != nil {
+			entry = newFolderEntry(entry.Path, group)
+			continue
+		}
+
+		// only the last element can be an asset
+		if i < len(names)-1 {
+			return nil, fs.ErrNotExist
+		}
+
+		asset, err := s.findAsset(ctx, entry.Folder.ID, name)
+		if err != nil {
+			return nil, err
+		}
+		if asset == nil {
+			return nil, fs.ErrNotExist
+		}
+		entry = s.assetEntry(ctx, entry.Path, entry.Folder.ID, asset)
+	}
+
+	return entry, nil
+}
+
+// findAsset returns the asset name in the folder, or nil if it does not exist
+func (s *storage) findAsset(ctx context.Context, folderID int, name string) (*client.AssetOverview, error) {
+	it := s.IterAssets(ctx, folderID, nil)
+	defer it.Close()
+
+	for it.Next() {
+		if asset := it.Value(); assetName(asset) == name {
+			return asset, nil
+		}
+	}
+	return nil, it.Err()
+}
+
+// lookupFolder returns the folder at p
+func (s *storage) lookupFolder(ctx context.Context, op, p string) (*PathEntry, error) {
+	entry, err := s.lookup(ctx, p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: p, Err: err}
+	}
+	if !entry.IsFolder() {
+		return nil, &fs.PathError{Op: op, Path: p, Err: fmt.Errorf("not a folder")}
+	}
+	return entry, nil
+}
+
+// ReadDir returns the subfolders and then the assets of the folder at p
+func (s *storage) ReadDir(ctx context.Context, p string) ([]*PathEntry, error) {
+	dir, err := s.lookupFolder(ctx, "readdir", p)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.readDir(ctx, dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: err}
+	}
+	return entries, nil
+}
+
+// readDir returns the subfolders and then the assets of the folder dir
+func (s *storage) readDir(ctx context.Context, dir *PathEntry) ([]*PathEntry, error) {
+	groups, err := s.subfolders(ctx, dir.Folder.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*PathEntry, 0, len(groups))
+	for _, group := range groups {
+		entries = append(entries, newFolderEntry(dir.Path, group))
+	}
+
+	it := s.IterAssets(ctx, dir.Folder.ID, nil)
+	defer it.Close()
+
+	for it.Next() {
+		entries = append(entries, s.assetEntry(ctx, dir.Path, dir.Folder.ID, it.Value()))
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// MkdirAll creates the folder at p and the missing folders above it, it returns the id of the folder
+func (s *storage) MkdirAll(ctx context.Context, p string) (int, error) {
+	id, err := s.ResolveFolder(ctx, p, true)
+	if err != nil {
+		return 0, &fs.PathError{Op: "mkdir", Path: p, Err: err}
+	}
+	return id, nil
+}
+
+// Remove deletes the asset or the empty folder at p
+func (s *storage) Remove(ctx context.Context, p string) error {
+	entry, err := s.lookup(ctx, p)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: p, Err: err}
+	}
+
+	if !entry.IsFolder() {
+		if err = s.DeleteAsset(ctx, entry.CID()); err != nil {
+			return &fs.PathError{Op: "remove", Path: p, Err: err}
+		}
+		return nil
+	}
+
+	if entry.Path == "/" {
+		return &fs.PathError{Op: "remove", Path: p, Err: fmt.Errorf("can not remove the root folder")}
+	}
+
+	entries, err := s.ReadDir(ctx, entry.Path)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return &fs.PathError{Op: "remove", Path: p, Err: fmt.Errorf("folder is not empty")}
+	}
+
+	if err = s.DeleteFolder(ctx, entry.Folder.ID); err != nil {
+		return &fs.PathError{Op: "remove", Path: p, Err: err}
+	}
+	return nil
+}
+
+// RemoveAll deletes the asset at p, or the folder at p with all the folders and assets in it.
+// It returns nil if p does not exist.
+func (s *storage) RemoveAll(ctx context.Context, p string) error {
+	entry, err := s.lookup(ctx, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return &fs.PathError{Op: "removeall", Path: p, Err: err}
+	}
+
+	if !entry.IsFolder() {
+		return s.Remove(ctx, entry.Path)
+	}
+
+	if entry.Path == "/" {
+		return &fs.PathError{Op: "removeall", Path: p, Err: fmt.Errorf("can not remove the root folder")}
+	}
+
+	if err = s.removeFolder(ctx, entry); err != nil {
+		return &fs.PathError{Op: "removeall", Path: p, Err: err}
+	}
+	return nil
+}
+
+// removeFolder deletes the assets and subfolders of the folder before the folder
+func (s *storage) removeFolder(ctx context.Context, dir *PathEntry) error {
+	entries, err := s.ReadDir(ctx, dir.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsFolder() {
+			err = s.removeFolder(ctx, entry)
+		} else {
+			err = s.DeleteAsset(ctx, entry.CID())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.DeleteFolder(ctx, dir.Folder.ID)
+}
+
+// Rename renames or moves the folder or asset at oldPath to newPath, the folder of newPath must exist
+// and newPath must not exist.
+func (s *storage) Rename(ctx context.Context, oldPath, newPath string) error {
+	entry, err := s.lookup(ctx, oldPath)
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: err}
+	}
+
+	if entry.Path == "/" {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: fmt.Errorf("can not rename the root folder")}
+	}
+
+	names, err := splitFolderPath(newPath)
+	if err != nil || len(names) == 0 {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: fs.ErrInvalid}
+	}
+
+	target := "/" + path.Join(names...)
+	if target == entry.Path {
+		return nil
+	}
+
+	if _, err := s.lookup(ctx, target); err == nil {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: err}
+	}
+
+	dir, err := s.lookupFolder(ctx, "rename", path.Dir(target))
+	if err != nil {
+		return err
+	}
+	newName := path.Base(target)
+
+	if entry.IsFolder() {
+		err = s.renameFolder(ctx, entry, dir.Folder.ID, newName)
+	} else {
+		err = s.renameAsset(ctx, entry, dir.Folder.ID, newName)
+	}
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: err}
+	}
+	return nil
+}
+
+func (s *storage) renameFolder(ctx context.Context, entry *PathEntry, parent int, name string) error {
+	if entry.Parent != parent {
+		if err := s.MoveFolder(ctx, entry.Folder.ID, parent); err != nil {
+			return err
+		}
+	}
+
+	if entry.Name() != name {
+		return s.RenameFolder(ctx, int64(entry.Folder.ID), name)
+	}
+	return nil
+}
+
+func (s *storage) renameAsset(ctx context.Context, entry *PathEntry, parent int, name string) error {
+	if entry.Parent != parent {
+		if err := s.MoveAsset(ctx, entry.CID(), parent); err != nil {
+			return err
+		}
+	}
+
+	if entry.Name() != name {
+		return s.RenameAsset(ctx, entry.CID(), name)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestPaths(t *testing.T) {
+	web := &fakeWebserver{
+		groups:       []*client.AssetGroup{{ID: 1, Name: "photos"}, {ID: 2, Name: "2026", Parent: 1}},
+		assets:       []string{"c1", "c2", "c3"},
+		assetFolders: map[string]int{"c1": 2, "c2": 2, "c3": 1},
+		assetNames:   map[string]string{"c1": "a.jpg", "c2": "b.jpg", "c3": "c.jpg"},
+	}
+	s := &storage{webAPI: web}
+	ctx := context.Background()
+
+	entry, err := s.Stat(ctx, "/photos/2026/a.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.IsFolder() || entry.CID() != "c1" || entry.Parent != 2 || entry.Path != "/photos/2026/a.jpg" {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	// the folders are cached
+	lists := web.calls["ListGroups"]
+	if entry, err = s.Stat(ctx, "photos/2026"); err != nil || !entry.IsFolder() || entry.Folder.ID != 2 {
+		t.Fatalf("unexpected entry %+v, error %v", entry, err)
+	}
+	if web.calls["ListGroups"] != lists {
+		t.Fatalf("the folders are listed again")
+	}
+
+	if _, err = s.Stat(ctx, "/photos/2026/a.jpg/x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expect not exist, got %v", err)
+	}
+	if _, err = s.Stat(ctx, "/videos"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expect not exist, got %v", err)
+	}
+
+	entries, err := s.ReadDir(ctx, "/photos")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Path)
+	}
+	if strings.Join(names, ",") != "/photos/2026,/photos/c.jpg" {
+		t.Fatalf("unexpected entries %v", names)
+	}
+
+	// the cache is dropped by the changes
+	id, err := s.MkdirAll(ctx, "/photos/2026/10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry, err = s.Stat(ctx, "/photos/2026/10"); err != nil || entry.Folder.ID != id {
+		t.Fatalf("unexpected entry %+v, error %v", entry, err)
+	}
+
+	if err = s.Rename(ctx, "/photos/2026/a.jpg", "/photos/2026/10/x.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if web.assetFolders["c1"] != id || web.assetNames["c1"] != "x.jpg" {
+		t.Fatalf("unexpected asset %d %s", web.assetFolders["c1"], web.assetNames["c1"])
+	}
+	if err = s.Rename(ctx, "/photos/2026/b.jpg", "/photos/2026/10/x.jpg"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expect exist, got %v", err)
+	}
+
+	if err = s.Rename(ctx, "/photos/2026", "/2026"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Stat(ctx, "/2026/10/x.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = s.Remove(ctx, "/2026"); err == nil {
+		t.Fatal("expect the folder is not empty")
+	}
+	if err = s.RemoveAll(ctx, "/2026"); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.groups) != 1 || strings.Join(web.assets, ",") != "c3" {
+		t.Fatalf("unexpected groups %+v and assets %v", web.groups, web.assets)
+	}
+	if err = s.RemoveAll(ctx, "/2026"); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Remove(ctx, "/photos/c.jpg"); err != nil {
+		t.Fatal(err)
+	}
+}
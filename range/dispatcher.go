@@ -7,29 +7,66 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/Titannet-dao/titan-storage-sdk/client"
 	"github.com/eikenb/pipeat"
 	"github.com/pkg/errors"
 )
 
+// defaultMaxRetries is the number of failed requests after which a download fails
+const defaultMaxRetries = 32
+
 type dispatcher struct {
 	fileSize  int64
 	rangeSize int64
 	todos     JobQueue
 	workers   chan worker
 	resp      chan response
-	writer    *pipeat.PipeWriterAt
+	writer    io.WriterAt
 	reader    *pipeat.PipeReaderAt
 	backoff   *backoff
+
+	// skip reports whether the range at index is already downloaded
+	skip func(index int) bool
+	// done is called after the range at index is written
+	done func(index int) error
+	// remaining is the size of the ranges to download
+	remaining int64
+	// written is closed when writeData exits, err is the reason if it failed
+	written chan struct{}
+	err     error
+	// stopped is the reason run returned before all ranges are downloaded
+	stopped error
+	// maxRetries caps the failed requests of the whole download
+	maxRetries int
+	// c fetches the ranges, opts limits the time of every request
+	c    *http.Client
+	opts *client.Options
+
+	lock sync.Mutex
+	// flights are the running requests, the oldest first
+	flights []*flight
+	// finished are the ranges sent to writeData
+	finished map[int]bool
+	// owners counts the running requests of every range
+	owners map[int]int
+	// idle are the workers waiting for a failed range
+	idle    []worker
+	alive   int
+	retries int
+	cancel  context.CancelCauseFunc
 }
 
 type worker struct {
 	// c *http.Client
 	e string
+	s *workerStats
 }
 
 type response struct {
+	index  int
 	offset int64
 	data   []byte
 }
@@ -41,6 +78,23 @@ type job struct {
 	retry int
 }
 
+// flight is a request of consecutive ranges sent to a worker
+type flight struct {
+	jobs   []*job
+	worker worker
+	hedged bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (f *flight) start() int64 {
+	return f.jobs[0].start
+}
+
+func (f *flight) end() int64 {
+	return f.jobs[len(f.jobs)-1].end
+}
+
 type backoff struct {
 	minDelay time.Duration
 	maxDelay time.Duration
@@ -73,6 +127,10 @@ func (d *dispatcher) generateJobs() {
 			end = d.fileSize
 		}
 
+		if d.skip != nil && d.skip(int(i)) {
+			continue
+		}
+
 		newJob := &job{
 			index: int(i),
 			start: start,
@@ -80,73 +138,254 @@ func (d *dispatcher) generateJobs() {
 		}
 
 		d.todos.Push(newJob)
+		d.remaining += end - start
 	}
 }
 
+// run hands the ranges to the workers until all of them are downloaded.
+// A fast worker fetches several ranges in one request, a worker which keeps failing is
+// quarantined and then evicted, and the last ranges are hedged onto the faster workers.
 func (d *dispatcher) run(ctx context.Context) {
+	d.written = make(chan struct{})
+	d.finished = make(map[int]bool)
+	d.owners = make(map[int]int)
+	d.alive = len(d.workers)
+	if d.maxRetries == 0 {
+		d.maxRetries = defaultMaxRetries
+	}
+
 	d.generateJobs()
+
+	ctx, d.cancel = context.WithCancelCause(ctx)
 	d.writeData(ctx)
 
+	if d.remaining == 0 {
+		return
+	}
+
 	var (
 		counter  int64
 		finished = make(chan int64, 1)
 	)
 
-	// go func() {
 	for {
 		select {
 		case w := <-d.workers:
-			go func() {
-				j, ok := d.todos.Pop()
-				if !ok {
-					d.workers <- w
-					return
-				}
+			if f := d.schedule(ctx, w); f != nil {
+				go d.download(ctx, f, finished)
+			}
+		case size := <-finished:
+			counter += size
+			if counter >= d.remaining {
+				return
+			}
+		case <-d.written:
+			// writing failed
+			return
+		case <-ctx.Done():
+			d.stopped = context.Cause(ctx)
+			return
+		}
+	}
+}
 
-				data, err := d.fetch(ctx, w, j)
-				if err != nil {
-					errMsg := fmt.Sprintf("pull data failed : %v", err)
-					if j.retry > 0 {
-						log.Errorf("pull data failed (retries: %d): %v", j.retry, err)
-						<-time.After(d.backoff.next(j.retry))
-					}
+// schedule returns the next request of w, w is parked if there is nothing to do
+func (d *dispatcher) schedule(ctx context.Context, w worker) *flight {
+	d.lock.Lock()
+	defer d.lock.Unlock()
 
-					log.Warnf(errMsg)
+	f := &flight{worker: w, jobs: d.todos.PopBatch(w.s.batch(d.rangeSize))}
+	if len(f.jobs) == 0 {
+		if f = d.hedge(w); f == nil {
+			d.idle = append(d.idle, w)
+			return nil
+		}
+	}
 
-					j.retry++
-					d.todos.PushFront(j)
-					d.workers <- w
-					return
-				}
+	f.ctx, f.cancel = context.WithCancel(ctx)
+	d.flights = append(d.flights, f)
+	for _, j := range f.jobs {
+		d.owners[j.index]++
+	}
 
-				dataLen := j.end - j.start
+	return f
+}
 
-				if int64(len(data)) < dataLen {
-					log.Errorf("unexpected data size, want %d got %d", dataLen, len(data))
-					d.todos.PushFront(j)
-					d.workers <- w
-					return
-				}
+// hedge returns a copy of the oldest request of a slower worker for w, d.lock must be held
+func (d *dispatcher) hedge(w worker) *flight {
+	speed := w.s.speed()
+	if speed == 0 {
+		return nil
+	}
 
-				d.workers <- w
-				d.resp <- response{
-					data:   data[:dataLen],
-					offset: j.start,
-				}
-				finished <- dataLen
-			}()
-		case size := <-finished:
-			counter += size
-			if counter >= d.fileSize {
-				return
-			}
+	for _, f := range d.flights {
+		if f.hedged || f.worker.e == w.e || f.worker.s.speed() >= speed {
+			continue
+		}
+
+		f.hedged = true
+		return &flight{worker: w, jobs: f.jobs, hedged: true}
+	}
+
+	return nil
+}
+
+// download runs the request f and sends the new ranges to writeData
+func (d *dispatcher) download(ctx context.Context, f *flight, finished chan int64) {
+	defer f.cancel()
+
+	startTime := time.Now()
+	data, err := d.fetch(f.ctx, f.worker, f.start(), f.end())
+	cost := time.Since(startTime)
+
+	d.lock.Lock()
+	d.untrack(f)
+
+	if err == nil && int64(len(data)) < f.end()-f.start() {
+		err = fmt.Errorf("unexpected data size, want %d got %d", f.end()-f.start(), len(data))
+	}
+
+	if err != nil {
+		d.failed(ctx, f, err)
+		d.lock.Unlock()
+		return
+	}
+
+	var (
+		resps []response
+		size  int64
+	)
+	for _, j := range f.jobs {
+		if d.finished[j.index] {
+			continue
+		}
+		d.finished[j.index] = true
+
+		resps = append(resps, response{
+			index:  j.index,
+			data:   data[j.start-f.start() : j.end-f.start()],
+			offset: j.start,
+		})
+		size += j.end - j.start
+	}
+
+	// the other copy of the request is no longer needed
+	for _, other := range d.flights {
+		if other.hedged && d.allFinished(other) {
+			other.cancel()
+		}
+	}
+	d.lock.Unlock()
+
+	f.worker.s.succeed(int64(len(data)), cost)
+	log.Infof("Chunk: %fs, ranges: %d, Link: %s", cost.Seconds(), len(f.jobs), f.worker.e)
+	d.workers <- f.worker
+
+	for _, r := range resps {
+		select {
+		case d.resp <- r:
 		case <-ctx.Done():
 			return
 		}
 	}
-	// }()
 
-	// return
+	if size > 0 {
+		select {
+		case finished <- size:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// failed handles the failed request f, d.lock must be held
+func (d *dispatcher) failed(ctx context.Context, f *flight, err error) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	// canceled because the other copy finished
+	if f.ctx.Err() != nil {
+		d.workers <- f.worker
+		return
+	}
+
+	log.Warnf("pull data failed (link: %s): %v", f.worker.e, err)
+
+	d.retries++
+	if d.retries > d.maxRetries {
+		d.cancel(fmt.Errorf("download failed after %d retries: %w", d.maxRetries, err))
+		return
+	}
+
+	// requeue the ranges which are not downloaded by the other copy
+	retry := 0
+	for i := len(f.jobs) - 1; i >= 0; i-- {
+		j := f.jobs[i]
+		if d.finished[j.index] || d.owners[j.index] > 0 {
+			continue
+		}
+		j.retry++
+		if j.retry > retry {
+			retry = j.retry
+		}
+		d.todos.PushFront(j)
+	}
+
+	// wake the idle workers for the requeued ranges
+	for _, w := range d.idle {
+		d.workers <- w
+	}
+	d.idle = nil
+
+	quarantine, evict := f.worker.s.fail()
+	switch {
+	case evict:
+		log.Errorf("evict node %s: %v", f.worker.e, err)
+		d.alive--
+		if d.alive == 0 {
+			d.cancel(fmt.Errorf("no node available: %w", err))
+		}
+	case quarantine > 0:
+		log.Warnf("quarantine node %s for %s", f.worker.e, quarantine)
+		d.release(ctx, f.worker, quarantine)
+	default:
+		d.release(ctx, f.worker, d.backoff.next(retry))
+	}
+}
+
+// release gives the worker back after the delay
+func (d *dispatcher) release(ctx context.Context, w worker, delay time.Duration) {
+	go func() {
+		select {
+		case <-time.After(delay):
+			d.workers <- w
+		case <-ctx.Done():
+		}
+	}()
+}
+
+// untrack removes the finished request f, d.lock must be held
+func (d *dispatcher) untrack(f *flight) {
+	for i, other := range d.flights {
+		if other == f {
+			d.flights = append(d.flights[:i], d.flights[i+1:]...)
+			break
+		}
+	}
+
+	for _, j := range f.jobs {
+		d.owners[j.index]--
+	}
+}
+
+// allFinished reports whether all ranges of f are downloaded, d.lock must be held
+func (d *dispatcher) allFinished(f *flight) bool {
+	for _, j := range f.jobs {
+		if !d.finished[j.index] {
+			return false
+		}
+	}
+	return true
 }
 
 func (d *dispatcher) writeData(ctx context.Context) {
@@ -154,20 +393,27 @@ func (d *dispatcher) writeData(ctx context.Context) {
 		defer d.finally()
 
 		var count int64
-		for {
+		for count < d.remaining {
 			select {
 			case r := <-d.resp:
 				_, err := d.writer.WriteAt(r.data, r.offset)
 				if err != nil {
 					log.Errorf("write data failed: %v", err)
-					continue
+					d.err = err
+					return
 				}
 
-				count += int64(len(r.data))
-				if count >= d.fileSize {
-					return
+				if d.done != nil {
+					if err := d.done(r.index); err != nil {
+						log.Errorf("mark range %d failed: %v", r.index, err)
+						d.err = err
+						return
+					}
 				}
+
+				count += int64(len(r.data))
 			case <-ctx.Done():
+				d.err = context.Cause(ctx)
 				return
 			}
 		}
@@ -175,15 +421,22 @@ func (d *dispatcher) writeData(ctx context.Context) {
 	}()
 }
 
-func (d *dispatcher) fetch(ctx context.Context, w worker, j *job) ([]byte, error) {
-	startTime := time.Now()
-	req, err := http.NewRequest("GET", w.e, nil)
+// fetch downloads the bytes [start, end) of the file from the worker
+func (d *dispatcher) fetch(ctx context.Context, w worker, start, end int64) ([]byte, error) {
+	ctx, cancel := d.opts.DownloadContext(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", w.e, nil)
 	if err != nil {
 		return nil, errors.Errorf("new request failed: %v", err)
 	}
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", j.start, j.end))
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
 	// resp, err := w.c.Do(req)
-	resp, err := http.DefaultClient.Do(req)
+	c := d.c
+	if c == nil {
+		c = d.opts.NodeClient()
+	}
+	resp, err := c.Do(req)
 	if err != nil {
 		return nil, errors.Errorf("fetch failed: %v", err)
 	}
@@ -194,23 +447,36 @@ func (d *dispatcher) fetch(ctx context.Context, w worker, j *job) ([]byte, error
 		}
 	}()
 
-	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to download chunk: %d-%d, status code: %d", j.start, j.end, resp.StatusCode)
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the node ignored the range, skip to the start
+		if _, err := io.CopyN(io.Discard, resp.Body, start); err != nil {
+			return nil, errors.Errorf("read data failed: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("failed to download chunk: %d-%d, status code: %d", start, end, resp.StatusCode)
 	}
 
-	data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, end-start))
 	if err != nil {
 		return nil, errors.Errorf("read data failed: %v", err)
 	}
 
-	elapsed := time.Since(startTime)
-	log.Infof("Chunk: %fs, Link: %s", elapsed.Seconds(), w.e)
-
 	return data, nil
 }
 
 func (d *dispatcher) finally() {
-	if err := d.writer.Close(); err != nil {
+	defer close(d.written)
+	// stop the requests still running
+	defer d.cancel(nil)
+
+	closer, ok := d.writer.(interface{ CloseWithError(error) error })
+	if !ok {
+		return
+	}
+
+	if err := closer.CloseWithError(d.err); err != nil {
 		log.Errorf("close write failed: %v", err)
 	}
 }
@@ -0,0 +1,192 @@
+package byterange
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+type memWriter struct {
+	lock sync.Mutex
+	data []byte
+}
+
+func (m *memWriter) WriteAt(p []byte, off int64) (int, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return copy(m.data[off:], p), nil
+}
+
+// newNode serves data by ranges, the request fails if get returns false
+func newNode(data []byte, get func(r *http.Request) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			// titan.Version
+			w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":"1"}`))
+			return
+		}
+
+		if get != nil && !get(r) {
+			http.Error(w, "node busy", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func download(data []byte, rangeSize int64, maxRetries int, urls ...string) ([]byte, error) {
+	workers := make(chan worker, len(urls))
+	for _, u := range urls {
+		workers <- worker{e: u, s: &workerStats{}}
+	}
+
+	w := &memWriter{data: make([]byte, len(data))}
+	d := &dispatcher{
+		fileSize:   int64(len(data)),
+		rangeSize:  rangeSize,
+		writer:     w,
+		workers:    workers,
+		resp:       make(chan response, len(urls)),
+		backoff:    &backoff{minDelay: 10 * time.Millisecond, maxDelay: 100 * time.Millisecond},
+		maxRetries: maxRetries,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	d.run(ctx)
+	<-d.written
+
+	return w.data, d.err
+}
+
+func TestDispatcherFailover(t *testing.T) {
+	data := make([]byte, 10<<10+7)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	bad := newNode(data, func(r *http.Request) bool { return false })
+	defer bad.Close()
+	good := newNode(data, nil)
+	defer good.Close()
+
+	b, err := download(data, 1<<10, 0, bad.URL, good.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("downloaded data does not match")
+	}
+}
+
+func TestDispatcherRetryCap(t *testing.T) {
+	data := make([]byte, 4<<10)
+
+	var (
+		lock     sync.Mutex
+		requests int
+	)
+	bad := newNode(data, func(r *http.Request) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		return false
+	})
+	defer bad.Close()
+
+	if _, err := download(data, 1<<10, 2, bad.URL); err == nil {
+		t.Fatal("expect the download to fail")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests != 3 {
+		t.Fatalf("%d requests are sent, want 3", requests)
+	}
+}
+
+func TestGetFileFails(t *testing.T) {
+	data := make([]byte, 4<<10)
+
+	// only the request of the file size succeeds
+	bad := newNode(data, func(r *http.Request) bool { return r.Header.Get("Range") == "bytes=0-1" })
+	defer bad.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	r := New(1 << 10)
+	r.maxRetries = 2
+	reader, _, err := r.GetFile(ctx, &client.ShareAssetResult{URLs: []string{bad.URL}})
+	if err == nil {
+		reader.Close()
+		t.Fatal("expect GetFile to fail")
+	}
+	if ctx.Err() != nil {
+		t.Fatalf("expect GetFile to fail before the timeout, %v", err)
+	}
+}
+
+func TestDispatcherHedge(t *testing.T) {
+	data := make([]byte, 4<<10)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	slow := newNode(data, func(r *http.Request) bool {
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+		}
+		return true
+	})
+	defer slow.Close()
+	fast := newNode(data, nil)
+	defer fast.Close()
+
+	start := time.Now()
+	b, err := download(data, 1<<10, 0, slow.URL, fast.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Fatal("downloaded data does not match")
+	}
+
+	if cost := time.Since(start); cost > 3*time.Second {
+		t.Fatalf("the range of the slow node is not hedged, cost %s", cost)
+	}
+}
+
+func TestFileSize(t *testing.T) {
+	data := make([]byte, 3000)
+	good := newNode(data, nil)
+	defer good.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"jsonrpc":"2.0","result":{},"id":"1"}`))
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-1")
+		w.WriteHeader(http.StatusPartialContent)
+	}))
+	defer broken.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	size, err := New(1<<10).FileSize(ctx, &client.ShareAssetResult{URLs: []string{good.URL}})
+	if err != nil || size != int64(len(data)) {
+		t.Fatalf("file size %d, %v", size, err)
+	}
+
+	// a malformed Content-Range fails instead of panicking
+	if _, err := New(1<<10).FileSize(ctx, &client.ShareAssetResult{URLs: []string{broken.URL}}); err == nil {
+		t.Fatal("expect a malformed content range to fail")
+	}
+}
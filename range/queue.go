@@ -49,3 +49,21 @@ func (q *JobQueue) Pop() (*job, bool) {
 
 	return item, true
 }
+
+// PopBatch pops up to n jobs of consecutive ranges from the front
+func (q *JobQueue) PopBatch(n int) []*job {
+	q.Lock()
+	defer q.Unlock()
+
+	var jobs []*job
+	for len(q.items) > 0 && len(jobs) < n {
+		item := q.items[0]
+		if len(jobs) > 0 && item.index != jobs[len(jobs)-1].index+1 {
+			break
+		}
+		jobs = append(jobs, item)
+		q.items = q.items[1:]
+	}
+
+	return jobs
+}
@@ -2,7 +2,6 @@ package byterange
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
@@ -21,6 +20,8 @@ import (
 const (
 	minBackoffDelay = 100 * time.Millisecond
 	maxBackoffDelay = 3 * time.Second
+	// pingTimeout limits the version request which checks a node is online
+	pingTimeout = 3 * time.Second
 )
 
 var log = logging.Logger("range")
@@ -28,15 +29,21 @@ var log = logging.Logger("range")
 type Range struct {
 	size int64
 	c    *http.Client
+	opts *client.Options
+	// maxRetries caps the failed requests of a download, defaultMaxRetries if it is 0
+	maxRetries int
 }
 
 func New(size int64) *Range {
+	return NewWithOptions(size, nil)
+}
+
+// NewWithOptions returns a Range which makes the requests to the nodes with the client and timeouts of opts
+func NewWithOptions(size int64, opts *client.Options) *Range {
 	return &Range{
 		size: size,
-		c: &http.Client{
-			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
-			Timeout:   3 * time.Second,
-		},
+		c:    opts.NodeClient(),
+		opts: opts,
 	}
 }
 
@@ -56,7 +63,7 @@ func (r *Range) GetFile(ctx context.Context, resources *client.ShareAssetResult)
 		return nil, 0, err
 	}
 
-	(&dispatcher{
+	d := &dispatcher{
 		fileSize:  fileSize,
 		rangeSize: r.size,
 		reader:    reader,
@@ -67,52 +74,158 @@ func (r *Range) GetFile(ctx context.Context, resources *client.ShareAssetResult)
 			minDelay: minBackoffDelay,
 			maxDelay: maxBackoffDelay,
 		},
-	}).run(ctx)
+		c:          r.c,
+		opts:       r.opts,
+		maxRetries: r.maxRetries,
+	}
+	d.run(ctx)
+
+	// the download stopped by the retry cap or the eviction of all nodes fails here, not on a later read,
+	// closing the reader lets the writer of the pipe exit
+	if d.stopped != nil {
+		reader.Close()
+		return nil, 0, d.stopped
+	}
 
 	return reader, fileSize, nil
 }
 
+// RangeWriter receives the ranges downloaded by WriteFile,
+// the range at index covers [index*size, (index+1)*size) of the file, size is the one passed to New.
+type RangeWriter interface {
+	io.WriterAt
+	// Open is called with the size of the file before any range is written
+	Open(fileSize int64) error
+	// Has reports whether the range at index is already written
+	Has(index int) bool
+	// Done is called after the range at index is written
+	Done(index int) error
+}
+
+// WriteFile downloads the ranges of the file which w does not have yet and writes them to w,
+// it returns the size of the file after all ranges are written.
+func (r *Range) WriteFile(ctx context.Context, resources *client.ShareAssetResult, w RangeWriter) (int64, error) {
+	workerChan, err := r.makeWorkerChan(ctx, resources)
+	if err != nil {
+		return 0, err
+	}
+
+	fileSize, err := r.getFileSize(ctx, workerChan)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := w.Open(fileSize); err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := &dispatcher{
+		fileSize:  fileSize,
+		rangeSize: r.size,
+		writer:    w,
+		workers:   workerChan,
+		resp:      make(chan response, len(workerChan)),
+		backoff: &backoff{
+			minDelay: minBackoffDelay,
+			maxDelay: maxBackoffDelay,
+		},
+		skip:       w.Has,
+		done:       w.Done,
+		c:          r.c,
+		opts:       r.opts,
+		maxRetries: r.maxRetries,
+	}
+	d.run(ctx)
+
+	<-d.written
+	if d.err != nil {
+		return 0, d.err
+	}
+
+	return fileSize, nil
+}
+
+// FileSize returns the size of the file shared by resources without downloading it
+func (r *Range) FileSize(ctx context.Context, resources *client.ShareAssetResult) (int64, error) {
+	workerChan, err := r.makeWorkerChan(ctx, resources)
+	if err != nil {
+		return 0, err
+	}
+	return r.getFileSize(ctx, workerChan)
+}
+
 func (r *Range) getFileSize(ctx context.Context, workerChan chan worker) (int64, error) {
-	var (
-		start int64 = 0
-		size  int64 = 1
-	)
+	// the workers without the size are dropped
+	untried := len(workerChan)
 
 	for {
+		if untried == 0 {
+			return 0, fmt.Errorf("no worker returns the file size")
+		}
+
 		select {
 		case w := <-workerChan:
-			req, err := http.NewRequest("GET", w.e, nil)
-			if err != nil {
-				log.Errorf("new request failed: %v", err)
-				continue
-			}
-			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+size))
-			// resp, err := w.c.Do(req)
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				log.Errorf("fetch failed: %v", err)
-				continue
-			}
-			defer func() {
-				if resp != nil && resp.Body != nil {
-					resp.Body.Close()
-				}
-			}()
-			v := resp.Header.Get("Content-Range")
-			if v != "" {
-				subs := strings.Split(v, "/")
-				if len(subs) != 2 {
-					log.Errorf("invalid content range: %s", v)
+			untried--
+
+			size, ok, err := r.fetchFileSize(ctx, w.e)
+			if !ok {
+				if err != nil {
+					log.Errorf("fetch failed: %v", err)
 				}
-				return strconv.ParseInt(subs[1], 10, 64)
+				continue
 			}
-			//"HTTP/1.1 400 Bad Request\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\n\r\n400 Bad Requestarset=utf-8\r\n\r\n{\"jsonrpc\":\"2.0\",\"result\":{\"Version\":\"0.1.21+git.5b4fc64+linux-amd64\",\"APIVersion\":65536,\"BlockDelay\":0},\"id\":\"1\"}\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00...+3584 more"
+
+			// give the worker back to download the ranges
+			workerChan <- w
+			return size, err
 		case <-ctx.Done():
 			return 0, ctx.Err()
 		}
 	}
 }
 
+// fetchFileSize gets the file size from the Content-Range of the first bytes fetched from endpoint,
+// ok is false if the endpoint does not answer it, so the next worker is tried
+func (r *Range) fetchFileSize(ctx context.Context, endpoint string) (size int64, ok bool, err error) {
+	var start int64 = 0
+	size = 1
+
+	reqCtx, cancel := r.opts.DownloadContext(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, "GET", endpoint, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+size))
+	// resp, err := w.c.Do(req)
+	resp, err := r.c.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	v := resp.Header.Get("Content-Range")
+	if v != "" {
+		subs := strings.Split(v, "/")
+		if len(subs) != 2 {
+			log.Errorf("invalid content range: %s", v)
+			return 0, true, fmt.Errorf("invalid content range: %s", v)
+		}
+		size, err = strconv.ParseInt(subs[1], 10, 64)
+		return size, true, err
+	}
+	// an empty file has no range, it is answered without Content-Range
+	if resp.StatusCode == http.StatusOK && resp.ContentLength == 0 {
+		return 0, true, nil
+	}
+	//"HTTP/1.1 400 Bad Request\r\nContent-Type: text/plain; charset=utf-8\r\nConnection: close\r\n\r\n400 Bad Requestarset=utf-8\r\n\r\n{\"jsonrpc\":\"2.0\",\"result\":{\"Version\":\"0.1.21+git.5b4fc64+linux-amd64\",\"APIVersion\":65536,\"BlockDelay\":0},\"id\":\"1\"}\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00...+3584 more"
+	return 0, false, nil
+}
+
 func (r *Range) makeWorkerChan(ctx context.Context, res *client.ShareAssetResult) (chan worker, error) {
 	workerChan := make(chan worker, len(res.URLs))
 
@@ -127,8 +240,8 @@ func (r *Range) makeWorkerChan(ctx context.Context, res *client.ShareAssetResult
 				// Transport: &http3.RoundTripper{TLSClientConfig: tls.Config{
 				// 	InsecureSkipVerify: true,
 				// }},
-				Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
-				Timeout:   3 * time.Second,
+				Transport: r.c.Transport,
+				Timeout:   pingTimeout,
 			}
 
 			u, err := url.Parse(e)
@@ -144,7 +257,7 @@ func (r *Range) makeWorkerChan(ctx context.Context, res *client.ShareAssetResult
 				Params:  nil,
 			}
 
-			rpcUrl := fmt.Sprintf("%s/rpc/v0", u.Host)
+			rpcUrl := fmt.Sprintf("%s://%s/rpc/v0", u.Scheme, u.Host)
 			_, err = request.PostJsonRPC(client, rpcUrl, req, nil)
 			if err != nil {
 				log.Errorf("send packet failed: %v", err)
@@ -154,6 +267,7 @@ func (r *Range) makeWorkerChan(ctx context.Context, res *client.ShareAssetResult
 			workerChan <- worker{
 				// c: client,
 				e: e,
+				s: &workerStats{},
 			}
 		}(endpoint)
 	}
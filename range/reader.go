@@ -0,0 +1,344 @@
+package byterange
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+const (
+	// defaultCacheBlocks is the number of blocks kept in the cache of a Reader
+	defaultCacheBlocks = 16
+	// defaultReadAhead is the number of blocks fetched ahead of a sequential read
+	defaultReadAhead = 2
+)
+
+var errReaderClosed = errors.New("reader is closed")
+
+// Reader reads a file at any offset by fetching the blocks containing it with range requests.
+// The blocks are kept in a LRU cache, the next blocks are fetched ahead when the file is read in order,
+// and a block is fetched from the next URL if a node fails.
+// ReadAt can be called concurrently, Read and Seek share the offset of the Reader.
+type Reader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	c      *http.Client
+	opts   *client.Options
+
+	urls      []string
+	size      int64
+	blockSize int64
+	maxBlocks int
+	readAhead int
+
+	lock     sync.Mutex
+	current  int
+	cache    *list.List
+	blocks   map[int64]*list.Element
+	inflight map[int64]*blockCall
+	last     int64
+	offset   int64
+	closed   bool
+	// fetched is the number of bytes downloaded
+	fetched int64
+}
+
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+// blockCall is a block being fetched, the readers of the same block wait for it
+type blockCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// Open returns a Reader of the file shared by resources, the blocks are the size passed to New.
+func (r *Range) Open(ctx context.Context, resources *client.ShareAssetResult) (*Reader, error) {
+	workerChan, err := r.makeWorkerChan(ctx, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	fileSize, err := r.getFileSize(ctx, workerChan)
+	if err != nil {
+		return nil, err
+	}
+
+	// the nodes answering first are tried first
+	urls := make([]string, 0, len(workerChan))
+	for len(workerChan) > 0 {
+		urls = append(urls, (<-workerChan).e)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	return &Reader{
+		ctx:       ctx,
+		cancel:    cancel,
+		c:         r.c,
+		opts:      r.opts,
+		urls:      urls,
+		size:      fileSize,
+		blockSize: r.size,
+		maxBlocks: defaultCacheBlocks,
+		readAhead: defaultReadAhead,
+		cache:     list.New(),
+		blocks:    make(map[int64]*list.Element),
+		inflight:  make(map[int64]*blockCall),
+		last:      -1,
+	}, nil
+}
+
+// Size returns the size of the file
+func (rd *Reader) Size() int64 {
+	return rd.size
+}
+
+// ReadAt implements io.ReaderAt
+func (rd *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= rd.size {
+			return n, io.EOF
+		}
+
+		index := pos / rd.blockSize
+		data, err := rd.block(index)
+		if err != nil {
+			return n, err
+		}
+		rd.prefetch(index)
+
+		n += copy(p[n:], data[pos-index*rd.blockSize:])
+	}
+
+	return n, nil
+}
+
+// Read implements io.Reader
+func (rd *Reader) Read(p []byte) (int, error) {
+	rd.lock.Lock()
+	off := rd.offset
+	rd.lock.Unlock()
+
+	n, err := rd.ReadAt(p, off)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	rd.lock.Lock()
+	rd.offset = off + int64(n)
+	rd.lock.Unlock()
+
+	return n, err
+}
+
+// Seek implements io.Seeker
+func (rd *Reader) Seek(offset int64, whence int) (int64, error) {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rd.offset
+	case io.SeekEnd:
+		offset += rd.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+
+	rd.offset = offset
+	return offset, nil
+}
+
+// Fetched returns the number of bytes downloaded so far, the blocks fetched ahead are counted too
+func (rd *Reader) Fetched() int64 {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+
+	return rd.fetched
+}
+
+// Close stops the fetching blocks and drops the cache
+func (rd *Reader) Close() error {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+
+	rd.closed = true
+	rd.cancel()
+	rd.cache.Init()
+	rd.blocks = make(map[int64]*list.Element)
+
+	return nil
+}
+
+// block returns the block at index from the cache, or waits for it to be fetched
+func (rd *Reader) block(index int64) ([]byte, error) {
+	rd.lock.Lock()
+	if rd.closed {
+		rd.lock.Unlock()
+		return nil, errReaderClosed
+	}
+
+	if e, ok := rd.blocks[index]; ok {
+		rd.cache.MoveToFront(e)
+		rd.lock.Unlock()
+		return e.Value.(*cachedBlock).data, nil
+	}
+
+	call := rd.startFetch(index)
+	rd.lock.Unlock()
+
+	select {
+	case <-call.done:
+		return call.data, call.err
+	case <-rd.ctx.Done():
+		return nil, rd.ctx.Err()
+	}
+}
+
+// prefetch fetches the blocks after index if the blocks are read in order
+func (rd *Reader) prefetch(index int64) {
+	rd.lock.Lock()
+	defer rd.lock.Unlock()
+
+	sequential := index == rd.last+1
+	if index != rd.last {
+		rd.last = index
+	}
+	if !sequential || rd.closed {
+		return
+	}
+
+	count := (rd.size + rd.blockSize - 1) / rd.blockSize
+	for i := index + 1; i <= index+int64(rd.readAhead) && i < count; i++ {
+		if _, ok := rd.blocks[i]; !ok {
+			rd.startFetch(i)
+		}
+	}
+}
+
+// startFetch starts fetching the block at index if it is not being fetched, rd.lock must be held
+func (rd *Reader) startFetch(index int64) *blockCall {
+	if call, ok := rd.inflight[index]; ok {
+		return call
+	}
+
+	call := &blockCall{done: make(chan struct{})}
+	rd.inflight[index] = call
+
+	go func() {
+		call.data, call.err = rd.fetch(index)
+
+		rd.lock.Lock()
+		delete(rd.inflight, index)
+		if call.err == nil && !rd.closed {
+			rd.put(index, call.data)
+		}
+		rd.lock.Unlock()
+
+		close(call.done)
+	}()
+
+	return call
+}
+
+// put adds the block to the cache and evicts the least recently used one, rd.lock must be held
+func (rd *Reader) put(index int64, data []byte) {
+	rd.blocks[index] = rd.cache.PushFront(&cachedBlock{index: index, data: data})
+
+	for rd.cache.Len() > rd.maxBlocks {
+		e := rd.cache.Back()
+		rd.cache.Remove(e)
+		delete(rd.blocks, e.Value.(*cachedBlock).index)
+	}
+}
+
+// fetch downloads the block at index, starting with the URL which succeeded last time
+func (rd *Reader) fetch(index int64) ([]byte, error) {
+	start := index * rd.blockSize
+	end := start + rd.blockSize
+	if end > rd.size {
+		end = rd.size
+	}
+
+	rd.lock.Lock()
+	current := rd.current
+	rd.lock.Unlock()
+
+	var err error
+	for i := 0; i < len(rd.urls); i++ {
+		if rd.ctx.Err() != nil {
+			return nil, rd.ctx.Err()
+		}
+
+		u := (current + i) % len(rd.urls)
+
+		var data []byte
+		data, err = rd.fetchRange(rd.urls[u], start, end)
+		if err == nil {
+			rd.lock.Lock()
+			rd.current = u
+			rd.fetched += int64(len(data))
+			rd.lock.Unlock()
+			return data, nil
+		}
+		log.Warnf("fetch block %d from %s failed: %v", index, rd.urls[u], err)
+	}
+
+	return nil, fmt.Errorf("fetch block %d failed: %w", index, err)
+}
+
+// fetchRange downloads the bytes [start, end) from the URL
+func (rd *Reader) fetchRange(url string, start, end int64) ([]byte, error) {
+	ctx, cancel := rd.opts.DownloadContext(rd.ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	resp, err := rd.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the node ignored the range, skip to the start
+		if _, err := io.CopyN(io.Discard, resp.Body, start); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, fmt.Errorf("read data failed: %v", err)
+	}
+
+	return data, nil
+}
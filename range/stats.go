@@ -0,0 +1,84 @@
+package byterange
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxBatch is the number of ranges a fast node fetches in one request at most
+	maxBatch = 8
+	// batchDuration is the time a request of a node should take, the batch grows with the throughput
+	batchDuration = 2 * time.Second
+	// quarantineFailures is the number of consecutive failures which quarantine a node
+	quarantineFailures = 3
+	// quarantineDelay is the time a node waits in the quarantine, it grows every time
+	quarantineDelay = 2 * time.Second
+	// maxQuarantines evicts a node which is quarantined more times
+	maxQuarantines = 3
+)
+
+// workerStats tracks the throughput and the failures of a node
+type workerStats struct {
+	lock        sync.Mutex
+	throughput  float64
+	failures    int
+	quarantines int
+}
+
+// succeed records a request which downloaded size bytes in cost
+func (s *workerStats) succeed(size int64, cost time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = 0
+	if cost <= 0 {
+		cost = time.Millisecond
+	}
+
+	speed := float64(size) / cost.Seconds()
+	if s.throughput == 0 {
+		s.throughput = speed
+	} else {
+		s.throughput = 0.7*s.throughput + 0.3*speed
+	}
+}
+
+// fail records a failed request, it returns how long the node is quarantined
+// and whether the node should be evicted.
+func (s *workerStats) fail() (time.Duration, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures++
+	if s.failures < quarantineFailures {
+		return 0, false
+	}
+
+	s.failures = 0
+	s.quarantines++
+	if s.quarantines > maxQuarantines {
+		return 0, true
+	}
+	return time.Duration(s.quarantines) * quarantineDelay, false
+}
+
+// speed returns the throughput in bytes per second, 0 if it is unknown
+func (s *workerStats) speed() float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.throughput
+}
+
+// batch returns the number of ranges the node should fetch in one request
+func (s *workerStats) batch(rangeSize int64) int {
+	n := int(s.speed() * batchDuration.Seconds() / float64(rangeSize))
+	if n < 1 {
+		return 1
+	}
+	if n > maxBatch {
+		return maxBatch
+	}
+	return n
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	byterange "github.com/Titannet-dao/titan-storage-sdk/range"
+)
+
+// assetBlockSize is the size of the blocks fetched by an AssetReader
+const assetBlockSize = 1 << 20
+
+// ErrEncryptedAsset is returned by OpenAsset for an encrypted asset, it is only decrypted by DownloadAsset and DownloadToFile
+var ErrEncryptedAsset = errors.New("asset is encrypted")
+
+// AssetReader reads an asset at any offset, only the blocks containing the data read are downloaded.
+// It must be closed to stop the blocks fetched ahead.
+type AssetReader interface {
+	io.ReaderAt
+	io.ReadSeeker
+	io.Closer
+	// Size returns the size of the asset
+	Size() int64
+}
+
+// OpenAsset returns an AssetReader of the asset, the blocks are cached and fetched from the next node if one fails
+func (s *storage) OpenAsset(ctx context.Context, assetCID string) (AssetReader, error) {
+	res, err := s.GetURL(ctx, assetCID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.openAsset(ctx, assetCID, res)
+}
+
+// openAsset returns an AssetReader of the asset shared by res,
+// the download is reported with the bytes fetched when the reader is closed
+func (s *storage) openAsset(ctx context.Context, assetCID string, res *client.ShareAssetResult) (AssetReader, error) {
+	start := time.Now()
+
+	reader, err := byterange.NewWithOptions(assetBlockSize, s.opts).Open(ctx, res)
+
+	report := &client.AssetTransferReq{
+		TransferType: client.AssetTransferTypeDownload,
+		Cid:          assetCID,
+		State:        client.AssetTransferStateFailed,
+		TraceID:      res.TraceID,
+	}
+
+	if err != nil {
+		report.CostMs = time.Since(start).Milliseconds()
+		report.Log = err.Error()
+		s.sendTransferReport(report)
+		return nil, err
+	}
+
+	r := &reportedReader{Reader: reader, s: s, report: report, start: start}
+
+	// the ranges of an encrypted asset are ciphertext, fail instead of returning them
+	if encrypted, err := isEncrypted(r); err != nil || encrypted {
+		r.Close()
+		if err == nil {
+			err = fmt.Errorf("open %s: %w", assetCID, ErrEncryptedAsset)
+		}
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// isEncrypted returns if the asset read by r starts with the header of the encrypted data
+func isEncrypted(r AssetReader) (bool, error) {
+	magic := make([]byte, len(encryptMagic))
+	if r.Size() < int64(len(magic)) {
+		return false, nil
+	}
+
+	if _, err := r.ReadAt(magic, 0); err != nil && err != io.EOF {
+		return false, err
+	}
+	return string(magic) == encryptMagic, nil
+}
+
+// reportedReader sends the download report of the bytes it fetched when it is closed
+type reportedReader struct {
+	*byterange.Reader
+	s      *storage
+	report *client.AssetTransferReq
+	start  time.Time
+	once   sync.Once
+}
+
+func (r *reportedReader) Close() error {
+	err := r.Reader.Close()
+
+	r.once.Do(func() {
+		fetched := r.Reader.Fetched()
+		if fetched == 0 {
+			return
+		}
+
+		r.report.TotalSize = fetched
+		r.report.CostMs = time.Since(r.start).Milliseconds()
+		r.report.State = client.AssetTransferStateSuccess
+		r.s.sendTransferReport(r.report)
+	})
+
+	return err
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestOpenAsset(t *testing.T) {
+	data := make([]byte, 5*assetBlockSize+321)
+	rand.New(rand.NewSource(9)).Read(data)
+
+	var (
+		lock   sync.Mutex
+		ranges = make(map[string]int)
+	)
+	// the first node fails every block
+	bad := newFakeNode(data, func(r *http.Request) bool { return r.Header.Get("Range") == "bytes=0-1" })
+	defer bad.Close()
+	good := newFakeNode(data, func(r *http.Request) bool {
+		lock.Lock()
+		defer lock.Unlock()
+		ranges[r.Header.Get("Range")]++
+		return true
+	})
+	defer good.Close()
+
+	web := &fakeWebserver{urls: func() []string { return []string{bad.URL, good.URL} }}
+	s := &storage{webAPI: web}
+	r, err := s.OpenAsset(context.Background(), "cid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Size() != int64(len(data)) {
+		t.Fatalf("size %d, want %d", r.Size(), len(data))
+	}
+
+	// a read across two blocks
+	buf := make([]byte, 1000)
+	off := int64(3*assetBlockSize - 500)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[off:off+1000]) {
+		t.Fatal("ReadAt returns wrong data")
+	}
+
+	// the tail returns io.EOF
+	n, err := r.ReadAt(buf, int64(len(data)-10))
+	if n != 10 || err != io.EOF {
+		t.Fatalf("read %d bytes at the end, %v", n, err)
+	}
+
+	if _, err := r.Seek(100, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data[100:]) {
+		t.Fatal("sequential read returns wrong data")
+	}
+
+	lock.Lock()
+	for rng, count := range ranges {
+		if rng != "bytes=0-1" && count > 1 {
+			t.Fatalf("range %s is fetched %d times", rng, count)
+		}
+	}
+	lock.Unlock()
+
+	// the download is reported with the fetched bytes once the reader is closed
+	web.lock.Lock()
+	reports := len(web.reports)
+	web.lock.Unlock()
+	if reports != 0 {
+		t.Fatalf("expect no report before the reader is closed, got %d", reports)
+	}
+
+	r.Close()
+	r.Close()
+
+	// reports are sent in background
+	time.Sleep(100 * time.Millisecond)
+
+	web.lock.Lock()
+	defer web.lock.Unlock()
+	if len(web.reports) != 1 || web.reports[0].TotalSize != int64(len(data)) || web.reports[0].State != client.AssetTransferStateSuccess {
+		t.Fatalf("unexpected transfer reports %+v", web.reports)
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// UploadResult is what an upload learns about the asset
+type UploadResult struct {
+	// CID is the root of the asset
+	CID cid.Cid
+	// Name is the name of the asset
+	Name string
+	// Size is the size sent to the node, it is the size of the car if the car is made
+	Size int64
+	// NodeID and TraceID are the node which took the upload and the trace of the upload,
+	// they are empty if nothing was sent
+	NodeID  string
+	TraceID string
+	// AlreadyExisted is true if the asset was stored before the upload
+	AlreadyExisted bool
+	// Elapsed is the time of the whole upload
+	Elapsed time.Duration
+	// URL is the share URL of the asset, it is only set for the uploads with UploadShareURL
+	URL string
+	// Attempts are the uploads to every node, the failed ones included
+	Attempts []UploadAttempt
+}
+
+// UploadAttempt is the upload to a node
+type UploadAttempt struct {
+	NodeID  string
+	Elapsed time.Duration
+	// Err is the reason if the upload to the node failed
+	Err error
+}
+
+// UploadError is returned if the upload failed on all nodes, it has the failure of every node
+type UploadError struct {
+	Attempts []UploadAttempt
+	err      error
+}
+
+func (e *UploadError) Error() string {
+	return e.err.Error()
+}
+
+func (e *UploadError) Unwrap() error {
+	return e.err
+}
+
+// resultCID returns the CID of the result, for the methods which return only the CID
+func resultCID(res *UploadResult, err error) (cid.Cid, error) {
+	if err != nil {
+		return cid.Cid{}, err
+	}
+	return res.CID, nil
+}
+
+// newUploadAttempts returns the public details of attempts
+func newUploadAttempts(attempts []*uploadAttempt) []UploadAttempt {
+	ret := make([]UploadAttempt, 0, len(attempts))
+	for _, attempt := range attempts {
+		ret = append(ret, UploadAttempt{NodeID: attempt.target.NodeID, Elapsed: attempt.cost, Err: attempt.err})
+	}
+	return ret
+}
+
+// setAttempts records the node which took the upload and all attempts
+func (res *UploadResult) setAttempts(success *uploadAttempt, attempts []*uploadAttempt) {
+	res.NodeID = success.target.NodeID
+	res.TraceID = success.target.TraceID
+	res.Attempts = newUploadAttempts(attempts)
+}
+
+type shareURLKey struct{}
+
+// WithShareURL returns a context which makes the uploads returning an UploadResult
+// wait for the share URL of the asset and set UploadResult.URL
+//
+// Deprecated: use Upload with UploadShareURL
+func WithShareURL(ctx context.Context) context.Context {
+	return context.WithValue(ctx, shareURLKey{}, true)
+}
+
+// withResult runs the upload and sets the elapsed time and the share URL of its result if o asks for it
+func (s *storage) withResult(ctx context.Context, o *uploadOptions, upload func() (*UploadResult, error)) (*UploadResult, error) {
+	start := time.Now()
+
+	res, err := upload()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.shareURL {
+		share, err := s.GetURL(ctx, res.CID.String())
+		if err != nil {
+			return nil, err
+		}
+		if len(share.URLs) > 0 {
+			res.URL = share.URLs[0]
+		}
+	}
+
+	res.Elapsed = time.Since(start)
+	return res, nil
+}
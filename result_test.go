@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestUploadResult(t *testing.T) {
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(18)).Read(data)
+
+	root, err := CalculateCid(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "disk full", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, _ := CalculateCid(f)
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: c.String()})
+	}))
+	defer good.Close()
+
+	nodes := []*client.NodeUploadInfo{{UploadURL: bad.URL, NodeID: "bad"}, {UploadURL: good.URL, NodeID: "good"}}
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return []*client.Endpoint{{}} },
+		nodes:     func() []*client.NodeUploadInfo { return nodes },
+		urls:      func() []string { return []string{"https://node/ipfs/" + root.String()} },
+	}
+	s := &storage{webAPI: web}
+
+	res, err := s.Upload(context.Background(), ReaderSource(bytes.NewReader(data)), UploadName("data.bin"), UploadShareURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.CID.Equals(root) || res.Name != "data.bin" || res.Size != int64(len(data)) || res.AlreadyExisted {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if res.NodeID != "good" || res.Elapsed <= 0 || res.URL != "https://node/ipfs/"+root.String() {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if len(res.Attempts) != 2 || res.Attempts[0].NodeID != "bad" || res.Attempts[0].Err == nil || res.Attempts[1].Err != nil {
+		t.Fatalf("unexpected attempts %+v", res.Attempts)
+	}
+
+	// the error of a failed upload has the attempts of all nodes
+	nodes = []*client.NodeUploadInfo{{UploadURL: bad.URL, NodeID: "bad1"}, {UploadURL: bad.URL, NodeID: "bad2"}}
+	_, err = s.UploadStreamWithResult(context.Background(), bytes.NewReader(data), "data.bin", nil)
+
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) {
+		t.Fatalf("expect an UploadError, got %v", err)
+	}
+	if len(uploadErr.Attempts) != 2 || uploadErr.Attempts[1].NodeID != "bad2" || uploadErr.Attempts[1].Err == nil {
+		t.Fatalf("unexpected attempts %+v", uploadErr.Attempts)
+	}
+}
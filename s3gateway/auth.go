@@ -0,0 +1,468 @@
+package s3gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	scopeDateFormat = "20060102"
+	defaultRegion   = "us-east-1"
+
+	unsignedPayload          = "UNSIGNED-PAYLOAD"
+	streamingPayload         = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	streamingUnsignedTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+
+	// maxClockSkew is the max difference between the time of a signed request and the time of the gateway
+	maxClockSkew = 15 * time.Minute
+	// maxPresignExpires is the max validity of a presigned url, 7 days
+	maxPresignExpires = 7 * 24 * time.Hour
+	// maxChunkSize limits the memory used by a chunk of an aws-chunked body
+	maxChunkSize = 16 << 20
+)
+
+// emptySHA256 is the sha256 of an empty payload
+var emptySHA256 = sha256Hex(nil)
+
+// Credentials are the keys accepted by the gateway, they are loaded from a local file by LoadCredentials
+type Credentials struct {
+	// Region is the region in the signatures of the clients, default is us-east-1
+	Region string `json:"region"`
+	// Keys maps the access key ids to their secret keys
+	Keys map[string]string `json:"keys"`
+}
+
+// LoadCredentials loads the credentials from the JSON file at path, e.g.
+//
+//	{"region": "us-east-1", "keys": {"AKIATITANEXAMPLE": "secret"}}
+func LoadCredentials(path string) (*Credentials, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := &Credentials{}
+	if err = json.Unmarshal(buf, creds); err != nil {
+		return nil, fmt.Errorf("parse credentials %s failed: %v", path, err)
+	}
+
+	if len(creds.Keys) == 0 {
+		return nil, fmt.Errorf("credentials %s have no keys", path)
+	}
+
+	return creds, nil
+}
+
+func (c *Credentials) region() string {
+	if len(c.Region) == 0 {
+		return defaultRegion
+	}
+	return c.Region
+}
+
+// signature is the checked signature of a request
+type signature struct {
+	accessKey     string
+	date          time.Time
+	scope         string
+	signedHeaders []string
+	signature     string
+	// payload is x-amz-content-sha256, it is UNSIGNED-PAYLOAD for the presigned urls
+	payload string
+	// key is the signing key, it checks the signatures of the chunks
+	key []byte
+}
+
+// authenticate checks the signature in the Authorization header or in the query of a presigned url
+func (g *Gateway) authenticate(r *http.Request) (*signature, error) {
+	var (
+		sig *signature
+		err error
+	)
+
+	query := r.URL.Query()
+	switch {
+	case strings.HasPrefix(r.Header.Get("Authorization"), signAlgorithm+" "):
+		sig, err = g.parseAuthorization(r)
+	case query.Get("X-Amz-Algorithm") == signAlgorithm:
+		sig, err = g.parsePresigned(r, query)
+	case len(r.Header.Get("Authorization")) > 0 || query.Has("X-Amz-Algorithm"):
+		return nil, errNotImplemented
+	default:
+		return nil, errAccessDenied
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := g.creds.Keys[sig.accessKey]
+	if !ok {
+		return nil, errInvalidAccessKeyID
+	}
+
+	region := g.creds.region()
+	sig.scope = strings.Join([]string{sig.date.Format(scopeDateFormat), region, "s3", "aws4_request"}, "/")
+	sig.key = signingKey(secret, sig.date.Format(scopeDateFormat), region, "s3")
+
+	canonical := canonicalRequest(r, sig.signedHeaders, sig.payload)
+	want := hex.EncodeToString(hmacSHA256(sig.key, []byte(stringToSign(sig.date, sig.scope, canonical))))
+	if !hmac.Equal([]byte(want), []byte(sig.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+
+	return sig, nil
+}
+
+// parseAuthorization parses a header like
+// AWS4-HMAC-SHA256 Credential=AK/20260101/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-date, Signature=hex
+func (g *Gateway) parseAuthorization(r *http.Request) (*signature, error) {
+	fields := make(map[string]string)
+	for _, field := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), signAlgorithm+" "), ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(field), "=")
+		if !ok {
+			return nil, errMalformedAuth
+		}
+		fields[k] = v
+	}
+
+	payload := r.Header.Get("x-amz-content-sha256")
+	if len(payload) == 0 {
+		return nil, errMissingContentSHA256
+	}
+
+	sig := &signature{signature: fields["Signature"], payload: payload}
+	if err := g.parseScope(sig, fields["Credential"], fields["SignedHeaders"], errMalformedAuth); err != nil {
+		return nil, err
+	}
+
+	amzDate := r.Header.Get("x-amz-date")
+	if len(amzDate) == 0 {
+		amzDate = r.Header.Get("Date")
+	}
+	date, err := time.Parse(amzDateFormat, amzDate)
+	if err != nil {
+		if date, err = http.ParseTime(amzDate); err != nil {
+			return nil, errAccessDenied
+		}
+	}
+
+	if date.Format(scopeDateFormat) != sig.date.Format(scopeDateFormat) {
+		return nil, errMalformedAuth
+	}
+	sig.date = date
+
+	if skew := g.now().Sub(date); skew > maxClockSkew || skew < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	return sig, nil
+}
+
+// parsePresigned parses the X-Amz-* parameters of a presigned url
+func (g *Gateway) parsePresigned(r *http.Request, query url.Values) (*signature, error) {
+	sig := &signature{signature: query.Get("X-Amz-Signature"), payload: unsignedPayload}
+	if err := g.parseScope(sig, query.Get("X-Amz-Credential"), query.Get("X-Amz-SignedHeaders"), errMalformedPresign); err != nil {
+		return nil, err
+	}
+
+	date, err := time.Parse(amzDateFormat, query.Get("X-Amz-Date"))
+	if err != nil || date.Format(scopeDateFormat) != sig.date.Format(scopeDateFormat) {
+		return nil, errMalformedPresign
+	}
+	sig.date = date
+
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	expires := time.Duration(seconds) * time.Second
+	if err != nil || expires <= 0 || expires > maxPresignExpires {
+		return nil, errMalformedPresign
+	}
+
+	now := g.now()
+	if now.Before(date.Add(-maxClockSkew)) {
+		return nil, errRequestTimeTooSkewed
+	}
+	if now.After(date.Add(expires)) {
+		return nil, errExpiredRequest
+	}
+
+	return sig, nil
+}
+
+// parseScope sets the access key, date and signed headers of sig, the region and service of the scope must be ours
+func (g *Gateway) parseScope(sig *signature, credential, signedHeaders string, malformed error) error {
+	parts := strings.Split(credential, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" || len(sig.signature) == 0 || len(signedHeaders) == 0 {
+		return malformed
+	}
+
+	if parts[2] != g.creds.region() || parts[3] != "s3" {
+		return malformed
+	}
+
+	date, err := time.Parse(scopeDateFormat, parts[1])
+	if err != nil {
+		return malformed
+	}
+
+	sig.accessKey = parts[0]
+	sig.date = date
+	sig.signedHeaders = strings.Split(signedHeaders, ";")
+
+	// the host must be signed
+	for _, header := range sig.signedHeaders {
+		if header == "host" {
+			return nil
+		}
+	}
+	return malformed
+}
+
+// canonicalRequest returns the canonical request of r which is signed by the client
+func canonicalRequest(r *http.Request, signedHeaders []string, payload string) string {
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		case "transfer-encoding":
+			values = append([]string(nil), r.TransferEncoding...)
+		default:
+			values = append([]string(nil), r.Header.Values(name)...)
+		}
+
+		for i := range values {
+			values[i] = strings.Join(strings.Fields(values[i]), " ")
+		}
+		headers.WriteString(name + ":" + strings.Join(values, ",") + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payload,
+	}, "\n")
+}
+
+// canonicalQuery returns the sorted and encoded query without the signature
+func canonicalQuery(query url.Values) string {
+	var params []string
+	for k, values := range query {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range values {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// uriEncode encodes s like the signers of AWS, only the unreserved characters are kept
+// and the slashes if encodeSlash is false
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func stringToSign(date time.Time, scope, canonicalRequest string) string {
+	return strings.Join([]string{signAlgorithm, date.Format(amzDateFormat), scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), []byte(date))
+	key = hmacSHA256(key, []byte(region))
+	key = hmacSHA256(key, []byte(service))
+	return hmacSHA256(key, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// payloadReader returns the body of r decoded and checked against the payload of the signature,
+// the reader returns an *apiError if the body does not match
+func (sig *signature) payloadReader(r *http.Request) (io.Reader, error) {
+	switch sig.payload {
+	case unsignedPayload:
+		return r.Body, nil
+	case streamingPayload, streamingUnsignedTrailer:
+		size, err := strconv.ParseInt(r.Header.Get("x-amz-decoded-content-length"), 10, 64)
+		if err != nil || size < 0 {
+			return nil, newError(http.StatusLengthRequired, "MissingContentLength", "You must provide the x-amz-decoded-content-length HTTP header.")
+		}
+
+		c := &chunkReader{r: bufio.NewReader(r.Body), size: size}
+		if sig.payload == streamingPayload {
+			c.sig, c.prev = sig, sig.signature
+		}
+		return c, nil
+	}
+
+	want, err := hex.DecodeString(sig.payload)
+	if err != nil || len(want) != sha256.Size {
+		return nil, errContentSHA256Mismatch
+	}
+	return &hashReader{r: r.Body, h: sha256.New(), want: want, err: errContentSHA256Mismatch}, nil
+}
+
+// hashReader returns err at the end of r if the hash of r is not want
+type hashReader struct {
+	r    io.Reader
+	h    hash.Hash
+	want []byte
+	err  error
+}
+
+func (hr *hashReader) Read(p []byte) (int, error) {
+	n, err := hr.r.Read(p)
+	hr.h.Write(p[:n])
+	if err == io.EOF && !bytes.Equal(hr.h.Sum(nil), hr.want) {
+		return n, hr.err
+	}
+	return n, err
+}
+
+// chunkReader decodes an aws-chunked body, the signature of every chunk is checked if sig is set,
+// the trailers of an unsigned body are skipped.
+type chunkReader struct {
+	r    *bufio.Reader
+	sig  *signature
+	prev string
+	// size is x-amz-decoded-content-length, read is the decoded size
+	size int64
+	read int64
+	buf  []byte
+	err  error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.buf, c.err = c.next()
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// next returns the data of the next chunk, it returns io.EOF after the last chunk
+func (c *chunkReader) next() ([]byte, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	sizeHex, ext, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(sizeHex, 16, 64)
+	if err != nil || size < 0 || size > maxChunkSize {
+		return nil, errInvalidChunk
+	}
+
+	data := make([]byte, size)
+	if _, err = io.ReadFull(c.r, data); err != nil {
+		return nil, errIncompleteBody
+	}
+
+	if c.sig != nil {
+		chunkSig, ok := strings.CutPrefix(ext, "chunk-signature=")
+		if !ok {
+			return nil, errInvalidChunk
+		}
+
+		toSign := strings.Join([]string{signAlgorithm + "-PAYLOAD", c.sig.date.Format(amzDateFormat), c.sig.scope, c.prev, emptySHA256, sha256Hex(data)}, "\n")
+		want := hex.EncodeToString(hmacSHA256(c.sig.key, []byte(toSign)))
+		if !hmac.Equal([]byte(want), []byte(chunkSig)) {
+			return nil, errSignatureDoesNotMatch
+		}
+		c.prev = chunkSig
+	}
+
+	c.read += size
+	if c.read > c.size {
+		return nil, errIncompleteBody
+	}
+
+	if size > 0 {
+		if line, err = c.readLine(); err != nil || len(line) > 0 {
+			return nil, errInvalidChunk
+		}
+		return data, nil
+	}
+
+	// the last chunk, the trailers end with an empty line
+	for {
+		if line, err = c.readLine(); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			break
+		}
+		if c.sig != nil {
+			return nil, errInvalidChunk
+		}
+	}
+
+	if c.read != c.size {
+		return nil, errIncompleteBody
+	}
+	return nil, io.EOF
+}
+
+// readLine reads a line ending with CRLF, the lines longer than the buffer are invalid
+func (c *chunkReader) readLine() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	switch {
+	case err == io.EOF:
+		return "", errIncompleteBody
+	case err == bufio.ErrBufferFull || !bytes.HasSuffix(line, []byte("\r\n")):
+		return "", errInvalidChunk
+	case err != nil:
+		return "", err
+	}
+	return string(line[:len(line)-2]), nil
+}
@@ -0,0 +1,349 @@
+package s3gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	storage "github.com/Titannet-dao/titan-storage-sdk"
+)
+
+const (
+	s3Namespace = "http://s3.amazonaws.com/doc/2006-03-01/"
+	// listTimeFormat is the format of the times in the XML responses
+	listTimeFormat = "2006-01-02T15:04:05.000Z"
+	// maxListKeys is the max number of keys returned by a list
+	maxListKeys = 1000
+)
+
+type owner struct {
+	ID          string `xml:"ID"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+type bucketInfo struct {
+	Name         string `xml:"Name"`
+	CreationDate string `xml:"CreationDate"`
+}
+
+type listAllMyBucketsResult struct {
+	XMLName xml.Name     `xml:"ListAllMyBucketsResult"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Owner   owner        `xml:"Owner"`
+	Buckets []bucketInfo `xml:"Buckets>Bucket"`
+}
+
+type locationConstraint struct {
+	XMLName  xml.Name `xml:"LocationConstraint"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:",chardata"`
+}
+
+type objectInfo struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	EncodingType          string         `xml:"EncodingType,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Contents              []objectInfo   `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listItem is an object or a common prefix of a list, entry is nil for a common prefix
+type listItem struct {
+	key   string
+	entry *storage.PathEntry
+}
+
+// bucket returns the folder of the bucket
+func (g *Gateway) bucket(ctx context.Context, bucket string) (*storage.PathEntry, error) {
+	entry, err := g.backend.Stat(ctx, "/"+bucket)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, errNoSuchBucket
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.IsFolder() {
+		return nil, errNoSuchBucket
+	}
+	return entry, nil
+}
+
+// listBuckets lists the top level folders
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *http.Request) error {
+	entries, err := g.backend.ReadDir(r.Context(), "/")
+	if err != nil {
+		return err
+	}
+
+	res := &listAllMyBucketsResult{Xmlns: s3Namespace, Owner: owner{ID: "titan", DisplayName: "titan"}}
+	for _, entry := range entries {
+		if entry.IsFolder() {
+			res.Buckets = append(res.Buckets, bucketInfo{Name: entry.Name(), CreationDate: formatTime(entry.ModTime())})
+		}
+	}
+
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+func (g *Gateway) headBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if _, err := g.bucket(r.Context(), bucket); err != nil {
+		return err
+	}
+
+	w.Header().Set("x-amz-bucket-region", g.creds.region())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (g *Gateway) getBucketLocation(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if _, err := g.bucket(r.Context(), bucket); err != nil {
+		return err
+	}
+
+	// the location of us-east-1 is empty
+	res := &locationConstraint{Xmlns: s3Namespace}
+	if region := g.creds.region(); region != defaultRegion {
+		res.Location = region
+	}
+
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+// createBucket creates the top level folder, it succeeds if the folder exists
+func (g *Gateway) createBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	if _, err := g.backend.MkdirAll(r.Context(), "/"+bucket); err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteBucket deletes the top level folder if it is empty
+func (g *Gateway) deleteBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	ctx := r.Context()
+	if _, err := g.bucket(ctx, bucket); err != nil {
+		return err
+	}
+
+	entries, err := g.backend.ReadDir(ctx, "/"+bucket)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return errBucketNotEmpty
+	}
+
+	if err = g.backend.Remove(ctx, "/"+bucket); err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listObjectsV2 lists the keys of the bucket, the folders are walked to list the keys without delimiter
+func (g *Gateway) listObjectsV2(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+
+	maxKeys := maxListKeys
+	if v := query.Get("max-keys"); len(v) > 0 {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return newError(http.StatusBadRequest, "InvalidArgument", "Provided max-keys not an integer or within integer range.")
+		}
+		maxKeys = min(n, maxListKeys)
+	}
+
+	encoding := query.Get("encoding-type")
+	if len(encoding) > 0 && encoding != "url" {
+		return newError(http.StatusBadRequest, "InvalidArgument", "Invalid Encoding Method specified in Request.")
+	}
+
+	// the keys after marker are listed, the continuation token is the last key of the previous page
+	marker := query.Get("start-after")
+	token := query.Get("continuation-token")
+	if len(token) > 0 {
+		buf, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return newError(http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect.")
+		}
+		marker = string(buf)
+	}
+
+	ctx := r.Context()
+	if _, err := g.bucket(ctx, bucket); err != nil {
+		return err
+	}
+
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	items, err := g.listKeys(ctx, bucket, prefix, delimiter)
+	if err != nil {
+		return err
+	}
+
+	encode := func(s string) string {
+		if encoding == "url" {
+			return uriEncode(s, false)
+		}
+		return s
+	}
+
+	res := &listBucketResult{
+		Xmlns:             s3Namespace,
+		Name:              bucket,
+		Prefix:            encode(prefix),
+		Delimiter:         encode(delimiter),
+		StartAfter:        encode(query.Get("start-after")),
+		ContinuationToken: token,
+		EncodingType:      encoding,
+		MaxKeys:           maxKeys,
+	}
+
+	last := ""
+	for _, item := range items {
+		if item.key <= marker || maxKeys == 0 {
+			continue
+		}
+
+		if res.KeyCount == maxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+
+		if item.entry == nil {
+			res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: encode(item.key)})
+		} else {
+			res.Contents = append(res.Contents, objectInfo{
+				Key:          encode(item.key),
+				LastModified: formatTime(item.entry.ModTime()),
+				ETag:         etag(item.entry.CID()),
+				Size:         item.entry.Size(),
+				StorageClass: "STANDARD",
+			})
+		}
+		res.KeyCount++
+		last = item.key
+	}
+
+	writeXML(w, http.StatusOK, res)
+	return nil
+}
+
+// listKeys returns the sorted objects and common prefixes of the keys starting with prefix
+func (g *Gateway) listKeys(ctx context.Context, bucket, prefix, delimiter string) ([]listItem, error) {
+	// the deepest folder containing all the keys of the prefix
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	if len(dir) > 0 && !validKey(dir) {
+		return nil, nil
+	}
+
+	var items []listItem
+	err := g.collectKeys(ctx, bucket, dir, prefix, delimiter == "/", &items)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the keys containing another delimiter are rolled up after the walk
+	if len(delimiter) > 0 && delimiter != "/" {
+		for i, item := range items {
+			if n := strings.Index(item.key[len(prefix):], delimiter); n >= 0 {
+				items[i] = listItem{key: item.key[:len(prefix)+n+len(delimiter)]}
+			}
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].key < items[j].key
+	})
+
+	// a common prefix is listed once
+	keys := items[:0]
+	for i, item := range items {
+		if i > 0 && item.entry == nil && items[i-1].entry == nil && item.key == items[i-1].key {
+			continue
+		}
+		keys = append(keys, item)
+	}
+	return keys, nil
+}
+
+// collectKeys adds the keys of the folder dir starting with prefix to items, the subfolders are walked
+// unless shallow is true, then they are added as common prefixes.
+func (g *Gateway) collectKeys(ctx context.Context, bucket, dir, prefix string, shallow bool, items *[]listItem) error {
+	entries, err := g.backend.ReadDir(ctx, objectPath(bucket, dir))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		key := dir + entry.Name()
+		if !entry.IsFolder() {
+			if strings.HasPrefix(key, prefix) {
+				*items = append(*items, listItem{key: key, entry: entry})
+			}
+			continue
+		}
+
+		key += "/"
+		if shallow {
+			if strings.HasPrefix(key, prefix) {
+				*items = append(*items, listItem{key: key})
+			}
+			continue
+		}
+
+		if strings.HasPrefix(key, prefix) || strings.HasPrefix(prefix, key) {
+			if err = g.collectKeys(ctx, bucket, key, prefix, false, items); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(listTimeFormat)
+}
+
+// etag returns the ETag of a stored asset, the md5 of the content is not kept so it is the cid
+func etag(assetCID string) string {
+	return `"` + assetCID + `"`
+}
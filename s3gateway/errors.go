@@ -0,0 +1,96 @@
+package s3gateway
+
+import (
+	"encoding/xml"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// apiError is an error returned to the client with its S3 code
+type apiError struct {
+	status  int
+	code    string
+	message string
+}
+
+func newError(status int, code, message string) *apiError {
+	return &apiError{status: status, code: code, message: message}
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+var (
+	errAccessDenied          = newError(http.StatusForbidden, "AccessDenied", "Access Denied.")
+	errInvalidAccessKeyID    = newError(http.StatusForbidden, "InvalidAccessKeyId", "The access key Id you provided does not exist in our records.")
+	errSignatureDoesNotMatch = newError(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.")
+	errRequestTimeTooSkewed  = newError(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.")
+	errExpiredRequest        = newError(http.StatusForbidden, "AccessDenied", "Request has expired.")
+	errMalformedAuth         = newError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "The authorization header is malformed.")
+	errMalformedPresign      = newError(http.StatusBadRequest, "AuthorizationQueryParametersError", "The authorization query parameters are malformed.")
+	errMissingContentSHA256  = newError(http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256.")
+	errContentSHA256Mismatch = newError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.")
+	errBadDigest             = newError(http.StatusBadRequest, "BadDigest", "The Content-MD5 you specified did not match what we received.")
+	errInvalidDigest         = newError(http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified is not valid.")
+	errIncompleteBody        = newError(http.StatusBadRequest, "IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.")
+	errInvalidChunk          = newError(http.StatusBadRequest, "InvalidRequest", "The aws-chunked body is malformed.")
+	errMalformedXML          = newError(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.")
+	errNoSuchBucket          = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+	errNoSuchKey             = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+	errNoSuchUpload          = newError(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist.")
+	errBucketNotEmpty        = newError(http.StatusConflict, "BucketNotEmpty", "The bucket you tried to delete is not empty.")
+	errInvalidPart           = newError(http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found.")
+	errInvalidPartOrder      = newError(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order.")
+	errInvalidObjectState    = newError(http.StatusForbidden, "InvalidObjectState", "The object is encrypted, it can not be read through the gateway.")
+	errOperationAborted      = newError(http.StatusConflict, "OperationAborted", "A conflicting conditional operation is currently in progress against this resource. Please try again.")
+	errMethodNotAllowed      = newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed against this resource.")
+	errNotImplemented        = newError(http.StatusNotImplemented, "NotImplemented", "A header or query you provided implies functionality that is not implemented.")
+	errInternal              = newError(http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+)
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// writeError writes err as an S3 error, the errors other than apiError are logged and returned as InternalError
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var e *apiError
+	if !errors.As(err, &e) {
+		log.Printf("%s %s failed: %s", r.Method, r.URL.Path, err.Error())
+		e = errInternal
+	}
+
+	// the response of HEAD has no body
+	if r.Method == http.MethodHead {
+		w.WriteHeader(e.status)
+		return
+	}
+
+	writeXML(w, e.status, &errorResponse{
+		Code:      e.code,
+		Message:   e.message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("x-amz-request-id"),
+	})
+}
+
+// writeXML writes v as the XML body of the response
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	buf, err := xml.Marshal(v)
+	if err != nil {
+		log.Printf("marshal response failed: %s", err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(buf)
+}
@@ -0,0 +1,189 @@
+// Package s3gateway serves the titan storage of a user through the S3 API, so the tools which only
+// speak S3 can use it. The buckets are the top level folders and the object keys are the paths
+// of the assets in them, e.g. the key photos/2026/a.jpg of the bucket backup is /backup/photos/2026/a.jpg.
+//
+// The requests are path-style, e.g. http://localhost:9000/backup/photos/2026/a.jpg, and signed with
+// AWS Signature Version 4 by one of the keys of the Credentials.
+package s3gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	storage "github.com/Titannet-dao/titan-storage-sdk"
+)
+
+// maxKeyLength is the max length of an object key
+const maxKeyLength = 1024
+
+// Backend is the part of the titan storage used by the gateway, NewBackend returns it for a storage.Storage
+type Backend interface {
+	Stat(ctx context.Context, p string) (*storage.PathEntry, error)
+	ReadDir(ctx context.Context, p string) ([]*storage.PathEntry, error)
+	MkdirAll(ctx context.Context, p string) (int, error)
+	Remove(ctx context.Context, p string) error
+	DeleteAsset(ctx context.Context, assetCID string) error
+	// OpenAsset returns a reader of the asset which reads it by ranges
+	OpenAsset(ctx context.Context, assetCID string) (storage.AssetReader, error)
+	// Put uploads the data of r as the asset at path p, the missing folders of p are created
+	Put(ctx context.Context, p string, r io.Reader) (*storage.UploadResult, error)
+}
+
+type storageBackend struct {
+	storage.Storage
+}
+
+// NewBackend returns the Backend of s, the objects are streamed into s by Upload
+func NewBackend(s storage.Storage) Backend {
+	return storageBackend{Storage: s}
+}
+
+func (b storageBackend) Put(ctx context.Context, p string, r io.Reader) (*storage.UploadResult, error) {
+	dir, name := path.Split(p)
+	return b.Upload(ctx, storage.ReaderSource(r), storage.UploadName(name), storage.UploadFolderPath(dir, true))
+}
+
+// Gateway is the http.Handler of the S3 API
+type Gateway struct {
+	backend Backend
+	creds   *Credentials
+	// now is the time the signatures are checked with
+	now func() time.Time
+
+	lock    sync.Mutex
+	uploads map[string]*multipartUpload
+}
+
+// New returns a Gateway of backend, the requests must be signed by one of the keys of creds
+func New(backend Backend, creds *Credentials) *Gateway {
+	return &Gateway{backend: backend, creds: creds, now: time.Now, uploads: make(map[string]*multipartUpload)}
+}
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("x-amz-request-id", newID(8))
+	w.Header().Set("Server", "TitanS3Gateway")
+
+	sig, err := g.authenticate(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if err = g.route(w, r, sig, bucket, key); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+// route calls the handler of the request
+func (g *Gateway) route(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) error {
+	query := r.URL.Query()
+
+	if len(bucket) == 0 {
+		if r.Method != http.MethodGet {
+			return errMethodNotAllowed
+		}
+		return g.listBuckets(w, r)
+	}
+
+	if !validBucket(bucket) {
+		return newError(http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid.")
+	}
+
+	if len(key) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			if query.Has("location") {
+				return g.getBucketLocation(w, r, bucket)
+			}
+			if query.Get("list-type") == "2" {
+				return g.listObjectsV2(w, r, bucket)
+			}
+			return errNotImplemented
+		case http.MethodHead:
+			return g.headBucket(w, r, bucket)
+		case http.MethodPut:
+			return g.createBucket(w, r, bucket)
+		case http.MethodDelete:
+			return g.deleteBucket(w, r, bucket)
+		}
+		return errMethodNotAllowed
+	}
+
+	if !validKey(key) {
+		return newError(http.StatusBadRequest, "InvalidArgument", "The object key can not be mapped to a path.")
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		return g.getObject(w, r, bucket, key)
+	case http.MethodHead:
+		return g.headObject(w, r, bucket, key)
+	case http.MethodPut:
+		if len(r.Header.Get("x-amz-copy-source")) > 0 {
+			return errNotImplemented
+		}
+		if query.Has("uploadId") {
+			return g.uploadPart(w, r, sig, bucket, key)
+		}
+		return g.putObject(w, r, sig, bucket, key)
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			return g.abortMultipartUpload(w, r, bucket, key)
+		}
+		return g.deleteObject(w, r, bucket, key)
+	case http.MethodPost:
+		if query.Has("uploads") {
+			return g.createMultipartUpload(w, r, bucket, key)
+		}
+		if query.Has("uploadId") {
+			return g.completeMultipartUpload(w, r, bucket, key)
+		}
+		return errNotImplemented
+	}
+
+	return errMethodNotAllowed
+}
+
+// validBucket reports whether bucket is the name of a top level folder
+func validBucket(bucket string) bool {
+	return len(bucket) <= 255 && bucket != "." && bucket != ".."
+}
+
+// validKey reports whether key is a path below the bucket,
+// a key ending with a slash is a folder
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+
+	names := strings.Split(strings.TrimSuffix(key, "/"), "/")
+	for _, name := range names {
+		if name == "" || name == "." || name == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// objectPath returns the path of the key in the bucket
+func objectPath(bucket, key string) string {
+	return "/" + bucket + "/" + key
+}
+
+func newID(n int) string {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("generate id failed: %s", err.Error())
+	}
+	return strings.ToUpper(hex.EncodeToString(buf))
+}
@@ -0,0 +1,329 @@
+package s3gateway
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// maxParts is the max number of parts of a multipart upload
+	maxParts = 10000
+	// maxCompleteBody limits the size of the body of CompleteMultipartUpload
+	maxCompleteBody = 4 << 20
+)
+
+// multipartUpload keeps the parts in a temporary folder until the upload is completed,
+// then they are streamed into one asset.
+type multipartUpload struct {
+	bucket string
+	key    string
+	dir    string
+
+	lock sync.Mutex
+	// etags are the md5 of the parts by their numbers
+	etags map[int]string
+	// completing is set while the parts are streamed into the asset, the parts can not be changed then
+	completing bool
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Location string   `xml:"Location"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	ETag     string   `xml:"ETag"`
+}
+
+func (u *multipartUpload) partPath(number int) string {
+	return filepath.Join(u.dir, strconv.Itoa(number))
+}
+
+// upload returns the multipart upload of the request
+func (g *Gateway) upload(r *http.Request, bucket, key string) (*multipartUpload, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	u, ok := g.uploads[r.URL.Query().Get("uploadId")]
+	if !ok || u.bucket != bucket || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+// removeUpload forgets the upload and deletes its parts
+func (g *Gateway) removeUpload(id string, u *multipartUpload) {
+	g.lock.Lock()
+	delete(g.uploads, id)
+	g.lock.Unlock()
+
+	if err := os.RemoveAll(u.dir); err != nil {
+		log.Printf("remove the parts of upload %s failed: %s", id, err.Error())
+	}
+}
+
+func (g *Gateway) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if strings.HasSuffix(key, "/") {
+		return newError(http.StatusBadRequest, "InvalidArgument", "A folder can not be uploaded in parts.")
+	}
+
+	if _, err := g.bucket(r.Context(), bucket); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "titan-s3-parts-*")
+	if err != nil {
+		return err
+	}
+
+	id := newID(16)
+	g.lock.Lock()
+	g.uploads[id] = &multipartUpload{bucket: bucket, key: key, dir: dir, etags: make(map[int]string)}
+	g.lock.Unlock()
+
+	writeXML(w, http.StatusOK, &initiateMultipartUploadResult{Xmlns: s3Namespace, Bucket: bucket, Key: key, UploadID: id})
+	return nil
+}
+
+// uploadPart saves the part into the temporary folder of the upload, a part uploaded again replaces the old one
+func (g *Gateway) uploadPart(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) error {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > maxParts {
+		return newError(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive.")
+	}
+
+	u, err := g.upload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	body, err := newBodyReader(r, sig)
+	if err != nil {
+		return err
+	}
+
+	// the part is renamed once it is complete, so a failed upload of the part keeps the old one
+	f, err := os.CreateTemp(u.dir, "part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return body.failed(err)
+	}
+
+	sum := hex.EncodeToString(body.md5.Sum(nil))
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.completing {
+		return errOperationAborted
+	}
+
+	if err = os.Rename(f.Name(), u.partPath(number)); err != nil {
+		return err
+	}
+	u.etags[number] = sum
+
+	w.Header().Set("ETag", `"`+sum+`"`)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// completeMultipartUpload streams the listed parts into the asset of the key
+func (g *Gateway) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	u, err := g.upload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	req := &completeMultipartUpload{}
+	if err = xml.NewDecoder(io.LimitReader(r.Body, maxCompleteBody)).Decode(req); err != nil || len(req.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	numbers, sums, err := u.beginComplete(req.Parts)
+	if err != nil {
+		return err
+	}
+
+	parts := &partsReader{u: u, numbers: numbers}
+	defer parts.Close()
+
+	res, err := g.put(r.Context(), bucket, key, parts)
+	if err != nil {
+		u.lock.Lock()
+		u.completing = false
+		u.lock.Unlock()
+		return err
+	}
+
+	g.removeUpload(r.URL.Query().Get("uploadId"), u)
+
+	w.Header().Set(cidHeader, res.CID.String())
+	writeXML(w, http.StatusOK, &completeMultipartUploadResult{
+		Xmlns:    s3Namespace,
+		Location: objectPath(bucket, key),
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     multipartETag(sums),
+	})
+	return nil
+}
+
+// beginComplete checks the listed parts and marks the upload as completing,
+// it returns the numbers and the md5 of the parts to stream.
+func (u *multipartUpload) beginComplete(parts []completedPart) ([]int, []string, error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.completing {
+		return nil, nil, errOperationAborted
+	}
+
+	numbers := make([]int, 0, len(parts))
+	sums := make([]string, 0, len(parts))
+	for i, part := range parts {
+		if i > 0 && part.PartNumber <= parts[i-1].PartNumber {
+			return nil, nil, errInvalidPartOrder
+		}
+
+		sum, ok := u.etags[part.PartNumber]
+		if !ok || sum != strings.Trim(part.ETag, `"`) {
+			return nil, nil, errInvalidPart
+		}
+		numbers = append(numbers, part.PartNumber)
+		sums = append(sums, sum)
+	}
+
+	u.completing = true
+	return numbers, sums, nil
+}
+
+// multipartETag returns the ETag of a multipart object as S3 does,
+// it is the md5 of the md5 of the parts followed by the number of the parts.
+func multipartETag(sums []string) string {
+	h := md5.New()
+	for _, sum := range sums {
+		b, _ := hex.DecodeString(sum)
+		h.Write(b)
+	}
+	return fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(h.Sum(nil)), len(sums))
+}
+
+func (g *Gateway) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	u, err := g.upload(r, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	u.lock.Lock()
+	completing := u.completing
+	u.lock.Unlock()
+	if completing {
+		return errOperationAborted
+	}
+
+	g.removeUpload(r.URL.Query().Get("uploadId"), u)
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Close deletes the parts of the multipart uploads which are not completed
+func (g *Gateway) Close() error {
+	g.lock.Lock()
+	uploads := g.uploads
+	g.uploads = make(map[string]*multipartUpload)
+	g.lock.Unlock()
+
+	ids := make([]string, 0, len(uploads))
+	for id := range uploads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var err error
+	for _, id := range ids {
+		if e := os.RemoveAll(uploads[id].dir); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// partsReader reads the parts one after another, a part is opened when the previous one is read
+type partsReader struct {
+	u       *multipartUpload
+	numbers []int
+	f       *os.File
+}
+
+func (p *partsReader) Read(buf []byte) (int, error) {
+	for {
+		if p.f == nil {
+			if len(p.numbers) == 0 {
+				return 0, io.EOF
+			}
+
+			f, err := os.Open(p.u.partPath(p.numbers[0]))
+			if err != nil {
+				return 0, err
+			}
+			p.f, p.numbers = f, p.numbers[1:]
+		}
+
+		n, err := p.f.Read(buf)
+		if err == io.EOF {
+			p.f.Close()
+			p.f = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (p *partsReader) Close() error {
+	if p.f == nil {
+		return nil
+	}
+	return p.f.Close()
+}
@@ -0,0 +1,240 @@
+package s3gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	storage "github.com/Titannet-dao/titan-storage-sdk"
+)
+
+// emptyETag is the ETag of an empty object, it is returned for the folders put as keys ending with a slash
+const emptyETag = `"d41d8cd98f00b204e9800998ecf8427e"`
+
+// cidHeader carries the cid of the asset of an object
+const cidHeader = "x-amz-meta-cid"
+
+// object returns the asset of the key
+func (g *Gateway) object(ctx context.Context, bucket, key string) (*storage.PathEntry, error) {
+	if strings.HasSuffix(key, "/") {
+		return nil, errNoSuchKey
+	}
+
+	entry, err := g.backend.Stat(ctx, objectPath(bucket, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, err = g.bucket(ctx, bucket); err != nil {
+			return nil, err
+		}
+		return nil, errNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if entry.IsFolder() {
+		return nil, errNoSuchKey
+	}
+	return entry, nil
+}
+
+func setObjectHeaders(w http.ResponseWriter, key string, entry *storage.PathEntry) {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("ETag", etag(entry.CID()))
+	h.Set(cidHeader, entry.CID())
+	h.Set("Accept-Ranges", "bytes")
+	if modTime := entry.ModTime(); !modTime.IsZero() {
+		h.Set("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+}
+
+func (g *Gateway) headObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	entry, err := g.object(r.Context(), bucket, key)
+	if err != nil {
+		return err
+	}
+
+	setObjectHeaders(w, key, entry)
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Size(), 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getObject serves the asset by ranges, the Range and the conditional headers are handled by http.ServeContent
+func (g *Gateway) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	ctx := r.Context()
+	entry, err := g.object(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+
+	reader, err := g.backend.OpenAsset(ctx, entry.CID())
+	if errors.Is(err, storage.ErrEncryptedAsset) {
+		return errInvalidObjectState
+	}
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	setObjectHeaders(w, key, entry)
+	http.ServeContent(w, r, "", entry.ModTime(), reader)
+	return nil
+}
+
+// putObject streams the body into the asset of the key, a key ending with a slash creates a folder
+func (g *Gateway) putObject(w http.ResponseWriter, r *http.Request, sig *signature, bucket, key string) error {
+	ctx := r.Context()
+	if _, err := g.bucket(ctx, bucket); err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(key, "/") {
+		if _, err := g.backend.MkdirAll(ctx, objectPath(bucket, key)); err != nil {
+			return err
+		}
+		w.Header().Set("ETag", emptyETag)
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+
+	body, err := newBodyReader(r, sig)
+	if err != nil {
+		return err
+	}
+
+	res, err := g.put(ctx, bucket, key, body)
+	if err != nil {
+		return body.failed(err)
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(body.md5.Sum(nil))+`"`)
+	w.Header().Set(cidHeader, res.CID.String())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// put uploads r as the asset of the key, the asset which had the key before is deleted
+func (g *Gateway) put(ctx context.Context, bucket, key string, r io.Reader) (*storage.UploadResult, error) {
+	p := objectPath(bucket, key)
+
+	old, err := g.backend.Stat(ctx, p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	res, err := g.backend.Put(ctx, p, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if old != nil && !old.IsFolder() && old.CID() != res.CID.String() {
+		if err = g.backend.DeleteAsset(ctx, old.CID()); err != nil {
+			log.Printf("delete the replaced asset %s of %s failed: %s", old.CID(), p, err.Error())
+		}
+	}
+
+	return res, nil
+}
+
+// deleteObject deletes the asset of the key, or the empty folder of a key ending with a slash.
+// It succeeds if the key does not exist.
+func (g *Gateway) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	ctx := r.Context()
+	p := objectPath(bucket, key)
+
+	entry, err := g.backend.Stat(ctx, p)
+	if errors.Is(err, fs.ErrNotExist) {
+		if _, err = g.bucket(ctx, bucket); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	remove := entry.IsFolder() == strings.HasSuffix(key, "/")
+	if remove && entry.IsFolder() {
+		// the folder is kept while it has other keys
+		entries, err := g.backend.ReadDir(ctx, p)
+		if err != nil {
+			return err
+		}
+		remove = len(entries) == 0
+	}
+
+	if remove {
+		if err = g.backend.Remove(ctx, p); err != nil {
+			return err
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// bodyReader reads the payload of a request, it keeps the md5 of the payload for the ETag
+// and checks it against Content-MD5.
+type bodyReader struct {
+	r    io.Reader
+	md5  hash.Hash
+	want []byte
+	// err is the error which stopped the reading
+	err error
+}
+
+func newBodyReader(r *http.Request, sig *signature) (*bodyReader, error) {
+	payload, err := sig.payloadReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body := &bodyReader{r: payload, md5: md5.New()}
+	if v := r.Header.Get("Content-MD5"); len(v) > 0 {
+		if body.want, err = base64.StdEncoding.DecodeString(v); err != nil || len(body.want) != md5.Size {
+			return nil, errInvalidDigest
+		}
+	}
+
+	return body, nil
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.md5.Write(p[:n])
+
+	if err == io.EOF && b.want != nil && !bytes.Equal(b.md5.Sum(nil), b.want) {
+		err = errBadDigest
+	}
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
+// failed returns the error of the body if it stopped the upload, otherwise err
+func (b *bodyReader) failed(err error) error {
+	if b.err != nil {
+		return b.err
+	}
+	return err
+}
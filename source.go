@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+)
+
+// SourceFunc opens the data to upload. It is called again for every retry,
+// so each call must return a new reader positioned at the beginning of the data.
+type SourceFunc func() (io.ReadCloser, error)
+
+// newReplayableSource returns a SourceFunc which can read r more than once.
+// A seekable reader is rewound on every open, any other reader is spilled to a temporary
+// file while it is read, so a retry replays the spilled part and continues with the rest of r.
+// The returned cleanup function removes the temporary file.
+//
+// If concurrent is true the returned readers may be read at the same time, r is then
+// read by offset if it is an io.ReaderAt, otherwise it is spilled completely before the first open.
+func newReplayableSource(r io.Reader, concurrent bool) (SourceFunc, func(), error) {
+	if concurrent {
+		return newConcurrentSource(r)
+	}
+
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		if pos, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return func() (io.ReadCloser, error) {
+				if _, err := seeker.Seek(pos, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return sizedNopCloser(seeker, readerSize(seeker)), nil
+			}, func() {}, nil
+		}
+	}
+
+	f, err := os.CreateTemp("", "titan-upload-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spill := &spillSource{r: r, f: f}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	return spill.open, cleanup, nil
+}
+
+// newConcurrentSource returns a SourceFunc whose readers can be read at the same time
+func newConcurrentSource(r io.Reader) (SourceFunc, func(), error) {
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size := readerSize(r)
+		pos, err := ra.Seek(0, io.SeekCurrent)
+		if err == nil && size >= 0 {
+			return func() (io.ReadCloser, error) {
+				return sizedNopCloser(io.NewSectionReader(ra, pos, size), size), nil
+			}, func() {}, nil
+		}
+	}
+
+	f, err := os.CreateTemp("", "titan-upload-*")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+
+	size, err := io.Copy(f, r)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return func() (io.ReadCloser, error) {
+		return sizedNopCloser(io.NewSectionReader(f, 0, size), size), nil
+	}, cleanup, nil
+}
+
+// spillSource copies everything read from r into f
+type spillSource struct {
+	r       io.Reader
+	f       *os.File
+	spilled int64
+}
+
+// open replays the spilled data and then continues to read r,
+// the size is known if the size of the rest of r is known
+func (s *spillSource) open() (io.ReadCloser, error) {
+	size := readerSize(s.r)
+	if size >= 0 {
+		size += s.spilled
+	}
+	return sizedNopCloser(io.MultiReader(io.NewSectionReader(s.f, 0, s.spilled), &spillReader{s}), size), nil
+}
+
+type spillReader struct {
+	s *spillSource
+}
+
+func (sr *spillReader) Read(p []byte) (int, error) {
+	n, err := sr.s.r.Read(p)
+	if n > 0 {
+		if _, werr := sr.s.f.WriteAt(p[:n], sr.s.spilled); werr != nil {
+			return 0, werr
+		}
+		sr.s.spilled += int64(n)
+	}
+	return n, err
+}
+
+// sizedReader is a reader of known size, Len returns the number of the unread bytes like bytes.Reader,
+// so the size is not hidden by io.NopCloser
+type sizedReader struct {
+	io.Reader
+	remaining int64
+}
+
+// sizedNopCloser returns io.NopCloser(r) which keeps the size of r, size is -1 if it is unknown
+func sizedNopCloser(r io.Reader, size int64) io.ReadCloser {
+	if size < 0 {
+		return io.NopCloser(r)
+	}
+	return &sizedReader{Reader: r, remaining: size}
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.remaining -= int64(n)
+	return n, err
+}
+
+func (r *sizedReader) Len() int {
+	return int(r.remaining)
+}
+
+func (r *sizedReader) Close() error {
+	return nil
+}
+
+// readerSize returns the remaining size of r, or -1 if it is unknown
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case *os.File:
+		info, err := v.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+		pos, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return info.Size() - pos
+	case io.Seeker:
+		pos, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := v.Seek(pos, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - pos
+	}
+	return -1
+}
+
+// multipartLength returns the length of a multipart form body which contains a single file of size bytes
+func multipartLength(boundary, name string, size int64) int64 {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return -1
+	}
+	if _, err := writer.CreateFormFile("file", name); err != nil {
+		return -1
+	}
+	if err := writer.Close(); err != nil {
+		return -1
+	}
+	return int64(body.Len()) + size
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestUploadStreamRetryWithSpill(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	root, err := CalculateCid(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		lock     sync.Mutex
+		attempts int
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		attempts++
+		first := attempts == 1
+		lock.Unlock()
+
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, _ := io.ReadAll(f)
+
+		if first {
+			http.Error(w, "node busy", http.StatusInternalServerError)
+			return
+		}
+
+		if !bytes.Equal(b, data) {
+			http.Error(w, "corrupted data", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: root.String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return nil },
+		nodes: func() []*client.NodeUploadInfo {
+			return []*client.NodeUploadInfo{{UploadURL: node.URL, NodeID: "n1"}, {UploadURL: node.URL, NodeID: "n2"}}
+		},
+	}
+	s := &storage{webAPI: web}
+
+	// hide the Len method of bytes.Reader, so the stream is not seekable
+	r := io.MultiReader(bytes.NewReader(data))
+	c, err := s.UploadStreamV2(context.Background(), r, "data.bin", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.Equals(root) || attempts != 2 {
+		t.Fatalf("expect cid %s after 2 attempts, got %s after %d", root, c, attempts)
+	}
+}
+
+func TestUploadProgressTotal(t *testing.T) {
+	data := make([]byte, 256<<10)
+	rand.New(rand.NewSource(4)).Read(data)
+
+	var contentLength int64
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength = r.ContentLength
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, _ := CalculateCid(f)
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: c.String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return nil },
+		nodes: func() []*client.NodeUploadInfo {
+			return []*client.NodeUploadInfo{{UploadURL: node.URL, NodeID: "n1"}}
+		},
+	}
+	s := &storage{webAPI: web}
+
+	for name, src := range map[string]Source{
+		"bytes":  BytesSource(data),
+		"seeker": ReaderSource(bytes.NewReader(data)),
+		"buffer": ReaderSource(bytes.NewBuffer(data)),
+	} {
+		var done, total int64
+		progress := func(d, t int64) {
+			done, total = d, t
+		}
+
+		if _, err := s.Upload(context.Background(), src, UploadName("data.bin"), UploadProgress(progress)); err != nil {
+			t.Fatal(name, err)
+		}
+
+		if done != int64(len(data)) || total != int64(len(data)) {
+			t.Fatalf("%s: expect progress %d/%d, got %d/%d", name, len(data), len(data), done, total)
+		}
+		if contentLength <= int64(len(data)) {
+			t.Fatalf("%s: expect the content length of the form, got %d", name, contentLength)
+		}
+	}
+}
@@ -55,12 +55,60 @@ type Storage interface {
 	// It takes limit and offset parameters for pagination and returns the asset list and any error encountered.
 	ListDirectoryContents(ctx context.Context, parent, pageSize, page int) (*client.ListAssetRecordRsp, error)
 
-	// RenameFolder Rename a specific folder
+	// IterAssets returns an iterator of the assets in the folder, the pages are fetched as it is read
+	IterAssets(ctx context.Context, folderID int, opts *IterOptions) *Iterator[*client.AssetOverview]
+
+	// IterFolders returns an iterator of the subfolders of the folder parentID, the pages are fetched as it is read
+	IterFolders(ctx context.Context, parentID int, opts *IterOptions) *Iterator[*client.AssetGroup]
+
+	// Walk visits the assets and subfolders of the folder recursively, see WalkFunc
+	Walk(ctx context.Context, folderID int, fn WalkFunc) error
+
+	// RenameFolder Rename a specific folder, it returns client.ErrNotSupported until the web API supports it
 	RenameFolder(ctx context.Context, folderID int64, newName string) error
 
 	// RenameAsset Rename a specific file
 	RenameAsset(ctx context.Context, assetCID string, newName string) error
 
+	// MoveAsset Move a specific file into the target folder, 0 is the root folder.
+	// It returns client.ErrNotSupported until the web API supports it.
+	MoveAsset(ctx context.Context, assetCID string, targetFolderID int) error
+
+	// MoveFolder Move a specific folder into the target parent folder, 0 is the root folder.
+	// A folder can not be moved into itself or its subfolders.
+	// It returns client.ErrNotSupported until the web API supports it.
+	MoveFolder(ctx context.Context, folderID, targetParentID int) error
+
+	// ResolveFolder returns the id of the folder at folderPath, e.g. /invoices/2026/10, "/" is the root folder 0.
+	// The missing folders are created if create is true, otherwise ErrFolderNotFound is returned.
+	// The uploads go into a folder by path with WithFolderPath or UploadFolderPath.
+	ResolveFolder(ctx context.Context, folderPath string, create bool) (int, error)
+
+	// Stat returns the folder or asset at a path like /photos/2026/a.jpg, the folders are cached
+	// and the cache is dropped by the changes of the folders made by this Storage.
+	// The path methods return a *fs.PathError, of fs.ErrNotExist if the path does not exist.
+	Stat(ctx context.Context, p string) (*PathEntry, error)
+
+	// ReadDir returns the subfolders and assets of the folder at path p
+	ReadDir(ctx context.Context, p string) ([]*PathEntry, error)
+
+	// MkdirAll creates the folder at path p and the missing folders above it, it returns the id of the folder
+	MkdirAll(ctx context.Context, p string) (int, error)
+
+	// Remove deletes the asset or the empty folder at path p
+	Remove(ctx context.Context, p string) error
+
+	// RemoveAll deletes the asset or the folder at path p with everything in it, it returns nil if p does not exist
+	RemoveAll(ctx context.Context, p string) error
+
+	// Rename renames or moves the folder or asset at oldPath to newPath, only the rename of an asset
+	// is supported by the web API now, the others return client.ErrNotSupported
+	Rename(ctx context.Context, oldPath, newPath string) error
+
+	// FS returns a read-only fs.FS of the folder rootFolderID, the assets are read by ranges and can seek,
+	// so the FS works with http.FS, fs.WalkDir and testing/fstest. ctx is used by all calls of the FS.
+	FS(ctx context.Context, rootFolderID int) *FolderFS
+
 	// DeleteFolder delete special folder
 	DeleteFolder(ctx context.Context, folderID int) error
 
@@ -74,40 +122,116 @@ type Storage interface {
 	// GetItemDetails Get detailed information about files/folders
 	GetItemDetails(ctx context.Context, assetCID string, folderID int) (*client.ListAssetRecordRsp, error)
 
-	// CreateSharedLink Share file/folder data
+	// CreateSharedLink Share file/folder data, it returns the share URL of the file
 	CreateSharedLink(ctx context.Context, assetCID string, folderID int) (string, error)
 
+	// CreateSharedLinkWithOptions is CreateSharedLink with the limits of the link, see ShareOptions.
+	// The web API only shares files without limits now, the others return client.ErrNotSupported.
+	CreateSharedLinkWithOptions(ctx context.Context, assetCID string, folderID int, opts ShareOptions) (*SharedLink, error)
+
+	// Upload uploads a file, folder, reader, bytes or url to the titan storage, see PathSource, ReaderSource,
+	// BytesSource and URLSource. The options set the name, folder, areas, car mode, DAG options, progress,
+	// retries and encryption of the upload. The share URL of the result is set with UploadShareURL,
+	// if the upload failed on all nodes the error is an *UploadError with the attempts.
+	Upload(ctx context.Context, src Source, opts ...UploadOption) (*UploadResult, error)
+
 	// UploadAsset Upload files/folders
+	//
+	// Deprecated: use Upload
 	UploadAsset(ctx context.Context, filePath string, reader io.Reader, progress ProgressFunc) (cid cid.Cid, err error)
 
-	// UploadAssetWithUrl
+	// UploadWithJournal uploads files/folders as car and records the upload in a local journal until it is finished,
+	// calling it again with the same path after a failure reuses the cid and the endpoints of the journal.
+	// The car is always sent from the start, the nodes do not accept parts of a car.
+	UploadWithJournal(ctx context.Context, filePath string, opts *JournalOptions, progress ProgressFunc) (cid.Cid, error)
+
+	// UploadAssetWithUrl lets a node pull the url into the titan storage and waits for it,
+	// the data never passes through this process.
+	//
+	// Deprecated: use Upload with URLSource
 	UploadAssetWithUrl(ctx context.Context, url string) (cid cid.Cid, fileName string, err error)
 
+	// SubmitURLUpload lets a node pull the url into the titan storage and returns the job id without waiting,
+	// the asset is created in background once the url is pulled. The job id is only known by this storage.
+	SubmitURLUpload(ctx context.Context, rawURL string) (jobID string, err error)
+
+	// GetURLUploadJob returns the state of a url upload job, the asset is created once the url is pulled
+	GetURLUploadJob(ctx context.Context, jobID string) (*URLUploadJob, error)
+
+	// WaitURLUpload polls a url upload job until it is done or failed
+	WaitURLUpload(ctx context.Context, jobID string, progress ProgressFunc) (*URLUploadJob, error)
+
 	// DownloadAsset Download files/folders
 	DownloadAsset(ctx context.Context, assetCID string) (io.ReadCloser, string, error)
 
+	// DownloadToFile downloads the asset into filePath, calling it again after a failure
+	// resumes the download from the ranges already written.
+	DownloadToFile(ctx context.Context, assetCID, filePath string, opts *DownloadOptions) error
+
+	// DownloadDirectory downloads a folder asset and recreates its files and subfolders under destDir.
+	DownloadDirectory(ctx context.Context, assetCID, destDir string, opts *DirectoryOptions) error
+
+	// OpenAsset returns a reader of the asset which can seek and read at any offset,
+	// only the blocks read are downloaded. An encrypted asset is not decrypted by ranges,
+	// the error is ErrEncryptedAsset for it.
+	OpenAsset(ctx context.Context, assetCID string) (AssetReader, error)
+
 	// SetArea set areas before upload or download files
 	SetAreas(ctx context.Context, area []string)
 
+	// UploadAssetWithResult is UploadAsset which returns the result of the upload:
+	// the node which took it, the size, the elapsed time, the attempts of every node and so on.
+	// The share URL is set if ctx is returned by WithShareURL. If the upload failed on all nodes,
+	// the error is an *UploadError with the attempts.
+	//
+	// Deprecated: use Upload
+	UploadAssetWithResult(ctx context.Context, filePath string, reader io.Reader, progress ProgressFunc) (*UploadResult, error)
+
+	// UploadFilesWithResult is UploadFilesWithPath which returns the result of the upload,
+	// the result tells if the asset already existed, e.g. found by the deduplication of UploadDedup.
+	//
+	// Deprecated: use Upload with PathSource and UploadAsCar
+	UploadFilesWithResult(ctx context.Context, filePath string, progress ProgressFunc, makeCar bool) (*UploadResult, error)
+
+	// UploadStreamWithResult is UploadStreamV2 which returns the result of the upload
+	//
+	// Deprecated: use Upload with ReaderSource
+	UploadStreamWithResult(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (*UploadResult, error)
+
 	// ------------------------------ Functions blow will be legacy -------------------------------------
 
 	// UploadFilesWithPath uploads files from the local file system to the titan storage.
 	// specified by the given filePath. It returns the CID (Content Identifier) and any error encountered.
 	// if makeCar is true, it will make car in local, else will make car in server
+	//
+	// Deprecated: use Upload with PathSource and UploadAsCar
 	UploadFilesWithPath(ctx context.Context, filePath string, progress ProgressFunc, makeCar bool) (cid.Cid, error)
 	// UploadFileWithURL uploads a file from the specified URL to the titan storage.
 	// It returns the rootCID and the URL of the uploaded file, along with any error encountered.
+	//
+	// Deprecated: use Upload with URLSource
 	UploadFileWithURL(ctx context.Context, url string, progress ProgressFunc) (string, string, error)
 
-	// UploadFileWithURLV2
+	// UploadFileWithURLV2 lets a node pull the url into the titan storage, it returns the cid and the share url
+	//
+	// Deprecated: use Upload with URLSource and UploadShareURL
 	UploadFileWithURLV2(ctx context.Context, url string, progress ProgressFunc) (string, string, error)
 
 	// UploadStream uploads data from an io.Reader stream to the titan storage.
 	// if name is empty, name will be the cid
 	// It returns the CID of the uploaded data and any error encountered.
+	//
+	// Deprecated: use Upload with ReaderSource and UploadAsCar(true)
 	UploadStream(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (cid.Cid, error)
 	// UploadStreamV2 uploads data from an io.Reader stream without making car to the titan storage.
+	//
+	// Deprecated: use Upload with ReaderSource
 	UploadStreamV2(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (cid.Cid, error)
+	// UploadStreamFunc uploads the data opened by open without making car to the titan storage,
+	// open is called again for every retry on another node, so the data is never buffered in memory.
+	//
+	// Deprecated: use Upload with the SourceFunc
+	UploadStreamFunc(ctx context.Context, open SourceFunc, name string, progress ProgressFunc) (cid.Cid, error)
 	// ListUserAssets retrieves a list of user assets from the titan storage.
 	// It takes limit and offset parameters for pagination and returns the asset list and any error encountered.
 	ListUserAssets(ctx context.Context, parent, pageSize, page int) (*client.ListAssetRecordRsp, error)
@@ -140,6 +264,25 @@ type storage struct {
 	// default is 0, 0 is root directory
 	groupID int
 	areas   []string
+
+	strategy   UploadStrategy
+	raceWidth  int
+	importOpts *ImportOptions
+	verify     bool
+	keys       KeyProvider
+	encrypt    bool
+	dedup      bool
+	// opts are the settings of every HTTP call, shared with webAPI
+	opts *client.Options
+
+	// folderLock serializes the creation of the folders of folder paths
+	folderLock sync.Mutex
+	// folders caches the group tree for the folder paths
+	folders folderCache
+	// sizes caches the sizes of the asset contents of the path entries
+	sizes assetSizeCache
+	// urlJobs are the url upload jobs submitted by this storage
+	urlJobs urlJobCache
 }
 
 type Config struct {
@@ -153,9 +296,36 @@ type Config struct {
 	Token  string
 
 	// Setting the directory for file uploads
-	// default is 0, 0 is root directory
+	// default is 0, 0 is root directory.
+	// It can be changed per call with WithFolderID, WithFolderPath, UploadFolderID or UploadFolderPath.
 	GroupID     int
 	UseFastNode bool
+
+	// UploadStrategy decides how the candidate nodes are used by uploads,
+	// default is UploadSequential. It can be changed per call with UploadWithStrategy.
+	UploadStrategy UploadStrategy
+	// RaceWidth is the number of nodes uploaded to at the same time by UploadRace, default is 2
+	RaceWidth int
+	// ImportOptions sets how the uploaded data is laid out into a UnixFS DAG, so the CID matches
+	// the one of other IPFS tools. It can be changed per call with WithImportOptions,
+	// the uploads without making car are converted to car when it is set.
+	ImportOptions *ImportOptions
+	// VerifyDownloads makes DownloadAsset fetch the asset as a car and verify every block
+	// against the asset CID. It can be changed per call with WithVerifiedDownload.
+	VerifyDownloads bool
+	// KeyProvider has the keys of the encrypted assets, the downloads are decrypted when their key is found.
+	KeyProvider KeyProvider
+	// EncryptUploads encrypts the uploads with the key of KeyProvider before they leave this process,
+	// it can be changed per call with WithEncryption. The uploads of folders can not be encrypted.
+	EncryptUploads bool
+	// Dedup calculates the CID of a file uploaded without car before it is sent, with the layout of
+	// CalculateCid, and skips the transfer if an asset of that CID is already stored.
+	// It can be changed per call with UploadDedup.
+	Dedup bool
+
+	// Options set the HTTP client, proxy, TLS roots, timeouts and retries
+	// used by every HTTP call of the SDK, e.g. client.WithProxy(u).
+	Options []client.Option
 }
 
 var TitanAreas []string
@@ -182,7 +352,12 @@ func Initialize(cfg *Config) (Storage, error) {
 	// headers := http.Header{}
 	// headers.Add("Authorization", "Bearer "+cfg.APIKey)
 
-	webAPI := client.NewWebserver(cfg.TitanURL, cfg.APIKey, cfg.Token)
+	if cfg.EncryptUploads && cfg.KeyProvider == nil {
+		return nil, fmt.Errorf("EncryptUploads requires a KeyProvider")
+	}
+
+	opts := client.NewOptions(cfg.Options...)
+	webAPI := client.NewWebserverWithOptions(cfg.TitanURL, cfg.APIKey, cfg.Token, opts)
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -199,7 +374,7 @@ func Initialize(cfg *Config) (Storage, error) {
 			return nil, fmt.Errorf("GetCandidateIPs %w", err)
 		}
 
-		fastNodes := getFastNodes(candidates)
+		fastNodes := getFastNodes(candidates, opts.Client())
 		if len(fastNodes) > 0 {
 			fastNodeID = fastNodes[0].NodeID
 			fmt.Println("use fastest node ", fastNodeID)
@@ -213,7 +388,10 @@ func Initialize(cfg *Config) (Storage, error) {
 		return nil, err
 	}
 
-	return &storage{webAPI: webAPI, candidateID: fastNodeID, userID: vipInfo.UserID, groupID: cfg.GroupID}, nil
+	return &storage{webAPI: webAPI, candidateID: fastNodeID, userID: vipInfo.UserID, groupID: cfg.GroupID,
+		strategy: cfg.UploadStrategy, raceWidth: cfg.RaceWidth, importOpts: cfg.ImportOptions,
+		verify: cfg.VerifyDownloads, keys: cfg.KeyProvider, encrypt: cfg.EncryptUploads,
+		dedup: cfg.Dedup, opts: opts}, nil
 }
 
 // or you can use the global value TitanAreas after call Initliaze.
@@ -223,6 +401,8 @@ func (s *storage) ListRegions(ctx context.Context) ([]string, error) {
 
 // CreateFolder Create directories, including root and subdirectories
 func (s *storage) CreateFolder(ctx context.Context, name string, parent int) error {
+	defer s.folders.reset()
+
 	_, err := s.webAPI.CreateGroup(ctx, name, parent)
 	return err
 }
@@ -235,7 +415,9 @@ func (s *storage) ListDirectoryContents(ctx context.Context, parent, pageSize, p
 
 // RenameFolder Rename a specific folder
 func (s *storage) RenameFolder(ctx context.Context, folderID int64, newName string) error {
-	return s.webAPI.RenameGroup(ctx, s.userID, newName, int(folderID))
+	defer s.folders.reset()
+
+	return s.webAPI.RenameGroup(ctx, newName, int(folderID))
 }
 
 // RenameAsset Rename a specific file
@@ -243,8 +425,70 @@ func (s *storage) RenameAsset(ctx context.Context, assetCID string, newName stri
 	return s.webAPI.RenameAsset(ctx, assetCID, newName)
 }
 
+// MoveAsset Move a specific file into the target folder
+func (s *storage) MoveAsset(ctx context.Context, assetCID string, targetFolderID int) error {
+	return s.webAPI.MoveAssetToGroup(ctx, assetCID, targetFolderID)
+}
+
+// MoveFolder Move a specific folder into the target parent folder
+func (s *storage) MoveFolder(ctx context.Context, folderID, targetParentID int) error {
+	if folderID == 0 {
+		return fmt.Errorf("can not move the root folder")
+	}
+
+	if folderID == targetParentID {
+		return fmt.Errorf("can not move folder %d into itself", folderID)
+	}
+
+	sub, err := s.isSubFolder(ctx, folderID, targetParentID)
+	if err != nil {
+		return err
+	}
+	if sub {
+		return fmt.Errorf("can not move folder %d into its subfolder %d", folderID, targetParentID)
+	}
+
+	defer s.folders.reset()
+
+	return s.webAPI.MoveAssetGroup(ctx, folderID, targetParentID)
+}
+
+// isSubFolder reports whether folderID is in the subtree of parentID
+func (s *storage) isSubFolder(ctx context.Context, parentID, folderID int) (bool, error) {
+	const pageSize = 100
+
+	pending := []int{parentID}
+	for len(pending) > 0 {
+		parent := pending[0]
+		pending = pending[1:]
+
+		for page, count := 1, 0; ; page++ {
+			rsp, err := s.webAPI.ListGroups(ctx, parent, pageSize, page)
+			if err != nil {
+				return false, err
+			}
+
+			for _, group := range rsp.AssetGroups {
+				if group.ID == folderID {
+					return true, nil
+				}
+				pending = append(pending, group.ID)
+			}
+
+			count += len(rsp.AssetGroups)
+			if len(rsp.AssetGroups) == 0 || count >= rsp.Total {
+				break
+			}
+		}
+	}
+
+	return false, nil
+}
+
 // DeleteFolder delete special group
 func (s *storage) DeleteFolder(ctx context.Context, folderID int) error {
+	defer s.folders.reset()
+
 	return s.webAPI.DeleteGroup(ctx, s.userID, folderID)
 }
 
@@ -284,41 +528,78 @@ func (s *storage) GetItemDetails(ctx context.Context, assetCID string, folderID
 	return s.webAPI.ListAssets(ctx, 0, 0, 0, assetCID, folderID)
 }
 
-// CreateSharedLink Share file/folder data
-func (s *storage) CreateSharedLink(ctx context.Context, assetCID string, folderID int) (string, error) {
-	// if folderID > 0 {
-	// 	return "", errors.New("not implemented yet")
-	// }
-	return "", errors.New("not implemented yet")
+// ShareOptions limits the visits of a shared link, the zero value never expires and allows any visits
+type ShareOptions struct {
+	// ExpireAt is the time the link expires, zero never expires
+	ExpireAt time.Time
+	// Password is required to visit the link if it is not empty
+	Password string
+	// MaxVisits is the number of visits allowed, 0 is unlimited
+	MaxVisits int
 }
 
-// UploadAsset Upload files/folders
-func (s *storage) UploadAsset(ctx context.Context, filePath string, reader io.Reader, progress ProgressFunc) (cid.Cid, error) {
-	if filePath != "" {
-		fileType, err := getFileType(filePath)
-		if err != nil {
-			return cid.Cid{}, err
-		}
+// SharedLink is a shared link of a file
+type SharedLink struct {
+	AssetCID string
+	// URL is the first of URLs, the file can be visited from any of them
+	URL  string
+	URLs []string
+}
 
-		if fileType == string(FileTypeFolder) {
-			return s.uploadFilesWithPathAndMakeCar(ctx, filePath, progress)
-		}
+// CreateSharedLink Share file/folder data, it returns the share URL of the file
+func (s *storage) CreateSharedLink(ctx context.Context, assetCID string, folderID int) (string, error) {
+	link, err := s.CreateSharedLinkWithOptions(ctx, assetCID, folderID, ShareOptions{})
+	if err != nil {
+		return "", err
+	}
+	return link.URL, nil
+}
 
-		if fileType == string(FileTypeFile) {
-			return s.UploadFilesWithPath(ctx, filePath, progress, false)
+// CreateSharedLinkWithOptions shares the file by the share urls of its nodes,
+// the folders and the limits are not supported by the web API yet
+func (s *storage) CreateSharedLinkWithOptions(ctx context.Context, assetCID string, folderID int, opts ShareOptions) (*SharedLink, error) {
+	if len(assetCID) == 0 {
+		if folderID > 0 {
+			return nil, fmt.Errorf("share folder %w", client.ErrNotSupported)
 		}
+		return nil, fmt.Errorf("asset cid or folder id is required")
 	}
 
-	if reader != nil {
-		return s.UploadStreamV2(ctx, reader, "", progress)
+	if opts.MaxVisits < 0 {
+		return nil, fmt.Errorf("max visits %d can not be negative", opts.MaxVisits)
+	}
+	if !opts.ExpireAt.IsZero() || len(opts.Password) > 0 || opts.MaxVisits > 0 {
+		return nil, fmt.Errorf("share with expiry, password or visit limit %w", client.ErrNotSupported)
 	}
 
-	return cid.Cid{}, errors.New("FilePath or Reader must be non empty")
+	res, err := s.GetURL(ctx, assetCID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SharedLink{AssetCID: assetCID, URL: res.URLs[0], URLs: res.URLs}, nil
 }
 
-// UploadAssetWithUrl
-func (s *storage) UploadAssetWithUrl(ctx context.Context, url string) (cid.Cid, string, error) {
-	return cid.Cid{}, "", errors.New("not implemented yet")
+// UploadAsset Upload files/folders
+//
+// Deprecated: use Upload
+func (s *storage) UploadAsset(ctx context.Context, filePath string, reader io.Reader, progress ProgressFunc) (cid.Cid, error) {
+	return resultCID(s.UploadAssetWithResult(ctx, filePath, reader, progress))
+}
+
+// UploadAssetWithResult Upload files/folders and return the result of the upload
+//
+// Deprecated: use Upload
+func (s *storage) UploadAssetWithResult(ctx context.Context, filePath string, reader io.Reader, progress ProgressFunc) (*UploadResult, error) {
+	if filePath != "" {
+		return s.Upload(ctx, PathSource(filePath), UploadProgress(progress))
+	}
+
+	if reader != nil {
+		return s.Upload(ctx, ReaderSource(reader), UploadProgress(progress))
+	}
+
+	return nil, errors.New("FilePath or Reader must be non empty")
 }
 
 // DownloadAsset Download files/folders
@@ -328,9 +609,18 @@ func (s *storage) DownloadAsset(ctx context.Context, assetCID string) (io.ReadCl
 		return nil, "", err
 	}
 
+	if s.verifyDownload(ctx) {
+		root, err := cid.Decode(assetCID)
+		if err != nil {
+			return nil, "", fmt.Errorf("decode cid %s failed, %s", assetCID, err.Error())
+		}
+		reader, err := s.decryptReadCloser(ctx, s.downloadVerified(ctx, root, res))
+		return reader, res.FileName, err
+	}
+
 	start := time.Now()
 
-	r := byterange.New(1 << 20)
+	r := byterange.NewWithOptions(1<<20, s.opts)
 
 	reader, size, err := r.GetFile(ctx, res)
 
@@ -353,6 +643,11 @@ func (s *storage) DownloadAsset(ctx context.Context, assetCID string) (io.ReadCl
 		}
 	}()
 
+	if err != nil {
+		return nil, res.FileName, err
+	}
+
+	reader, err = s.decryptReadCloser(ctx, reader)
 	return reader, res.FileName, err
 }
 
@@ -393,11 +688,11 @@ func getFileType(filePath string) (string, error) {
 
 // errAssetNotExist returns an error indicating that the asset does not exist
 func errAssetNotExist(cid string) error {
-	return fmt.Errorf("ShareAssets err:asset %s not exist", cid)
+	return fmt.Errorf("ShareAssets err:asset %s not exist, %w", cid, client.ErrAssetNotFound)
 }
 
 // getFastNodes returns a list of fast nodes from the given candidates
-func getFastNodes(candidates []*client.CandidateIPInfo) []*client.CandidateIPInfo {
+func getFastNodes(candidates []*client.CandidateIPInfo, httpClient *http.Client) []*client.CandidateIPInfo {
 	if len(candidates) == 0 {
 		return make([]*client.CandidateIPInfo, 0)
 	}
@@ -416,9 +711,7 @@ func getFastNodes(candidates []*client.CandidateIPInfo) []*client.CandidateIPInf
 		}
 		request = request.WithContext(ctx)
 
-		// Create an HTTP client and send the request
-		client := http.DefaultClient
-		_, err = client.Do(request)
+		_, err = httpClient.Do(request)
 		if err != nil {
 			return fmt.Errorf("do error %s", err.Error())
 		}
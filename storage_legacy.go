@@ -1,9 +1,9 @@
 package storage
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,66 +11,74 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"path"
-	"path/filepath"
 	"time"
 
 	"github.com/Titannet-dao/titan-storage-sdk/client"
-	"github.com/Titannet-dao/titan-storage-sdk/memfile"
 	byterange "github.com/Titannet-dao/titan-storage-sdk/range"
 	"github.com/ipfs/go-cid"
 )
 
-// uploadFileWithForm uploads a file using a multipart form
-func (s *storage) uploadFileWithForm(ctx context.Context, r io.Reader, name, uploadURL, token, trace_id string, progress ProgressFunc) (*UploadFileResult, error) {
-	// Create a new multipart form body
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	// Create a new form field for the file
-	fileField, err := writer.CreateFormFile("file", name)
-	if err != nil {
-		return nil, err
-	}
-
-	// Copy the file data to the form field
-	_, err = io.Copy(fileField, r)
-	if err != nil {
-		return nil, err
-	}
-
-	// Close the multipart form
-	err = writer.Close()
-	if err != nil {
-		return nil, err
-	}
-
-	totalSize := body.Len()
+// uploadFileWithForm uploads a file using a multipart form,
+// the form body is streamed from r through a pipe, so the data is never buffered in memory.
+func (s *storage) uploadFileWithForm(ctx context.Context, r io.Reader, name, uploadURL, token string, progress ProgressFunc) (*UploadFileResult, error) {
+	totalSize := readerSize(r)
 	dongSize := int64(0)
-	pr := &ProgressReader{body, func(r int64) {
+	pr := &ProgressReader{r, func(r int64) {
 		if r > 0 {
 			dongSize += r
 			if progress != nil {
-				progress(dongSize, int64(totalSize))
+				progress(dongSize, totalSize)
 			}
 		}
 	}}
 
+	bodyReader, bodyWriter := io.Pipe()
+
+	writer := multipart.NewWriter(bodyWriter)
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+
+		// Create a new form field for the file
+		fileField, err := writer.CreateFormFile("file", name)
+		if err != nil {
+			bodyWriter.CloseWithError(err)
+			return
+		}
+
+		// Copy the file data to the form field
+		if _, err = io.Copy(fileField, pr); err != nil {
+			bodyWriter.CloseWithError(err)
+			return
+		}
+
+		// Close the multipart form
+		bodyWriter.CloseWithError(writer.Close())
+	}()
+	// the source is opened again by the next attempt, so the form writer must stop reading it first
+	defer func() {
+		bodyReader.Close()
+		<-copied
+	}()
+
 	// Create a new HTTP request with the form data
-	request, err := http.NewRequest("POST", uploadURL, pr)
+	request, err := http.NewRequest("POST", uploadURL, bodyReader)
 	if err != nil {
 		return nil, fmt.Errorf("new request error %s", err.Error())
 	}
 
+	if totalSize >= 0 {
+		request.ContentLength = multipartLength(writer.Boundary(), name, totalSize)
+	}
+
 	request.Header.Set("Content-Type", writer.FormDataContentType())
 	request.Header.Set("Authorization", "Bearer "+token)
-	request = request.WithContext(ctx)
 
-	start := time.Now()
+	ctx, cancel := s.opts.UploadContext(ctx)
+	defer cancel()
+	request = request.WithContext(ctx)
 
-	// Create an HTTP client and send the request
-	httpClient := http.DefaultClient
-	response, err := httpClient.Do(request)
+	response, err := s.opts.Client().Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("do error %s", err.Error())
 	}
@@ -86,18 +94,9 @@ func (s *storage) uploadFileWithForm(ctx context.Context, r io.Reader, name, upl
 		return nil, err
 	}
 
-	report := &client.AssetTransferReq{
-		CostMs:       int64(time.Since(start).Milliseconds()),
-		TotalSize:    int64(totalSize),
-		TransferType: client.AssetTransferTypeUpload,
-		State:        client.AssetTransferStateFailed,
-		TraceID:      trace_id,
-	}
-	defer func(r *client.AssetTransferReq) {
-		if err := s.webAPI.AssetTransferReport(context.Background(), *r); err != nil {
-			log.Printf("failed to send transfer report, %s", err.Error())
-		}
-	}(report)
+	// wait for the form writer to exit before reading the uploaded size
+	bodyReader.Close()
+	<-copied
 
 	var ret UploadFileResult
 	if err := json.Unmarshal(b, &ret); err != nil {
@@ -111,389 +110,287 @@ func (s *storage) uploadFileWithForm(ctx context.Context, r io.Reader, name, upl
 		return nil, fmt.Errorf(ret.Msg)
 	}
 
-	ret.totalSize = int64(totalSize)
-
-	report.Cid = ret.Cid
-	report.State = client.AssetTransferStateSuccess
+	ret.totalSize = dongSize
 
 	return &ret, nil
 }
 
-func (s *storage) uploadFilesWithPathAndMakeCar(ctx context.Context, filePath string, progress ProgressFunc) (cid.Cid, error) {
-	// delete template file if exist
-	fileName := filepath.Base(filePath)
-	tempFile := path.Join(os.TempDir(), fileName)
-	if _, err := os.Stat(tempFile); err == nil {
-		os.Remove(tempFile)
-	}
-
-	root, err := createCar(filePath, tempFile)
+// uploadFilesWithPathAndMakeCar uploads a file or folder as car, the car is generated
+// while it is uploaded, so it is never stored in memory or on disk.
+func (s *storage) uploadFilesWithPathAndMakeCar(ctx context.Context, filePath, fileName string, o *uploadOptions) (*UploadResult, error) {
+	fileType, err := getFileType(filePath)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, err
 	}
 
-	carFile, err := os.Open(tempFile)
+	enc, err := s.newEncrypter(ctx)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, err
 	}
 
-	defer func() {
-		if err = carFile.Close(); err != nil {
-			fmt.Println("close car file error ", err.Error())
+	walk := pathWalker(ctx, filePath, s.importOptions(ctx))
+	if enc != nil {
+		if fileType == string(FileTypeFolder) {
+			return nil, fmt.Errorf("%s is a folder, only files can be encrypted", filePath)
 		}
 
-		if err = os.Remove(tempFile); err != nil {
-			fmt.Println("delete temporary car file error ", err.Error())
+		open := func() (io.ReadCloser, error) {
+			return os.Open(filePath)
 		}
-	}()
+		walk = sourceWalker(enc.source(open), s.importOptions(ctx))
+	}
 
-	fileInfo, err := carFile.Stat()
+	plan, err := planCar(walk)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, err
 	}
+	root := plan.root
 
-	fileType, err := getFileType(filePath)
+	groupID, err := s.uploadGroup(ctx)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, err
 	}
 
 	assetProperty := client.AssetProperty{
 		AssetCID:  root.String(),
 		AssetName: fileName,
-		AssetSize: fileInfo.Size(),
+		AssetSize: plan.size,
 		AssetType: fileType,
 		NodeID:    s.candidateID,
-		GroupID:   s.groupID,
+		GroupID:   groupID,
+		Encrypted: enc != nil,
 	}
 
-	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.areas}
+	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.uploadAreas(ctx)}
 	rsp, err := s.webAPI.CreateAsset(ctx, &req)
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("CreateAsset error %w", err)
+		return nil, fmt.Errorf("CreateAsset error %w", err)
 	}
 
+	res := &UploadResult{CID: root, Name: fileName, Size: plan.size}
 	if rsp.IsAlreadyExist {
-		return root, nil
+		res.AlreadyExisted = true
+		return res, nil
 	}
 
-	if len(rsp.Endpoints) == 0 {
-		return cid.Cid{}, fmt.Errorf("endpoints is empty")
+	success, attempts, err := s.uploadCar(ctx, rsp.Endpoints, plan.open, fileName, root, o)
+	if err != nil {
+		return nil, err
 	}
+	res.setAttempts(success, attempts)
 
-	var (
-		report = &client.AssetTransferReq{
-			// CostMs:       int64(time.Since(start).Milliseconds()),
-			TotalSize:    assetProperty.AssetSize,
-			TransferType: client.AssetTransferTypeUpload,
-			Cid:          root.String(),
-			State:        client.AssetTransferStateFailed,
-		}
-		logContent = make(map[string]string)
-		// final      bool
-	)
-
-	defer func(r *client.AssetTransferReq) {
-		if err := s.webAPI.AssetTransferReport(context.Background(), *r); err != nil {
-			log.Printf("failed to send transfer report, %s", err.Error())
-		}
-	}(report)
-
-	for _, ep := range rsp.Endpoints {
-
-		nodeid := getNodeIdFromCandidateAddr(ep.CandidateAddr)
-		report.TraceID = ep.TraceID
-		// if upload succeed,
-		report.NodeID = joinNodeID(report.NodeID, nodeid)
-
-		start := time.Now()
-		_, err = s.uploadFileWithForm(ctx, carFile, fileName, ep.CandidateAddr, ep.Token, ep.TraceID, progress)
-		report.CostMs = int64(time.Since(start).Milliseconds())
-
-		if err == nil {
-			report.State = client.AssetTransferStateSuccess
-			return root, nil
-		} else {
-			fmt.Printf("upload req: %+v\n", ep)
-			logContent[nodeid] = err.Error()
-			// go func(r *client.AssetTransferReq) {
-			// 	if err := s.webAPI.AssetTransferReport(context.Background(), *r); err != nil {
-			// 		log.Printf("failed to send transfer report, %s", err.Error())
-			// 	}
-			// }(report)
-
-			if delErr := s.webAPI.DeleteAsset(ctx, s.userID, root.String()); delErr != nil {
-				return cid.Cid{}, fmt.Errorf("uploadFileWithForm failed %s, delete error %s", err.Error(), delErr.Error())
-			}
-			// return cid.Cid{}, fmt.Errorf("uploadFileWithForm error %s, delete it from titan", err.Error())
-		}
+	return res, nil
+}
 
+// uploadCar uploads a car to the endpoints returned by CreateAsset,
+// the asset is deleted from titan only if the upload failed on all endpoints.
+func (s *storage) uploadCar(ctx context.Context, endpoints []*client.Endpoint, open SourceFunc, name string, root cid.Cid, o *uploadOptions) (*uploadAttempt, []*uploadAttempt, error) {
+	success, attempts, err := s.uploadToTargets(ctx, endpointTargets(endpoints), open, name, root.String(), o)
+	if err == nil {
+		return success, attempts, nil
 	}
 
-	return cid.Cid{}, fmt.Errorf("upload file failed")
+	if delErr := s.webAPI.DeleteAsset(ctx, s.userID, root.String()); delErr != nil {
+		return nil, attempts, fmt.Errorf("%w, delete error %s", err, delErr.Error())
+	}
+	return nil, attempts, err
 }
 
 // UploadFilesWithPath uploads files from the specified path
+//
+// Deprecated: use Upload with PathSource and UploadAsCar
 func (s *storage) UploadFilesWithPath(ctx context.Context, filePath string, progress ProgressFunc, makeCar bool) (cid.Cid, error) {
-	if makeCar {
-		return s.uploadFilesWithPathAndMakeCar(ctx, filePath, progress)
-	}
+	return resultCID(s.Upload(ctx, PathSource(filePath), UploadProgress(progress), UploadAsCar(makeCar)))
+}
 
-	rsp, err := s.webAPI.GetNodeUploadInfo(ctx, s.userID, s.getArea(), false)
-	if err != nil {
-		return cid.Cid{}, err
-	}
+// UploadFilesWithResult is UploadFilesWithPath which returns the result of the upload
+//
+// Deprecated: use Upload with PathSource and UploadAsCar
+func (s *storage) UploadFilesWithResult(ctx context.Context, filePath string, progress ProgressFunc, makeCar bool) (*UploadResult, error) {
+	return s.Upload(ctx, PathSource(filePath), UploadProgress(progress), UploadAsCar(makeCar))
+}
 
-	if rsp.AlreadyExists {
-		return cid.Cid{}, fmt.Errorf("file already exists")
-	}
+// Delete deletes the specified asset by rootCID
+func (s *storage) Delete(ctx context.Context, rootCID string) error {
+	return s.webAPI.DeleteAsset(ctx, s.userID, rootCID)
+}
 
-	if len(rsp.List) == 0 {
-		return cid.Cid{}, fmt.Errorf("endpoints is empty")
-	}
+// UploadStream uploads a stream of data, the car is generated while it is uploaded.
+// r is read more than once, if it is not seekable it is spilled to a temporary file.
+//
+// Deprecated: use Upload with ReaderSource and UploadAsCar(true)
+func (s *storage) UploadStream(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (cid.Cid, error) {
+	return resultCID(s.Upload(ctx, ReaderSource(r), UploadName(name), UploadProgress(progress), UploadAsCar(true)))
+}
 
-	f, err := os.Open(filePath)
+// uploadStream uploads the data opened by open as car, the car is generated while it is uploaded
+func (s *storage) uploadStream(ctx context.Context, open SourceFunc, name string, o *uploadOptions) (*UploadResult, error) {
+	enc, err := s.newEncrypter(ctx)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, err
 	}
-	defer f.Close()
 
-	node := rsp.List[0]
+	if enc != nil {
+		open = enc.source(open)
+	}
 
-	ret, err := s.uploadFileWithForm(ctx, f, f.Name(), node.UploadURL, node.Token, rsp.TraceID, progress)
+	plan, err := planCar(sourceWalker(open, s.importOptions(ctx)))
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("upload file with form failed, %s", err.Error())
+		return nil, err
 	}
+	root := plan.root
 
-	if ret.Code != 0 {
-		return cid.Cid{}, fmt.Errorf("upload file with form failed, %s", ret.Msg)
+	groupID, err := s.uploadGroup(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	root, err := cid.Decode(ret.Cid)
-	if err != nil {
-		return cid.Cid{}, fmt.Errorf("decode cid %s failed, %s", ret.Cid, err.Error())
+	if len(name) == 0 {
+		name = root.String()
 	}
 
-	fileType, err := getFileType(filePath)
-	if err != nil {
-		return cid.Cid{}, err
+	assetProperty := client.AssetProperty{
+		AssetCID:  root.String(),
+		AssetName: name,
+		AssetSize: plan.size,
+		AssetType: string(FileTypeFile),
+		NodeID:    s.candidateID,
+		GroupID:   groupID,
+		Encrypted: enc != nil,
 	}
 
-	fileInfo, err := f.Stat()
+	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.uploadAreas(ctx)}
+	rsp, err := s.webAPI.CreateAsset(ctx, &req)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, fmt.Errorf("CreateAsset error %w", err)
 	}
 
-	fmt.Printf("f name %s, fileInfo name %s", f.Name(), fileInfo.Name())
-
-	assetProperty := client.AssetProperty{
-		AssetCID:  ret.Cid,
-		AssetName: fileInfo.Name(),
-		AssetSize: fileInfo.Size(),
-		AssetType: fileType,
-		NodeID:    node.NodeID,
-		GroupID:   s.groupID,
+	res := &UploadResult{CID: root, Name: name, Size: plan.size}
+	if rsp.IsAlreadyExist {
+		res.AlreadyExisted = true
+		return res, nil
 	}
 
-	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.areas}
-	_, err = s.webAPI.CreateAsset(context.Background(), &req)
+	success, attempts, err := s.uploadCar(ctx, rsp.Endpoints, plan.open, root.String(), root, o)
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("CreateAsset error %w", err)
+		return nil, err
 	}
+	res.setAttempts(success, attempts)
 
-	return root, nil
-
+	return res, nil
 }
 
-// Delete deletes the specified asset by rootCID
-func (s *storage) Delete(ctx context.Context, rootCID string) error {
-	return s.webAPI.DeleteAsset(ctx, s.userID, rootCID)
+// UploadStreamV2 uploads data from an io.Reader stream without making car to the titan storage.
+// r is streamed to the L1 node, if r is not seekable it is spilled to a temporary file to retry on other nodes.
+//
+// Deprecated: use Upload with ReaderSource
+func (s *storage) UploadStreamV2(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (cid.Cid, error) {
+	return resultCID(s.Upload(ctx, ReaderSource(r), UploadName(name), UploadProgress(progress)))
 }
 
-// UploadStream uploads a stream of data
-func (s *storage) UploadStream(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (cid.Cid, error) {
-	memFile := memfile.New([]byte{})
-	root, err := createCarStream(r, memFile)
-	if err != nil {
-		return cid.Cid{}, err
-	}
-	memFile.Seek(0, 0)
+// UploadStreamWithResult is UploadStreamV2 which returns the result of the upload
+//
+// Deprecated: use Upload with ReaderSource
+func (s *storage) UploadStreamWithResult(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (*UploadResult, error) {
+	return s.Upload(ctx, ReaderSource(r), UploadName(name), UploadProgress(progress))
+}
 
-	if len(name) == 0 {
-		name = root.String()
-	}
+// UploadStreamFunc uploads the data opened by open without making car to the titan storage,
+// open is called again to retry the upload on next node, and may be called concurrently
+// if the upload strategy is UploadRace or UploadFanOut.
+//
+// Deprecated: use Upload with the SourceFunc
+func (s *storage) UploadStreamFunc(ctx context.Context, open SourceFunc, name string, progress ProgressFunc) (cid.Cid, error) {
+	return resultCID(s.Upload(ctx, open, UploadName(name), UploadProgress(progress)))
+}
 
-	assetProperty := client.AssetProperty{
-		AssetCID:  root.String(),
-		AssetName: name,
-		AssetSize: int64(len(memFile.Bytes())),
-		AssetType: string(FileTypeFile),
-		NodeID:    s.candidateID,
-		GroupID:   s.groupID,
+// uploadStreamFunc uploads the data opened by open without making car, unless it has import options
+func (s *storage) uploadStreamFunc(ctx context.Context, open SourceFunc, name string, o *uploadOptions) (*UploadResult, error) {
+	if s.importOptions(ctx) != nil {
+		return s.uploadStream(ctx, open, name, o)
 	}
 
-	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.areas}
-	rsp, err := s.webAPI.CreateAsset(ctx, &req)
+	enc, err := s.newEncrypter(ctx)
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("CreateAsset error %w", err)
+		return nil, err
 	}
-	// fmt.Printf("CreateAsset rsp %+v\n", rsp)
-	// for i, v := range rsp.Endpoints {
-	// 	fmt.Printf("endpoint[%d] %+v\n", i, v)
-	// }
-	if rsp.IsAlreadyExist {
-		return root, nil
+
+	if enc != nil {
+		open = enc.source(open)
 	}
 
-	c := len(rsp.Endpoints)
-	for i, ep := range rsp.Endpoints {
-		_, err = s.uploadFileWithForm(ctx, memFile, root.String(), ep.CandidateAddr, ep.Token, ep.TraceID, progress)
+	// the encrypted data is different every time, so it is never deduplicated
+	var localRoot cid.Cid
+	if enc == nil && s.dedupUpload(o) {
+		localRoot, err = localCid(open, s.importOptions(ctx))
 		if err != nil {
-			// fmt.Printf("upload req: %+v\n", ep)
-			// return cid.Cid{}, fmt.Errorf("uploadFileWithForm error %s, delete it from titan", err.Error())
-			log.Printf("uploadFileWithForm error %s, delete it from titan\n", err.Error())
+			return nil, err
 		}
-		if err != nil && i+1 == c {
-			if delErr := s.webAPI.DeleteAsset(ctx, s.userID, root.String()); delErr != nil {
-				return cid.Cid{}, fmt.Errorf("uploadFileWithForm failed %s, delete error %s", err.Error(), delErr.Error())
-			}
-			return cid.Cid{}, err
+
+		exists, err := s.assetExists(ctx, localRoot)
+		if err != nil {
+			return nil, err
 		}
-		if err == nil {
-			return root, nil
+		if exists {
+			return &UploadResult{CID: localRoot, Name: name, AlreadyExisted: true}, nil
 		}
 	}
 
-	return cid.Cid{}, fmt.Errorf("upload file failed")
-}
+	groupID, err := s.uploadGroup(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-// UploadStreamV2 uploads data from an io.Reader stream without making car to the titan storage.
-func (s *storage) UploadStreamV2(ctx context.Context, r io.Reader, name string, progress ProgressFunc) (cid.Cid, error) {
-	rsp, err := s.webAPI.GetNodeUploadInfo(ctx, s.userID, s.getArea(), false)
+	rsp, err := s.webAPI.GetNodeUploadInfo(ctx, s.userID, s.getArea(ctx), false, enc != nil)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, err
 	}
 
 	if rsp.AlreadyExists {
-		return cid.Cid{}, fmt.Errorf("file already exists")
+		if localRoot.Defined() {
+			return &UploadResult{CID: localRoot, Name: name, AlreadyExisted: true}, nil
+		}
+		return nil, fmt.Errorf("file %w", client.ErrAlreadyExists)
 	}
 
 	if len(rsp.List) == 0 {
-		return cid.Cid{}, fmt.Errorf("endpoints is empty")
+		return nil, fmt.Errorf("endpoints is empty")
 	}
 
-	// var size int64
-
-	// if f, ok := r.(*os.File); ok {
-	// 	if stat, err := f.Stat(); err != nil {
-	// 		return cid.Cid{}, fmt.Errorf("read file failed")
-	// 	} else {
-	// 		size = stat.Size()
-	// 	}
-	// }
-
-	// if seeker, ok := r.(io.Seeker); ok {
-	// 	currentPos, err := seeker.Seek(0, io.SeekCurrent)
-	// 	if err != nil {
-	// 		return cid.Cid{}, fmt.Errorf("seek content failed")
-	// 	}
-	// 	size, err = seeker.Seek(0, io.SeekEnd)
-	// 	if err != nil {
-	// 		return cid.Cid{}, fmt.Errorf("seek content failed")
-	// 	}
-	// 	_, err = seeker.Seek(currentPos, io.SeekStart)
-	// 	if err != nil {
-	// 		return cid.Cid{}, fmt.Errorf("return position failed")
-	// 	}
-	// }
-
-	// if br, ok := r.(*bytes.Reader); ok {
-	// 	size = int64(br.Len())
-	// }
-
-	// if sr, ok := r.(*strings.Reader); ok {
-	// 	size = int64(sr.Len())
-	// }
-
-	// f, err := os.Open(filePath)
-	// if err != nil {
-	// 	return cid.Cid{}, err
-	// }
-	// defer f.Close()
-
-	// node := rsp.List[0]
-
-	var (
-		ret    *UploadFileResult
-		root   cid.Cid
-		nodeId string
-	)
-
-	body := &bytes.Buffer{}
-	writer := io.MultiWriter(body)
-	io.Copy(writer, r)
-	cnt := body.Bytes()
-
-	for _, node := range rsp.List {
-		nodeId = node.NodeID
-
-		nr := bytes.NewReader(cnt)
-
-		ret, err = s.uploadFileWithForm(ctx, nr, name, node.UploadURL, node.Token, rsp.TraceID, progress)
-		if err != nil {
-			err = fmt.Errorf("upload file with form failed, error: %s", err.Error())
-			log.Println(err)
-			continue
-		}
-
-		if ret.Code != 0 {
-			err = fmt.Errorf("upload file with form failed, ret: %+v", ret)
-			log.Println(err)
-			continue
-		}
-
-		root, err = cid.Decode(ret.Cid)
-		if err != nil {
-			err = fmt.Errorf("decode cid %s failed, reason: %s", ret.Cid, err.Error())
-			log.Println(err)
-			continue
-		}
-
-		break
+	success, attempts, err := s.uploadToTargets(ctx, nodeTargets(rsp), open, name, "", o)
+	if err != nil {
+		return nil, err
 	}
 
+	ret := success.ret
+	root, err := cid.Decode(ret.Cid)
 	if err != nil {
-		return cid.Cid{}, err
+		return nil, fmt.Errorf("decode cid %s failed, reason: %s", ret.Cid, err.Error())
 	}
 
-	// fileType, err := getFileType(name)
-	// if err != nil {
-	// 	return cid.Cid{}, err
-	// }
-
-	// fileInfo, err := f.Stat()
-	// if err != nil {
-	// 	return cid.Cid{}, err
-	// }
-
-	log.Printf("f name %s, fileType name %s \n", name, "file")
+	if localRoot.Defined() && !localRoot.Equals(root) {
+		log.Printf("node %s returns cid %s, the local cid is %s", success.target.NodeID, root.String(), localRoot.String())
+	}
 
 	assetProperty := client.AssetProperty{
 		AssetCID:  ret.Cid,
 		AssetName: name,
 		AssetSize: ret.totalSize,
 		AssetType: "file",
-		NodeID:    nodeId,
-		GroupID:   s.groupID,
+		NodeID:    success.target.NodeID,
+		GroupID:   groupID,
+		Encrypted: enc != nil,
 	}
 
-	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.areas}
-	_, err = s.webAPI.CreateAsset(context.Background(), &req)
+	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.uploadAreas(ctx)}
+	created, err := s.webAPI.CreateAsset(context.Background(), &req)
 	if err != nil {
-		return cid.Cid{}, fmt.Errorf("CreateAsset error %w", err)
+		return nil, fmt.Errorf("CreateAsset error %w", err)
 	}
 
-	return root, nil
-
+	res := &UploadResult{CID: root, Name: name, Size: ret.totalSize, AlreadyExisted: created.IsAlreadyExist}
+	res.setAttempts(success, attempts)
+	return res, nil
 }
 
 // GetFileWithCid gets a single file by rootCID
@@ -505,7 +402,7 @@ func (s *storage) GetFileWithCid(ctx context.Context, rootCID string) (io.ReadCl
 
 	start := time.Now()
 
-	r := byterange.New(1 << 20)
+	r := byterange.NewWithOptions(1<<20, s.opts)
 
 	reader, size, err := r.GetFile(ctx, res)
 
@@ -528,6 +425,11 @@ func (s *storage) GetFileWithCid(ctx context.Context, rootCID string) (io.ReadCl
 		}
 	}()
 
+	if err != nil {
+		return nil, res.FileName, err
+	}
+
+	reader, err = s.decryptReadCloser(ctx, reader)
 	return reader, res.FileName, err
 	// taskCount := int64(len(res.URLs))
 	// if !parallel {
@@ -650,9 +552,10 @@ func (s *storage) GetURL(ctx context.Context, rootCID string) (*client.ShareAsse
 		result, err := s.webAPI.ShareAsset(ctx, s.userID, "", rootCID)
 		if err != nil {
 			log.Printf("ShareUserAsset %v, cid: %s \n", err.Error(), rootCID)
-			// if err.Error() != errAssetNotExist(rootCID).Error() {
-			// 	return nil, fmt.Errorf("ShareUserAssets %w", err)
-			// }
+			// only wait for the asset to appear
+			if errors.Is(err, client.ErrUnauthorized) {
+				return nil, fmt.Errorf("ShareUserAssets %w", err)
+			}
 			continue
 		}
 
@@ -673,12 +576,20 @@ func (s *storage) GetURL(ctx context.Context, rootCID string) (*client.ShareAsse
 	}
 }
 
-// UploadFileWithURL uploads a file from the specified URL
+// UploadFileWithURL uploads a file from the specified URL, the file is downloaded by this process
+//
+// Deprecated: use Upload with URLSource to let the node pull the url,
+// or Upload with ReaderSource of the response body
 func (s *storage) UploadFileWithURL(ctx context.Context, url string, progress ProgressFunc) (string, string, error) {
 	log.Println("UploadFileWithURL link:", url)
-	rsp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
-		log.Printf("http.Get(%s) error: %s \n", url, err)
+		return "", "", err
+	}
+
+	rsp, err := s.opts.Client().Do(req)
+	if err != nil {
+		log.Printf("get %s error: %s \n", url, err)
 		return "", "", err
 	}
 	defer rsp.Body.Close()
@@ -692,45 +603,24 @@ func (s *storage) UploadFileWithURL(ctx context.Context, url string, progress Pr
 		fmt.Println("getFileNameFromURL ", err.Error())
 	}
 
-	rootCid, err := s.UploadStreamV2(ctx, rsp.Body, filename, progress)
+	res, err := s.Upload(ctx, ReaderSource(rsp.Body), UploadName(filename), UploadProgress(progress), UploadShareURL())
 	if err != nil {
 		return "", "", err
 	}
 
-	// try 5 times to fetch url , otherwise return error
-	var res *client.ShareAssetResult
-	for i := 0; i < 1; i++ {
-		time.Sleep(time.Second * 1)
-		res, err = s.GetURL(ctx, rootCid.String())
-		if err != nil {
-			log.Printf("get url err: %s\n", err.Error())
-			continue
-		}
-		break
-	}
-
-	if res == nil {
-		return "", "", err
-	}
-
-	return rootCid.String(), res.URLs[0], nil
+	return res.CID.String(), res.URL, nil
 }
 
-// UploadFileWithURLV2 uploads a url and let L1 to download it, returns
+// UploadFileWithURLV2 uploads a url and let L1 to download it, returns the cid and the share url
+//
+// Deprecated: use Upload with URLSource and UploadShareURL
 func (s *storage) UploadFileWithURLV2(ctx context.Context, url string, progress ProgressFunc) (string, string, error) {
-
-	rsp, err := s.webAPI.GetNodeUploadInfo(ctx, s.userID, s.getArea(), true)
+	res, err := s.Upload(ctx, URLSource(url), UploadProgress(progress), UploadShareURL())
 	if err != nil {
 		return "", "", err
 	}
 
-	nodes := rsp.List
-	if len(nodes) == 0 {
-		return "", "", fmt.Errorf("endpoints is empty")
-	}
-
-	return "", "", nil
-
+	return res.CID.String(), res.URL, nil
 }
 
 func (s *storage) ListUserAssets(ctx context.Context, parent, pageSize, page int) (*client.ListAssetRecordRsp, error) {
@@ -739,6 +629,8 @@ func (s *storage) ListUserAssets(ctx context.Context, parent, pageSize, page int
 
 // CreateGroup create a group
 func (s *storage) CreateGroup(ctx context.Context, name string, parent int) error {
+	defer s.folders.reset()
+
 	_, err := s.webAPI.CreateGroup(ctx, name, parent)
 	return err
 }
@@ -750,12 +642,14 @@ func (s *storage) ListGroups(ctx context.Context, parent, pageSize, page int) (*
 
 // DeleteGroup delete special group
 func (s *storage) DeleteGroup(ctx context.Context, groupID int) error {
+	defer s.folders.reset()
+
 	return s.webAPI.DeleteGroup(ctx, s.userID, groupID)
 }
 
-func (s *storage) getArea() string {
-	if len(s.areas) > 0 {
-		return s.areas[0]
+func (s *storage) getArea(ctx context.Context) string {
+	if areas := s.uploadAreas(ctx); len(areas) > 0 {
+		return areas[0]
 	}
 	return ""
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -10,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/Filecoin-Titan/titan-storage-sdk/memfile"
+	"github.com/Titannet-dao/titan-storage-sdk/client"
 )
 
 var (
@@ -34,9 +36,9 @@ func TestCalculateCarCID(t *testing.T) {
 func TestCreateCarWithFile(t *testing.T) {
 
 	input := "./example/example.exe"
-	output := "./example/example.car"
+	output := filepath.Join(t.TempDir(), "example.car")
 
-	root, err := createCar(input, output)
+	root, err := createCar(input, output, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -53,7 +55,7 @@ func TestCreateCarWithStream(t *testing.T) {
 	defer f.Close()
 
 	mFile := memfile.New([]byte{})
-	root, err := createCarStream(f, mFile)
+	root, err := createCarStream(f, mFile, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -227,3 +229,21 @@ func TestListAsset(t *testing.T) {
 		t.Logf("cid:%s name:%s size:%d", asset.AssetRecord.CID, asset.UserAssetDetail.AssetName, asset.AssetRecord.TotalSize)
 	}
 }
+
+func TestCreateSharedLink(t *testing.T) {
+	web := &fakeWebserver{urls: func() []string { return []string{"https://node/ipfs/c1"} }}
+	s := &storage{webAPI: web}
+	ctx := context.Background()
+
+	link, err := s.CreateSharedLink(ctx, "c1", 0)
+	if err != nil || link != "https://node/ipfs/c1" {
+		t.Fatalf("unexpected link %s, error %v", link, err)
+	}
+
+	if _, err = s.CreateSharedLink(ctx, "", 3); !errors.Is(err, client.ErrNotSupported) {
+		t.Fatalf("expect the folder share not supported, got %v", err)
+	}
+	if _, err = s.CreateSharedLinkWithOptions(ctx, "c1", 0, ShareOptions{MaxVisits: 3}); !errors.Is(err, client.ErrNotSupported) {
+		t.Fatalf("expect the limits not supported, got %v", err)
+	}
+}
@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+// UploadStrategy decides how an upload uses the candidate nodes returned by the webserver
+type UploadStrategy int
+
+const (
+	// UploadSequential tries the nodes one by one until one of them succeeds
+	UploadSequential UploadStrategy = iota
+	// UploadRace uploads to the first RaceWidth nodes at the same time,
+	// the others are canceled once one of them succeeds
+	UploadRace
+	// UploadFanOut uploads to all nodes at the same time to make extra replicas
+	UploadFanOut
+)
+
+const defaultRaceWidth = 2
+
+func (us UploadStrategy) String() string {
+	switch us {
+	case UploadSequential:
+		return "sequential"
+	case UploadRace:
+		return "race"
+	case UploadFanOut:
+		return "fanout"
+	}
+	return fmt.Sprintf("UploadStrategy(%d)", int(us))
+}
+
+type strategyKey struct{}
+
+// WithUploadStrategy returns a context which makes the uploads called with it use strategy
+// instead of the one set on Config
+//
+// Deprecated: use Upload with UploadWithStrategy
+func WithUploadStrategy(ctx context.Context, strategy UploadStrategy) context.Context {
+	return context.WithValue(ctx, strategyKey{}, strategy)
+}
+
+// uploadStrategy returns the strategy of the upload with the options o
+func (s *storage) uploadStrategy(o *uploadOptions) UploadStrategy {
+	if o.strategy != nil {
+		return *o.strategy
+	}
+	return s.strategy
+}
+
+// uploadTarget is a node which accepts the upload
+type uploadTarget struct {
+	NodeID  string
+	URL     string
+	Token   string
+	TraceID string
+}
+
+// uploadAttempt is the outcome of uploading to a node
+type uploadAttempt struct {
+	target uploadTarget
+	ret    *UploadFileResult
+	err    error
+	cost   time.Duration
+}
+
+// endpointTargets returns the targets of the endpoints returned by CreateAsset
+func endpointTargets(endpoints []*client.Endpoint) []uploadTarget {
+	targets := make([]uploadTarget, 0, len(endpoints))
+	for _, ep := range endpoints {
+		targets = append(targets, uploadTarget{
+			NodeID:  getNodeIdFromCandidateAddr(ep.CandidateAddr),
+			URL:     ep.CandidateAddr,
+			Token:   ep.Token,
+			TraceID: ep.TraceID,
+		})
+	}
+	return targets
+}
+
+// nodeTargets returns the targets of the nodes returned by GetNodeUploadInfo
+func nodeTargets(info *client.UploadInfo) []uploadTarget {
+	targets := make([]uploadTarget, 0, len(info.List))
+	for _, node := range info.List {
+		targets = append(targets, uploadTarget{
+			NodeID:  node.NodeID,
+			URL:     node.UploadURL,
+			Token:   node.Token,
+			TraceID: info.TraceID,
+		})
+	}
+	return targets
+}
+
+// uploadToTargets uploads the data opened by open to the targets with the strategy of o.
+// It returns the succeeded attempt and all attempts, every attempt is sent as a transfer report.
+// open is called once per attempt, and may be called concurrently by UploadRace and UploadFanOut.
+func (s *storage) uploadToTargets(ctx context.Context, targets []uploadTarget, open SourceFunc, name, rootCID string, o *uploadOptions) (*uploadAttempt, []*uploadAttempt, error) {
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("endpoints is empty")
+	}
+
+	upload := func(ctx context.Context, t uploadTarget, progress ProgressFunc) *uploadAttempt {
+		start := time.Now()
+		attempt := &uploadAttempt{target: t}
+
+		r, err := open()
+		if err != nil {
+			attempt.err = err
+			return attempt
+		}
+		defer r.Close()
+
+		attempt.ret, attempt.err = s.uploadFileWithForm(ctx, r, name, t.URL, t.Token, progress)
+		attempt.cost = time.Since(start)
+		return attempt
+	}
+
+	var (
+		success  *uploadAttempt
+		attempts []*uploadAttempt
+	)
+
+	progress := o.progress
+	switch strategy := s.uploadStrategy(o); strategy {
+	case UploadRace, UploadFanOut:
+		width := len(targets)
+		if strategy == UploadRace {
+			width = s.raceWidth
+		}
+		if width <= 0 {
+			width = defaultRaceWidth
+		}
+
+		progress = monotonicProgress(progress)
+		for i := 0; i < len(targets) && success == nil; i += width {
+			end := i + width
+			if end > len(targets) {
+				end = len(targets)
+			}
+
+			var wave []*uploadAttempt
+			success, wave = concurrentUpload(ctx, targets[i:end], strategy == UploadRace, upload, progress)
+			attempts = append(attempts, wave...)
+		}
+	default:
+		for _, t := range targets {
+			attempt := upload(ctx, t, progress)
+			attempts = append(attempts, attempt)
+			if attempt.err == nil {
+				success = attempt
+				break
+			}
+			log.Printf("upload to node %s failed, %s", t.NodeID, attempt.err.Error())
+		}
+	}
+
+	s.reportAttempts(attempts, rootCID)
+
+	if success == nil {
+		return nil, attempts, &UploadError{Attempts: newUploadAttempts(attempts), err: fmt.Errorf("upload file failed, %w", attemptsError(attempts))}
+	}
+
+	return success, attempts, nil
+}
+
+// concurrentUpload uploads to all targets at the same time, if cancelLosers is true
+// the other uploads are canceled once one succeeds. It returns the first succeeded attempt.
+func concurrentUpload(ctx context.Context, targets []uploadTarget, cancelLosers bool,
+	upload func(context.Context, uploadTarget, ProgressFunc) *uploadAttempt, progress ProgressFunc) (*uploadAttempt, []*uploadAttempt) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		success  *uploadAttempt
+		attempts = make([]*uploadAttempt, len(targets))
+	)
+
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t uploadTarget) {
+			defer wg.Done()
+
+			attempt := upload(ctx, t, progress)
+			attempts[i] = attempt
+
+			lock.Lock()
+			defer lock.Unlock()
+			if attempt.err == nil && success == nil {
+				success = attempt
+				if cancelLosers {
+					cancel()
+				}
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	return success, attempts
+}
+
+// monotonicProgress makes the progress reported by concurrent uploads never go backwards
+func monotonicProgress(progress ProgressFunc) ProgressFunc {
+	if progress == nil {
+		return nil
+	}
+
+	var (
+		lock     sync.Mutex
+		lastDone int64
+	)
+	return func(doneSize int64, totalSize int64) {
+		lock.Lock()
+		defer lock.Unlock()
+		if doneSize > lastDone {
+			lastDone = doneSize
+			progress(doneSize, totalSize)
+		}
+	}
+}
+
+// reportAttempts sends a transfer report for every attempt
+func (s *storage) reportAttempts(attempts []*uploadAttempt, rootCID string) {
+	for _, attempt := range attempts {
+		report := &client.AssetTransferReq{
+			TraceID:      attempt.target.TraceID,
+			NodeID:       attempt.target.NodeID,
+			Cid:          rootCID,
+			CostMs:       attempt.cost.Milliseconds(),
+			TransferType: client.AssetTransferTypeUpload,
+			State:        client.AssetTransferStateFailed,
+		}
+
+		if attempt.err != nil {
+			report.Log = attempt.err.Error()
+		} else {
+			report.State = client.AssetTransferStateSuccess
+			report.TotalSize = attempt.ret.totalSize
+			if report.Cid == "" {
+				report.Cid = attempt.ret.Cid
+			}
+		}
+
+		s.sendTransferReport(report)
+	}
+}
+
+// attemptsError joins the errors of the failed attempts
+func attemptsError(attempts []*uploadAttempt) error {
+	msgs := make([]string, 0, len(attempts))
+	for _, attempt := range attempts {
+		if attempt.err != nil {
+			msgs = append(msgs, fmt.Sprintf("node %s: %s", attempt.target.NodeID, attempt.err.Error()))
+		}
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestUploadStreamRace(t *testing.T) {
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(3)).Read(data)
+
+	canceled := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+		close(canceled)
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		io.Copy(io.Discard, f)
+		json.NewEncoder(w).Encode(UploadFileResult{})
+	}))
+	defer fast.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint {
+			return []*client.Endpoint{{CandidateAddr: slow.URL, TraceID: "slow"}, {CandidateAddr: fast.URL, TraceID: "fast"}}
+		},
+	}
+	s := &storage{webAPI: web, strategy: UploadSequential}
+
+	_, err := s.Upload(context.Background(), ReaderSource(bytes.NewReader(data)), UploadName("data.bin"), UploadAsCar(true), UploadWithStrategy(UploadRace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow upload is not canceled")
+	}
+
+	// reports are sent in background
+	time.Sleep(100 * time.Millisecond)
+
+	web.lock.Lock()
+	defer web.lock.Unlock()
+
+	states := make(map[string]int64)
+	for _, r := range web.reports {
+		states[r.TraceID] = r.State
+	}
+	if states["fast"] != client.AssetTransferStateSuccess || states["slow"] != client.AssetTransferStateFailed {
+		t.Fatalf("unexpected transfer reports %+v", web.reports)
+	}
+}
@@ -35,10 +35,12 @@ type Tenant interface {
 type tenant struct {
 	titanUrl  string
 	tenantKey string
-	client    *http.Client
+	opts      *client.Options
 }
 
-func NewTenant(titanUrl, tenantKey string) (Tenant, error) {
+// NewTenant returns the Tenant of the titan web server, the calls are made with the client,
+// timeouts and retries of opts, the login is never retried.
+func NewTenant(titanUrl, tenantKey string, opts ...client.Option) (Tenant, error) {
 	if len(titanUrl) == 0 || len(tenantKey) == 0 {
 		return nil, fmt.Errorf("TitanURL or APIKey can not empty")
 	}
@@ -46,7 +48,7 @@ func NewTenant(titanUrl, tenantKey string) (Tenant, error) {
 	return &tenant{
 		titanUrl:  titanUrl,
 		tenantKey: tenantKey,
-		client:    http.DefaultClient,
+		opts:      client.NewOptions(opts...),
 	}, nil
 }
 
@@ -78,14 +80,13 @@ func (t *tenant) SSOLogin(ctx context.Context, req SubUserInfo) (*SSOLoginRsp, e
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("tenant-api-key", t.tenantKey)
-	rsp, err := t.client.Do(request)
+	rsp, err := t.opts.Do(request, false)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, client.NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -100,7 +101,7 @@ func (t *tenant) SSOLogin(ctx context.Context, req SubUserInfo) (*SSOLoginRsp, e
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, client.NewAPIError(rsp, ret)
 	}
 
 	ssoLoginRsp := &SSOLoginRsp{}
@@ -128,14 +129,13 @@ func (t *tenant) SyncUser(ctx context.Context, req SubUserInfo) error {
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("tenant-api-key", t.tenantKey)
-	rsp, err := t.client.Do(request)
+	rsp, err := t.opts.Do(request, true)
 	if err != nil {
 		return err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return client.NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -150,7 +150,7 @@ func (t *tenant) SyncUser(ctx context.Context, req SubUserInfo) error {
 	}
 
 	if ret.Code != 0 {
-		return fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return client.NewAPIError(rsp, ret)
 	}
 
 	return nil
@@ -167,14 +167,13 @@ func (t *tenant) DeleteUser(ctx context.Context, entryUUID string, withAssets bo
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("tenant-api-key", t.tenantKey)
-	rsp, err := t.client.Do(request)
+	rsp, err := t.opts.Do(request, true)
 	if err != nil {
 		return err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return client.NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -189,7 +188,7 @@ func (t *tenant) DeleteUser(ctx context.Context, entryUUID string, withAssets bo
 	}
 
 	if ret.Code != 0 {
-		return fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return client.NewAPIError(rsp, ret)
 	}
 
 	return nil
@@ -206,14 +205,14 @@ func (t *tenant) RefreshToken(ctx context.Context, token string) (*SSOLoginRsp,
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("tenant-api-key", t.tenantKey)
-	rsp, err := t.client.Do(request)
+	// a refresh issues a new token, so it is not retried
+	rsp, err := t.opts.Do(request, false)
 	if err != nil {
 		return nil, err
 	}
 
 	if rsp.StatusCode != http.StatusOK {
-		buf, _ := io.ReadAll(rsp.Body)
-		return nil, fmt.Errorf("status code %d, %s", rsp.StatusCode, string(buf))
+		return nil, client.NewAPIError(rsp, nil)
 	}
 
 	body, err := io.ReadAll(rsp.Body)
@@ -228,7 +227,7 @@ func (t *tenant) RefreshToken(ctx context.Context, token string) (*SSOLoginRsp,
 	}
 
 	if ret.Code != 0 {
-		return nil, fmt.Errorf(fmt.Sprintf("code: %d, err: %d, msg: %s", ret.Code, ret.Err, ret.Msg))
+		return nil, client.NewAPIError(rsp, ret)
 	}
 
 	ssoLoginRsp := &SSOLoginRsp{}
@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Source is the data of an upload, it is returned by PathSource, ReaderSource, BytesSource
+// and URLSource, a SourceFunc is a Source too.
+type Source interface {
+	isSource()
+}
+
+type pathSource string
+
+type readerSource struct {
+	r io.Reader
+}
+
+type bytesSource []byte
+
+type urlSource string
+
+func (pathSource) isSource()   {}
+func (readerSource) isSource() {}
+func (bytesSource) isSource()  {}
+func (urlSource) isSource()    {}
+func (SourceFunc) isSource()   {}
+
+// PathSource returns the Source of a local file or folder, a folder is always uploaded as car
+func PathSource(path string) Source {
+	return pathSource(path)
+}
+
+// ReaderSource returns the Source of r, r is read more than once,
+// if it is not seekable it is spilled to a temporary file.
+func ReaderSource(r io.Reader) Source {
+	return readerSource{r: r}
+}
+
+// BytesSource returns the Source of data in memory
+func BytesSource(data []byte) Source {
+	return bytesSource(data)
+}
+
+// URLSource returns the Source of a http or https url, the url is pulled by a node,
+// so the data never passes through this process.
+func URLSource(rawURL string) Source {
+	return urlSource(rawURL)
+}
+
+// UploadOption changes an upload made by Upload
+type UploadOption func(*uploadOptions)
+
+type uploadOptions struct {
+	name     string
+	folder   *folderTarget
+	areas    []string
+	car      bool
+	dag      *ImportOptions
+	progress ProgressFunc
+	retries  int
+	encrypt  *bool
+	strategy *UploadStrategy
+	dedup    *bool
+	shareURL bool
+}
+
+// newUploadOptions returns the options of an upload called with ctx, the strategy, the dedup and the share URL
+// set on ctx by the deprecated WithUploadStrategy, WithDedup and WithShareURL are used unless opts change them
+func newUploadOptions(ctx context.Context, opts ...UploadOption) *uploadOptions {
+	o := &uploadOptions{}
+	if strategy, ok := ctx.Value(strategyKey{}).(UploadStrategy); ok {
+		o.strategy = &strategy
+	}
+	if dedup, ok := ctx.Value(dedupKey{}).(bool); ok {
+		o.dedup = &dedup
+	}
+	o.shareURL, _ = ctx.Value(shareURLKey{}).(bool)
+
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// UploadName sets the name of the asset, it is the base name of the path,
+// the name in the url or the cid by default.
+func UploadName(name string) UploadOption {
+	return func(o *uploadOptions) {
+		o.name = name
+	}
+}
+
+// UploadFolderID uploads the asset into the folder instead of Config.GroupID, 0 is the root folder
+func UploadFolderID(folderID int) UploadOption {
+	return func(o *uploadOptions) {
+		o.folder = &folderTarget{id: folderID}
+	}
+}
+
+// UploadFolderPath uploads the asset into the folder at folderPath instead of Config.GroupID,
+// e.g. /invoices/2026/10, the missing folders are created if create is true.
+func UploadFolderPath(folderPath string, create bool) UploadOption {
+	return func(o *uploadOptions) {
+		o.folder = &folderTarget{path: folderPath, create: create, byPath: true}
+	}
+}
+
+// UploadAreas uploads the asset to the areas instead of the ones set by SetAreas
+func UploadAreas(areas ...string) UploadOption {
+	return func(o *uploadOptions) {
+		o.areas = areas
+	}
+}
+
+// UploadAsCar makes the car locally and uploads it, instead of letting the node make it.
+// Folders and uploads with UploadDAGOptions are always uploaded as car.
+func UploadAsCar(car bool) UploadOption {
+	return func(o *uploadOptions) {
+		o.car = car
+	}
+}
+
+// UploadDAGOptions builds the car with opts, see WithImportOptions
+func UploadDAGOptions(opts *ImportOptions) UploadOption {
+	return func(o *uploadOptions) {
+		o.dag = opts
+	}
+}
+
+// UploadProgress reports the progress of the upload to progress
+func UploadProgress(progress ProgressFunc) UploadOption {
+	return func(o *uploadOptions) {
+		o.progress = progress
+	}
+}
+
+// UploadRetries uploads again up to retries times with new nodes if the upload failed on all nodes
+func UploadRetries(retries int) UploadOption {
+	return func(o *uploadOptions) {
+		o.retries = retries
+	}
+}
+
+// UploadEncrypted encrypts the upload or not, instead of Config.EncryptUploads, see WithEncryption
+func UploadEncrypted(encrypt bool) UploadOption {
+	return func(o *uploadOptions) {
+		o.encrypt = &encrypt
+	}
+}
+
+// UploadWithStrategy uploads with strategy instead of Config.UploadStrategy
+func UploadWithStrategy(strategy UploadStrategy) UploadOption {
+	return func(o *uploadOptions) {
+		o.strategy = &strategy
+	}
+}
+
+// UploadDedup skips the upload if the asset is already stored or not, instead of Config.Dedup
+func UploadDedup(dedup bool) UploadOption {
+	return func(o *uploadOptions) {
+		o.dedup = &dedup
+	}
+}
+
+// UploadShareURL waits for the share URL of the asset and sets UploadResult.URL
+func UploadShareURL() UploadOption {
+	return func(o *uploadOptions) {
+		o.shareURL = true
+	}
+}
+
+type areasKey struct{}
+
+// uploadAreas returns the areas of the upload called with ctx
+func (s *storage) uploadAreas(ctx context.Context) []string {
+	if areas, ok := ctx.Value(areasKey{}).([]string); ok {
+		return areas
+	}
+	return s.areas
+}
+
+// Upload uploads src to the titan storage, the options change the name, the folder, the areas and
+// how it is uploaded. The share URL of the result is set with UploadShareURL,
+// if the upload failed on all nodes the error is an *UploadError.
+func (s *storage) Upload(ctx context.Context, src Source, opts ...UploadOption) (*UploadResult, error) {
+	o := newUploadOptions(ctx, opts...)
+	if o.retries < 0 {
+		return nil, fmt.Errorf("retries can not be negative")
+	}
+
+	if o.folder != nil {
+		ctx = context.WithValue(ctx, folderKey{}, *o.folder)
+	}
+	if o.areas != nil {
+		ctx = context.WithValue(ctx, areasKey{}, o.areas)
+	}
+	if o.dag != nil {
+		ctx = WithImportOptions(ctx, o.dag)
+	}
+	if o.encrypt != nil {
+		ctx = WithEncryption(ctx, *o.encrypt)
+	}
+
+	// resolve the folder path once for all retries
+	folderID, err := s.uploadGroup(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx = WithFolderID(ctx, folderID)
+
+	// the reader is read again by every retry
+	if src, ok := src.(readerSource); ok {
+		if src.r == nil {
+			return nil, fmt.Errorf("reader can not be nil")
+		}
+
+		open, cleanup, err := newReplayableSource(src.r, s.uploadStrategy(o) != UploadSequential)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+
+		return s.withResult(ctx, o, func() (*UploadResult, error) {
+			return s.uploadWithRetries(ctx, open, o)
+		})
+	}
+
+	return s.withResult(ctx, o, func() (*UploadResult, error) {
+		return s.uploadWithRetries(ctx, src, o)
+	})
+}
+
+// uploadWithRetries uploads src again if the upload failed on all nodes
+func (s *storage) uploadWithRetries(ctx context.Context, src Source, o *uploadOptions) (*UploadResult, error) {
+	var uploadErr *UploadError
+	for i := 0; ; i++ {
+		res, err := s.upload(ctx, src, o)
+		if err == nil || i >= o.retries || !errors.As(err, &uploadErr) || ctx.Err() != nil {
+			return res, err
+		}
+		log.Printf("upload failed on all nodes, retry %d/%d: %s", i+1, o.retries, err.Error())
+	}
+}
+
+// upload uploads src once
+func (s *storage) upload(ctx context.Context, src Source, o *uploadOptions) (*UploadResult, error) {
+	var open SourceFunc
+	name := o.name
+
+	switch src := src.(type) {
+	case urlSource:
+		if o.car || s.importOptions(ctx) != nil {
+			return nil, fmt.Errorf("the url is pulled by the node as it is, it can not be uploaded as car")
+		}
+		return s.uploadURL(ctx, string(src), name, o.progress)
+	case pathSource:
+		path := string(src)
+		if len(name) == 0 {
+			name = filepath.Base(path)
+		}
+
+		fileType, err := getFileType(path)
+		if err != nil {
+			return nil, err
+		}
+
+		// the node lays out the data by its own way, so make car to keep the import options
+		if fileType == string(FileTypeFolder) || o.car || s.importOptions(ctx) != nil {
+			return s.uploadFilesWithPathAndMakeCar(ctx, path, name, o)
+		}
+
+		open = func() (io.ReadCloser, error) {
+			return os.Open(path)
+		}
+	case bytesSource:
+		open = func() (io.ReadCloser, error) {
+			return sizedNopCloser(bytes.NewReader(src), int64(len(src))), nil
+		}
+	case SourceFunc:
+		if src == nil {
+			return nil, fmt.Errorf("source can not be nil")
+		}
+		open = src
+	default:
+		return nil, fmt.Errorf("unsupported source %T", src)
+	}
+
+	if o.car {
+		return s.uploadStream(ctx, open, name, o)
+	}
+	return s.uploadStreamFunc(ctx, open, name, o)
+}
+
+// uploadURL lets a node pull rawURL and waits for it
+func (s *storage) uploadURL(ctx context.Context, rawURL, name string, progress ProgressFunc) (*UploadResult, error) {
+	jobID, err := s.submitURLUpload(ctx, rawURL, name)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := s.urlJobs.get(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := s.WaitURLUpload(ctx, jobID, progress)
+	if err != nil {
+		if job != nil && job.State == URLUploadFailed {
+			// the node failed, so it can be retried with another one
+			return nil, &UploadError{Attempts: []UploadAttempt{{NodeID: ref.NodeID, Err: err}}, err: err}
+		}
+		return nil, err
+	}
+
+	root, err := cid.Decode(job.CID)
+	if err != nil {
+		return nil, fmt.Errorf("decode cid %s failed, reason: %s", job.CID, err.Error())
+	}
+
+	return &UploadResult{
+		CID:      root,
+		Name:     job.FileName,
+		Size:     job.Size,
+		NodeID:   ref.NodeID,
+		TraceID:  ref.TraceID,
+		Attempts: []UploadAttempt{{NodeID: ref.NodeID}},
+	}, nil
+}
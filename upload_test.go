@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestUploadOptions(t *testing.T) {
+	data := []byte("hello titan")
+	root, err := CalculateCid(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer bad.Close()
+
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, _ := CalculateCid(f)
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: c.String()})
+	}))
+	defer good.Close()
+
+	// the first request of nodes returns the failing node only
+	var calls int
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return []*client.Endpoint{{}} },
+		nodes: func() []*client.NodeUploadInfo {
+			calls++
+			if calls == 1 {
+				return []*client.NodeUploadInfo{{UploadURL: bad.URL, NodeID: "bad"}}
+			}
+			return []*client.NodeUploadInfo{{UploadURL: good.URL, NodeID: "good"}}
+		},
+	}
+	s := &storage{webAPI: web, groupID: 1, areas: []string{"default"}}
+
+	res, err := s.Upload(context.Background(), BytesSource(data), UploadName("doc.txt"), UploadFolderID(7), UploadAreas("a1"), UploadRetries(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.CID.Equals(root) || res.NodeID != "good" || res.Name != "doc.txt" || calls != 2 {
+		t.Fatalf("unexpected result %+v after %d calls", res, calls)
+	}
+
+	created := web.created[0]
+	if created.AssetName != "doc.txt" || created.GroupID != 7 || len(created.AreaIDs) != 1 || created.AreaIDs[0] != "a1" {
+		t.Fatalf("unexpected asset %+v", created)
+	}
+
+	// without retries the failure of all nodes is returned
+	calls = 0
+	_, err = s.Upload(context.Background(), ReaderSource(bytes.NewReader(data)))
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) || len(uploadErr.Attempts) != 1 || uploadErr.Attempts[0].NodeID != "bad" {
+		t.Fatalf("expect an UploadError of the bad node, got %v", err)
+	}
+
+	// the default folder and areas are kept
+	res, err = s.Upload(context.Background(), ReaderSource(bytes.NewReader(data)), UploadName("doc.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created := web.created[len(web.created)-1]; created.GroupID != 1 || created.AreaIDs[0] != "default" {
+		t.Fatalf("unexpected asset %+v", created)
+	}
+
+	if _, err = s.Upload(context.Background(), URLSource("https://example.com/a.txt"), UploadAsCar(true)); err == nil {
+		t.Fatal("expect the url can not be uploaded as car")
+	}
+}
+
+func TestUploadFolderPath(t *testing.T) {
+	data := []byte("invoice")
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c, _ := CalculateCid(f)
+		json.NewEncoder(w).Encode(UploadFileResult{Cid: c.String()})
+	}))
+	defer node.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return []*client.Endpoint{{}} },
+		nodes:     func() []*client.NodeUploadInfo { return []*client.NodeUploadInfo{{UploadURL: node.URL, NodeID: "n1"}} },
+		groups:    []*client.AssetGroup{{ID: 3, Name: "invoices"}, {ID: 4, Name: "2026", Parent: 3}},
+	}
+	s := &storage{webAPI: web, groupID: 9}
+
+	ctx := context.Background()
+	if _, err := s.ResolveFolder(ctx, "/invoices/2026/10", false); !errors.Is(err, ErrFolderNotFound) {
+		t.Fatalf("expect ErrFolderNotFound, got %v", err)
+	}
+
+	if _, err := s.Upload(ctx, BytesSource(data), UploadName("a.pdf"), UploadFolderPath("/invoices/2026/10", true)); err != nil {
+		t.Fatal(err)
+	}
+	if len(web.groups) != 3 || web.groups[2].Name != "10" || web.groups[2].Parent != 4 {
+		t.Fatalf("unexpected groups %+v", web.groups)
+	}
+	folderID := web.groups[2].ID
+
+	// the created folder is found again, the legacy uploads take the folder from ctx
+	if _, err := s.UploadStreamV2(WithFolderPath(ctx, "invoices/2026/10/", false), bytes.NewReader(data), "b.pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UploadStreamV2(WithFolderID(ctx, 4), bytes.NewReader(data), "c.pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.UploadStreamV2(ctx, bytes.NewReader(data), "d.pdf", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{folderID, folderID, 4, 9}
+	for i, created := range web.created {
+		if created.GroupID != want[i] {
+			t.Fatalf("asset %s is in folder %d, want %d", created.AssetName, created.GroupID, want[i])
+		}
+	}
+	if len(web.groups) != 3 {
+		t.Fatalf("unexpected groups %+v", web.groups)
+	}
+
+	if _, err := s.ResolveFolder(ctx, "/invoices/../x", true); err == nil {
+		t.Fatal("expect invalid folder path")
+	}
+	if id, err := s.ResolveFolder(ctx, "/", false); err != nil || id != 0 {
+		t.Fatalf("expect the root folder, got %d %v", id, err)
+	}
+}
@@ -0,0 +1,469 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/go-cid"
+)
+
+// URLUploadState is the state of a url pulled by a node
+type URLUploadState string
+
+const (
+	URLUploadPending     URLUploadState = "pending"
+	URLUploadDownloading URLUploadState = "downloading"
+	URLUploadDone        URLUploadState = "done"
+	URLUploadFailed      URLUploadState = "failed"
+)
+
+// urlPollInterval is the interval of querying a url upload job
+var urlPollInterval = 2 * time.Second
+
+const (
+	// urlJobTTL is how long a finished url upload job can still be queried, it is dropped then
+	urlJobTTL = 10 * time.Minute
+	// urlWatchErrors is the number of failed queries in a row after which a job is no longer watched
+	urlWatchErrors = 10
+)
+
+// URLUploadJob is a url pulled by a node into the titan storage
+type URLUploadJob struct {
+	// ID queries the job later, it is an opaque handle which is only known by the storage
+	// which submitted the job, it can not be queried by another process
+	ID       string
+	URL      string
+	FileName string
+	State    URLUploadState
+	// CID is set once the state is URLUploadDone
+	CID string
+	// Downloaded and Size are the bytes pulled by the node, Size is 0 if it is unknown
+	Downloaded int64
+	Size       int64
+	// Error is the reason if the state is URLUploadFailed
+	Error string
+}
+
+// urlJobRef is the node and job behind URLUploadJob.ID, it is kept in process
+// so the upload token of the node is never handed out
+type urlJobRef struct {
+	NodeID    string
+	UploadURL string
+	Token     string
+	TraceID   string
+	JobID     string
+	URL       string
+	Name      string
+	GroupID   int
+	Start     int64
+
+	// lock serializes the queries of the job
+	lock sync.Mutex
+	// finished is the job once it is done or failed, the asset is created
+	// and the transfer is reported only by the query which finds it finished
+	finished *URLUploadJob
+}
+
+// urlJobCache keeps the url upload jobs submitted by this process by their ids,
+// a job is dropped urlJobTTL after it is no longer watched
+
+type urlJobCache struct {
+	lock sync.Mutex
+	jobs map[string]*urlJobRef
+	// ttl is urlJobTTL if it is 0
+	ttl time.Duration
+}
+
+// add keeps ref and returns its random id
+func (c *urlJobCache) add(ref *urlJobRef) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(buf)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.jobs == nil {
+		c.jobs = make(map[string]*urlJobRef)
+	}
+	c.jobs[id] = ref
+
+	return id, nil
+}
+
+// drop forgets the job id after the ttl
+func (c *urlJobCache) drop(id string) {
+	ttl := c.ttl
+	if ttl == 0 {
+		ttl = urlJobTTL
+	}
+
+	time.AfterFunc(ttl, func() {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+
+		delete(c.jobs, id)
+	})
+}
+
+func (c *urlJobCache) get(id string) (*urlJobRef, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ref, ok := c.jobs[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown job id %s", id)
+	}
+	return ref, nil
+}
+
+// urlPullResult is the reply of a node to a url pull request or a job query
+type urlPullResult struct {
+	Code       int    `json:"code"`
+	Msg        string `json:"msg"`
+	JobID      string `json:"job_id"`
+	Status     string `json:"status"`
+	Cid        string `json:"cid"`
+	Size       int64  `json:"size"`
+	Downloaded int64  `json:"downloaded"`
+}
+
+// SubmitURLUpload asks a node to pull rawURL into the titan storage and returns the id of the job
+// without waiting, the job is queried with GetURLUploadJob or WaitURLUpload.
+func (s *storage) SubmitURLUpload(ctx context.Context, rawURL string) (string, error) {
+	return s.submitURLUpload(ctx, rawURL, "")
+}
+
+// submitURLUpload is SubmitURLUpload of the asset name, the name in the url is used if it is empty
+func (s *storage) submitURLUpload(ctx context.Context, rawURL, name string) (string, error) {
+	u, err := url.ParseRequestURI(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("invalid url %s", rawURL)
+	}
+
+	if len(name) == 0 {
+		name, err = getFileNameFromURL(rawURL)
+		if err != nil {
+			log.Printf("getFileNameFromURL %s", err.Error())
+		}
+	}
+
+	// the node pulls the data as it is, it can not be encrypted
+	if s.encryptUpload(ctx) {
+		return "", fmt.Errorf("the url can not be encrypted, disable encryption of the upload with WithEncryption")
+	}
+
+	groupID, err := s.uploadGroup(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	rsp, err := s.webAPI.GetNodeUploadInfo(ctx, s.userID, s.getArea(ctx), true, false)
+	if err != nil {
+		return "", err
+	}
+
+	if len(rsp.List) == 0 {
+		return "", fmt.Errorf("endpoints is empty")
+	}
+
+	for _, node := range rsp.List {
+		ret, err := s.submitURLPull(ctx, node.UploadURL, node.Token, rawURL)
+		if err != nil {
+			log.Printf("submit url to node %s failed, %s", node.NodeID, err.Error())
+			continue
+		}
+
+		ref := &urlJobRef{
+			NodeID:    node.NodeID,
+			UploadURL: node.UploadURL,
+			Token:     node.Token,
+			TraceID:   rsp.TraceID,
+			JobID:     ret.JobID,
+			URL:       rawURL,
+			Name:      name,
+			GroupID:   groupID,
+			Start:     time.Now().UnixMilli(),
+		}
+
+		jobID, err := s.urlJobs.add(ref)
+		if err != nil {
+			return "", err
+		}
+
+		// the asset is created by the watcher even if the job is never queried
+		go s.watchURLJob(context.WithoutCancel(ctx), jobID, ref)
+		return jobID, nil
+	}
+
+	return "", fmt.Errorf("all nodes refused to pull %s", rawURL)
+}
+
+// GetURLUploadJob returns the state of the url upload job, the asset is created once the node has pulled the url
+func (s *storage) GetURLUploadJob(ctx context.Context, jobID string) (*URLUploadJob, error) {
+	ref, err := s.urlJobs.get(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.queryURLJob(ctx, jobID, ref)
+}
+
+// WaitURLUpload polls the url upload job until it is done or failed, progress receives the pulled bytes
+func (s *storage) WaitURLUpload(ctx context.Context, jobID string, progress ProgressFunc) (*URLUploadJob, error) {
+	ref, err := s.urlJobs.get(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(urlPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := s.queryURLJob(ctx, jobID, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if progress != nil && job.Downloaded > 0 {
+			progress(job.Downloaded, job.Size)
+		}
+
+		switch job.State {
+		case URLUploadDone:
+			return job, nil
+		case URLUploadFailed:
+			return job, fmt.Errorf("node failed to pull %s: %s", job.URL, job.Error)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// watchURLJob polls the job until it is finished, so the asset is created once the node has pulled the url
+func (s *storage) watchURLJob(ctx context.Context, jobID string, ref *urlJobRef) {
+	defer s.urlJobs.drop(jobID)
+
+	ticker := time.NewTicker(urlPollInterval)
+	defer ticker.Stop()
+
+	for errs := 0; errs < urlWatchErrors; {
+		<-ticker.C
+
+		job, err := s.queryURLJob(ctx, jobID, ref)
+		if err != nil {
+			errs++
+			log.Printf("query url upload job of node %s failed, %s", ref.NodeID, err.Error())
+			continue
+		}
+		errs = 0
+
+		if job.State == URLUploadDone || job.State == URLUploadFailed {
+			return
+		}
+	}
+
+	log.Printf("stop watching url upload job of node %s after %d failed queries", ref.NodeID, urlWatchErrors)
+}
+
+// UploadAssetWithUrl lets a node pull the url into the titan storage, it returns the cid and the file name
+//
+// Deprecated: use Upload with URLSource
+func (s *storage) UploadAssetWithUrl(ctx context.Context, url string) (cid.Cid, string, error) {
+	res, err := s.Upload(ctx, URLSource(url))
+	if err != nil {
+		return cid.Cid{}, "", err
+	}
+	return res.CID, res.Name, nil
+}
+
+// queryURLJob asks the node for the job, and creates the asset if the job is done,
+// a finished job is returned without asking the node again.
+func (s *storage) queryURLJob(ctx context.Context, jobID string, ref *urlJobRef) (*URLUploadJob, error) {
+	ref.lock.Lock()
+	defer ref.lock.Unlock()
+
+	if ref.finished != nil {
+		job := *ref.finished
+		return &job, nil
+	}
+
+	ret, err := s.queryURLPull(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &URLUploadJob{
+		ID:         jobID,
+		URL:        ref.URL,
+		FileName:   ref.Name,
+		State:      URLUploadState(ret.Status),
+		Downloaded: ret.Downloaded,
+		Size:       ret.Size,
+	}
+
+	switch job.State {
+	case URLUploadDone:
+		if len(ret.Cid) == 0 {
+			return nil, fmt.Errorf("node %s finished the job without cid", ref.NodeID)
+		}
+		job.CID = ret.Cid
+		if err = s.createURLAsset(ctx, ref, ret); err != nil {
+			return nil, err
+		}
+	case URLUploadFailed:
+		job.Error = ret.Msg
+		s.reportURLJob(ref, ret)
+	case URLUploadPending, URLUploadDownloading:
+		return job, nil
+	default:
+		return nil, fmt.Errorf("unknown job status %s", ret.Status)
+	}
+
+	finished := *job
+	ref.finished = &finished
+	return job, nil
+}
+
+// createURLAsset creates the asset pulled by the node
+func (s *storage) createURLAsset(ctx context.Context, ref *urlJobRef, ret *urlPullResult) error {
+	name := ref.Name
+	if len(name) == 0 {
+		name = ret.Cid
+	}
+
+	assetProperty := client.AssetProperty{
+		AssetCID:  ret.Cid,
+		AssetName: name,
+		AssetSize: ret.Size,
+		AssetType: string(FileTypeFile),
+		NodeID:    ref.NodeID,
+		GroupID:   ref.GroupID,
+	}
+
+	req := client.CreateAssetReq{AssetProperty: assetProperty, AreaIDs: s.uploadAreas(ctx)}
+	rsp, err := s.webAPI.CreateAsset(ctx, &req)
+	if err != nil {
+		if errors.Is(err, client.ErrAlreadyExists) {
+			return nil
+		}
+		return fmt.Errorf("CreateAsset error %w", err)
+	}
+
+	if !rsp.IsAlreadyExist {
+		s.reportURLJob(ref, ret)
+	}
+
+	return nil
+}
+
+// reportURLJob sends the transfer report of the finished job
+func (s *storage) reportURLJob(ref *urlJobRef, ret *urlPullResult) {
+	report := &client.AssetTransferReq{
+		TraceID:      ref.TraceID,
+		NodeID:       ref.NodeID,
+		Cid:          ret.Cid,
+		CostMs:       time.Now().UnixMilli() - ref.Start,
+		TotalSize:    ret.Size,
+		TransferType: client.AssetTransferTypeUpload,
+		State:        client.AssetTransferStateFailed,
+		Log:          ret.Msg,
+	}
+
+	if ret.Status == string(URLUploadDone) {
+		report.State = client.AssetTransferStateSuccess
+	}
+
+	s.sendTransferReport(report)
+}
+
+// submitURLPull posts the url to the upload url of the node, the node pulls it in background
+func (s *storage) submitURLPull(ctx context.Context, uploadURL, token, rawURL string) (*urlPullResult, error) {
+	form := url.Values{"url": {rawURL}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	ret, err := s.doURLPull(req, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret.JobID) == 0 {
+		return nil, fmt.Errorf("node returns no job id")
+	}
+
+	return ret, nil
+}
+
+// queryURLPull asks the node for the state of the job
+func (s *storage) queryURLPull(ctx context.Context, ref *urlJobRef) (*urlPullResult, error) {
+	u, err := url.Parse(ref.UploadURL)
+	if err != nil {
+		return nil, err
+	}
+
+	query := u.Query()
+	query.Set("job_id", ref.JobID)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.doURLPull(req, ref.Token)
+}
+
+func (s *storage) doURLPull(req *http.Request, token string) (*urlPullResult, error) {
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	ctx, cancel := s.opts.UploadContext(req.Context())
+	defer cancel()
+
+	rsp, err := s.opts.Client().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http StatusCode %d, %s", rsp.StatusCode, string(body))
+	}
+
+	ret := &urlPullResult{}
+	if err = json.Unmarshal(body, ret); err != nil {
+		return nil, err
+	}
+
+	if ret.Code != 0 {
+		return nil, fmt.Errorf("node error code %d, %s", ret.Code, ret.Msg)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+)
+
+func TestUploadAssetWithUrl(t *testing.T) {
+	interval := urlPollInterval
+	urlPollInterval = 10 * time.Millisecond
+	t.Cleanup(func() { urlPollInterval = interval })
+
+	const root = "bafkreib5arnexhnsn6etb4xs7ywm52iey3i7xkxgjxm4dhw5njxmz2dn4i"
+
+	var (
+		lock       sync.Mutex
+		pulled     string
+		downloaded int64
+		queries    int
+	)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		if r.Method == http.MethodPost {
+			pulled = r.FormValue("url")
+			w.Write([]byte(`{"code":0,"job_id":"j1","status":"pending"}`))
+			return
+		}
+
+		if r.URL.Query().Get("job_id") != "j1" {
+			http.NotFound(w, r)
+			return
+		}
+
+		queries++
+		if downloaded < 100 {
+			fmt.Fprintf(w, `{"code":0,"status":"downloading","downloaded":%d,"size":100}`, downloaded)
+			return
+		}
+		fmt.Fprintf(w, `{"code":0,"status":"done","cid":"%s","downloaded":100,"size":100}`, root)
+	}))
+	defer node.Close()
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "node busy", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	web := &fakeWebserver{
+		endpoints: func() []*client.Endpoint { return []*client.Endpoint{{}} },
+		nodes: func() []*client.NodeUploadInfo {
+			return []*client.NodeUploadInfo{
+				{UploadURL: down.URL, Token: "token", NodeID: "down"},
+				{UploadURL: node.URL + "/upload", Token: "token", NodeID: "n1"},
+			}
+		},
+	}
+	s := &storage{webAPI: web, groupID: 5}
+
+	setDownloaded := func(n int64) {
+		lock.Lock()
+		defer lock.Unlock()
+		downloaded = n
+	}
+	setDownloaded(40)
+
+	// the job is only submitted
+	jobID, err := s.SubmitURLUpload(context.Background(), "https://example.com/data/file.bin?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pulled != "https://example.com/data/file.bin?x=1" {
+		t.Fatalf("node pulls %s", pulled)
+	}
+
+	job, err := s.GetURLUploadJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != URLUploadDownloading || job.Downloaded != 40 || len(web.created) != 0 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	// the asset is created without waiting for the job
+	setDownloaded(100)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		web.lock.Lock()
+		created := len(web.created)
+		web.lock.Unlock()
+		if created > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the asset of the submitted job is not created")
+		}
+	}
+
+	var progress []int64
+	job, err = s.WaitURLUpload(context.Background(), jobID, func(done, total int64) {
+		progress = append(progress, done)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != URLUploadDone || job.CID != root || job.FileName != "file.bin" {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if len(progress) != 1 || progress[0] != 100 {
+		t.Fatalf("unexpected progress %v", progress)
+	}
+
+	// the finished job is not queried and created again
+	lock.Lock()
+	queried := queries
+	lock.Unlock()
+	job, err = s.GetURLUploadJob(context.Background(), jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != URLUploadDone || queries != queried || len(web.created) != 1 {
+		t.Fatalf("unexpected job %+v after %d queries and %d assets", job, queries, len(web.created))
+	}
+
+	asset := web.created[0].AssetProperty
+	if asset.AssetCID != root || asset.NodeID != "n1" || asset.AssetSize != 100 || asset.GroupID != 5 || asset.AssetName != "file.bin" {
+		t.Fatalf("unexpected asset %+v", asset)
+	}
+
+	// the id does not carry the upload token
+	if strings.Contains(jobID, "token") || len(jobID) != 32 {
+		t.Fatalf("unexpected job id %s", jobID)
+	}
+
+	if _, err = s.GetURLUploadJob(context.Background(), "invalid"); err == nil {
+		t.Fatal("expect an invalid job id to fail")
+	}
+}
+
+func TestURLJobDropped(t *testing.T) {
+	s := &storage{}
+	s.urlJobs.ttl = 10 * time.Millisecond
+	id, err := s.urlJobs.add(&urlJobRef{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.urlJobs.drop(id)
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := s.urlJobs.get(id); err == nil {
+		t.Fatal("expect the job to be dropped after the ttl")
+	}
+}
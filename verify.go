@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+)
+
+// carAccept asks the node for a car of the whole DAG in depth-first order with duplicated blocks,
+// so the blocks can be verified and decoded while they arrive.
+const carAccept = "application/vnd.ipld.car; version=1; order=dfs; dups=y"
+
+type verifyKey struct{}
+
+// WithVerifiedDownload returns a context which makes DownloadAsset called with it
+// verify every block against the asset CID or not, instead of the setting on Config
+func WithVerifiedDownload(ctx context.Context, verify bool) context.Context {
+	return context.WithValue(ctx, verifyKey{}, verify)
+}
+
+// verifyDownload returns if the download called with ctx is verified
+func (s *storage) verifyDownload(ctx context.Context) bool {
+	if verify, ok := ctx.Value(verifyKey{}).(bool); ok {
+		return verify
+	}
+	return s.verify
+}
+
+// downloadVerified downloads the file as a car from the URLs of res and verifies every block,
+// if a node fails or sends a wrong block, the download continues with the next URL.
+func (s *storage) downloadVerified(ctx context.Context, root cid.Cid, res *client.ShareAssetResult) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		start := time.Now()
+		w := &countWriter{w: pw}
+
+		var err error
+		for _, u := range res.URLs {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				break
+			}
+
+			// skip the bytes written by the failed URLs
+			err = fetchVerifiedCar(ctx, s.opts.NodeClient(), u, root, &skipWriter{w: w, skip: w.n})
+			if err == nil {
+				break
+			}
+			log.Printf("verified download %s from %s failed, %s", root.String(), u, err.Error())
+		}
+
+		if err == nil && len(res.URLs) == 0 {
+			err = fmt.Errorf("no url to download %s", root.String())
+		}
+
+		report := &client.AssetTransferReq{
+			CostMs:       time.Since(start).Milliseconds(),
+			TotalSize:    w.n,
+			TransferType: client.AssetTransferTypeDownload,
+			Cid:          root.String(),
+			State:        client.AssetTransferStateSuccess,
+			TraceID:      res.TraceID,
+		}
+		if err != nil {
+			report.State = client.AssetTransferStateFailed
+			report.Log = err.Error()
+		}
+		s.sendTransferReport(report)
+
+		pw.CloseWithError(err)
+	}()
+
+	return pr
+}
+
+// fetchVerifiedCar downloads the car of root from rawURL and writes the content of the file to w
+func fetchVerifiedCar(ctx context.Context, c *http.Client, rawURL string, root cid.Cid, w io.Writer) error {
+	body, err := openCar(ctx, c, rawURL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return readVerifiedCar(body, root, w)
+}
+
+// openCar requests the car of the whole DAG from rawURL, the content is verified by hash
+// so c does not need to verify the certificates of the nodes.
+func openCar(ctx context.Context, c *http.Client, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("format", "car")
+	query.Set("dag-scope", "all")
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", carAccept)
+
+	rsp, err := c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if rsp.StatusCode != http.StatusOK {
+		defer rsp.Body.Close()
+		b, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return nil, fmt.Errorf("http StatusCode %d, %s", rsp.StatusCode, string(b))
+	}
+
+	return rsp.Body, nil
+}
+
+// verifyBlock checks the data of a block matches its CID
+func verifyBlock(c cid.Cid, data []byte) error {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("block %s does not match its hash", c.String())
+	}
+	return nil
+}
+
+// readVerifiedCar reads a car in depth-first order and writes the content of the UnixFS file rooted at root to w.
+// Every block must be the next one of the DAG and match its CID.
+func readVerifiedCar(r io.Reader, root cid.Cid, w io.Writer) error {
+	br := bufio.NewReader(r)
+	if _, err := carv1.ReadHeader(br); err != nil {
+		return fmt.Errorf("read car header error %w", err)
+	}
+
+	var (
+		pending  = []cid.Cid{root}
+		fileSize uint64
+		written  uint64
+	)
+
+	for len(pending) > 0 {
+		expect := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		var data []byte
+		if expect.Prefix().MhType == multihash.IDENTITY {
+			// the data of an inlined block is in its CID
+			dmh, err := multihash.Decode(expect.Hash())
+			if err != nil {
+				return err
+			}
+			data = dmh.Digest
+		} else {
+			c, blk, err := util.ReadNode(br)
+			if err != nil {
+				return fmt.Errorf("read block %s error %w", expect.String(), err)
+			}
+
+			if !c.Equals(expect) {
+				return fmt.Errorf("unexpected block %s, want %s", c.String(), expect.String())
+			}
+
+			if err := verifyBlock(c, blk); err != nil {
+				return err
+			}
+			data = blk
+		}
+
+		switch expect.Type() {
+		case cid.Raw:
+			if _, err := w.Write(data); err != nil {
+				return err
+			}
+			written += uint64(len(data))
+
+		case cid.DagProtobuf:
+			nd, err := merkledag.DecodeProtobuf(data)
+			if err != nil {
+				return fmt.Errorf("decode block %s error %w", expect.String(), err)
+			}
+
+			fsNode, err := unixfs.FSNodeFromBytes(nd.Data())
+			if err != nil {
+				return fmt.Errorf("decode unixfs %s error %w", expect.String(), err)
+			}
+
+			switch fsNode.Type() {
+			case unixfs.TFile, unixfs.TRaw:
+			case unixfs.TDirectory, unixfs.THAMTShard:
+				return fmt.Errorf("%s is a folder, only files can be downloaded as a stream", expect.String())
+			default:
+				return fmt.Errorf("unsupported unixfs type %s of %s", fsNode.Type().String(), expect.String())
+			}
+
+			if expect.Equals(root) {
+				fileSize = fsNode.FileSize()
+			}
+
+			if _, err := w.Write(fsNode.Data()); err != nil {
+				return err
+			}
+			written += uint64(len(fsNode.Data()))
+
+			// the first child is visited next
+			links := nd.Links()
+			for i := len(links) - 1; i >= 0; i-- {
+				pending = append(pending, links[i].Cid)
+			}
+
+		default:
+			return fmt.Errorf("unsupported codec %d of %s", expect.Type(), expect.String())
+		}
+	}
+
+	if root.Type() == cid.DagProtobuf && written != fileSize {
+		return fmt.Errorf("file size %d does not match %d", written, fileSize)
+	}
+
+	return nil
+}
+
+// countWriter counts the bytes written to w
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// skipWriter drops the first skip bytes
+type skipWriter struct {
+	w    io.Writer
+	skip int64
+}
+
+func (sw *skipWriter) Write(p []byte) (int, error) {
+	if sw.skip >= int64(len(p)) {
+		sw.skip -= int64(len(p))
+		return len(p), nil
+	}
+
+	n, err := sw.w.Write(p[sw.skip:])
+	n += int(sw.skip)
+	sw.skip = 0
+	return n, err
+}
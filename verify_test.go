@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	carv1 "github.com/ipld/go-car"
+	"github.com/ipld/go-car/util"
+)
+
+func TestDownloadVerified(t *testing.T) {
+	data := make([]byte, 3<<20)
+	rand.New(rand.NewSource(6)).Read(data)
+
+	for _, opts := range []*ImportOptions{nil, {Chunker: "size-65536", Trickle: true}} {
+		root, car := dfsCar(t, data, opts)
+
+		// the bad node flips a byte in the middle of the car
+		bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			corrupted := append([]byte{}, car...)
+			corrupted[len(corrupted)/2] ^= 0xff
+			w.Write(corrupted)
+		}))
+		defer bad.Close()
+
+		good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("format") != "car" {
+				http.Error(w, "car only", http.StatusBadRequest)
+				return
+			}
+			w.Write(car)
+		}))
+		defer good.Close()
+
+		s := &storage{webAPI: &fakeWebserver{}}
+		res := &client.ShareAssetResult{URLs: []string{bad.URL, good.URL}}
+
+		r := s.downloadVerified(context.Background(), root, res)
+		b, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Close()
+
+		if !bytes.Equal(b, data) {
+			t.Fatalf("downloaded %d bytes do not match the data", len(b))
+		}
+
+		// only the bad node
+		res = &client.ShareAssetResult{URLs: []string{bad.URL}}
+		if _, err := io.ReadAll(s.downloadVerified(context.Background(), root, res)); err == nil {
+			t.Fatal("expect the corrupted car to fail")
+		}
+	}
+}
+
+// dfsCar returns the car of data with the blocks in depth-first order
+func dfsCar(t *testing.T, data []byte, opts *ImportOptions) (cid.Cid, []byte) {
+	store := make(map[cid.Cid][]byte)
+	open := func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+	root, err := sourceWalker(open, opts)(func(blk blocks.Block) error {
+		store[blk.Cid()] = blk.RawData()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{root}, Version: 1}, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	var visit func(c cid.Cid)
+	visit = func(c cid.Cid) {
+		util.LdWrite(buf, c.Bytes(), store[c])
+		if c.Type() == cid.DagProtobuf {
+			nd, err := merkledag.DecodeProtobuf(store[c])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, l := range nd.Links() {
+				visit(l.Cid)
+			}
+		}
+	}
+	visit(root)
+
+	return root, buf.Bytes()
+}
@@ -0,0 +1,312 @@
+package webdavfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"path"
+	"time"
+
+	storage "github.com/Titannet-dao/titan-storage-sdk"
+	"golang.org/x/net/webdav"
+)
+
+var (
+	errIsFolder = errors.New("is a folder")
+	errNotDir   = errors.New("not a folder")
+	errReadOnly = errors.New("the file is opened to read")
+	errPipe     = errors.New("the file is opened to write")
+)
+
+// fileInfo is the os.FileInfo of a folder or an asset, the ETag of an asset is its cid
+type fileInfo struct {
+	entry *storage.PathEntry
+}
+
+var (
+	_ webdav.ETager       = (*fileInfo)(nil)
+	_ webdav.ContentTyper = (*fileInfo)(nil)
+)
+
+func (fi *fileInfo) Name() string {
+	return fi.entry.Name()
+}
+
+func (fi *fileInfo) Size() int64 {
+	if fi.entry.IsFolder() {
+		return 0
+	}
+	return fi.entry.Size()
+}
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.entry.IsFolder() {
+		return os.ModeDir | 0o755
+	}
+	return 0o644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.entry.ModTime()
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.entry.IsFolder()
+}
+
+func (fi *fileInfo) Sys() interface{} {
+	return fi.entry
+}
+
+// ETag implements webdav.ETager
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.entry.IsFolder() {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.entry.CID() + `"`, nil
+}
+
+// ContentType implements webdav.ContentTyper, it is found by the extension so the asset is not read
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if contentType := mime.TypeByExtension(path.Ext(fi.entry.Name())); len(contentType) > 0 {
+		return contentType, nil
+	}
+	return "application/octet-stream", nil
+}
+
+// dirFile is an opened folder
+type dirFile struct {
+	ctx     context.Context
+	fsys    *FileSystem
+	entry   *storage.PathEntry
+	entries []os.FileInfo
+	loaded  bool
+}
+
+func (d *dirFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{entry: d.entry}, nil
+}
+
+// Readdir returns the next count entries, or all the entries if count <= 0
+func (d *dirFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !d.loaded {
+		entries, err := d.fsys.backend.ReadDir(d.ctx, d.entry.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			d.entries = append(d.entries, &fileInfo{entry: entry})
+		}
+		d.loaded = true
+	}
+
+	if count <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	count = min(count, len(d.entries))
+	entries := d.entries[:count]
+	d.entries = d.entries[count:]
+	return entries, nil
+}
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.Path, Err: errIsFolder}
+}
+
+func (d *dirFile) Seek(int64, int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: d.entry.Path, Err: errIsFolder}
+}
+
+func (d *dirFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: d.entry.Path, Err: errIsFolder}
+}
+
+func (d *dirFile) Close() error {
+	return nil
+}
+
+// assetFile is an asset opened to read, it is opened by ranges once it is read,
+// so the seeks and the stats don't download it.
+type assetFile struct {
+	ctx   context.Context
+	fsys  *FileSystem
+	entry *storage.PathEntry
+	r     storage.AssetReader
+	off   int64
+}
+
+func (f *assetFile) Stat() (os.FileInfo, error) {
+	return &fileInfo{entry: f.entry}, nil
+}
+
+func (f *assetFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.entry.Path, Err: errNotDir}
+}
+
+func (f *assetFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.entry.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.entry.Path, Err: fs.ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.entry.Path, Err: fs.ErrInvalid}
+	}
+
+	f.off = offset
+	return offset, nil
+}
+
+func (f *assetFile) Read(p []byte) (int, error) {
+	if f.off >= f.entry.Size() {
+		return 0, io.EOF
+	}
+
+	if f.r == nil {
+		r, err := f.fsys.backend.OpenAsset(f.ctx, f.entry.CID())
+		if err != nil {
+			return 0, &fs.PathError{Op: "open", Path: f.entry.Path, Err: err}
+		}
+		f.r = r
+	}
+
+	n, err := f.r.ReadAt(p, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *assetFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.entry.Path, Err: errReadOnly}
+}
+
+func (f *assetFile) Close() error {
+	if f.r == nil {
+		return nil
+	}
+	return f.r.Close()
+}
+
+// uploadFile is an asset opened to write, the written data is streamed into the upload
+// and the upload is finished by Close.
+type uploadFile struct {
+	ctx     context.Context
+	fsys    *FileSystem
+	name    string
+	old     *storage.PathEntry
+	pw      *io.PipeWriter
+	written int64
+	start   time.Time
+
+	// done is closed once the upload returns res or err
+	done   chan struct{}
+	res    *storage.UploadResult
+	err    error
+	closed bool
+}
+
+func newUploadFile(ctx context.Context, fsys *FileSystem, name string, old *storage.PathEntry) *uploadFile {
+	pr, pw := io.Pipe()
+	f := &uploadFile{ctx: ctx, fsys: fsys, name: name, old: old, pw: pw, start: time.Now(), done: make(chan struct{})}
+
+	go func() {
+		defer close(f.done)
+
+		f.res, f.err = fsys.backend.Put(ctx, name, pr)
+		// the writes fail once the upload returned
+		pr.CloseWithError(f.err)
+	}()
+
+	return f
+}
+
+// Stat returns the size written so far
+func (f *uploadFile) Stat() (os.FileInfo, error) {
+	return &writtenInfo{name: path.Base(f.name), size: f.written, modTime: f.start}, nil
+}
+
+func (f *uploadFile) Write(p []byte) (int, error) {
+	n, err := f.pw.Write(p)
+	f.written += int64(n)
+	if err != nil {
+		<-f.done
+		if f.err != nil {
+			return n, &fs.PathError{Op: "write", Path: f.name, Err: f.err}
+		}
+		return n, &fs.PathError{Op: "write", Path: f.name, Err: err}
+	}
+	return n, nil
+}
+
+// Close finishes the upload and deletes the asset replaced by it,
+// the upload is canceled if the context of the request is done, e.g. the client is gone.
+func (f *uploadFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+
+	if err := f.ctx.Err(); err != nil {
+		f.pw.CloseWithError(err)
+	} else {
+		f.pw.Close()
+	}
+	<-f.done
+
+	if f.err != nil {
+		return &fs.PathError{Op: "close", Path: f.name, Err: f.err}
+	}
+
+	if f.old != nil && f.old.CID() != f.res.CID.String() {
+		if err := f.fsys.backend.DeleteAsset(f.ctx, f.old.CID()); err != nil {
+			log.Printf("delete the replaced asset %s of %s failed: %s", f.old.CID(), f.name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (f *uploadFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errPipe}
+}
+
+func (f *uploadFile) Seek(int64, int) (int64, error) {
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errPipe}
+}
+
+func (f *uploadFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+}
+
+// writtenInfo is the os.FileInfo of an uploadFile
+type writtenInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *writtenInfo) Name() string       { return fi.name }
+func (fi *writtenInfo) Size() int64        { return fi.size }
+func (fi *writtenInfo) Mode() os.FileMode  { return 0o644 }
+func (fi *writtenInfo) ModTime() time.Time { return fi.modTime }
+func (fi *writtenInfo) IsDir() bool        { return false }
+func (fi *writtenInfo) Sys() interface{}   { return nil }
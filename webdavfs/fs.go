@@ -0,0 +1,154 @@
+// Package webdavfs serves the titan storage of a user through WebDAV, so it can be mounted by
+// the file managers. FileSystem is a webdav.FileSystem of golang.org/x/net/webdav, the folders are
+// the collections and the assets are the files.
+package webdavfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	storage "github.com/Titannet-dao/titan-storage-sdk"
+	"golang.org/x/net/webdav"
+)
+
+// Backend is the part of the titan storage used by FileSystem, NewBackend returns it for a storage.Storage
+type Backend interface {
+	Stat(ctx context.Context, p string) (*storage.PathEntry, error)
+	ReadDir(ctx context.Context, p string) ([]*storage.PathEntry, error)
+	CreateFolder(ctx context.Context, name string, parentID int) error
+	RemoveAll(ctx context.Context, p string) error
+	Rename(ctx context.Context, oldPath, newPath string) error
+	DeleteAsset(ctx context.Context, assetCID string) error
+	// OpenAsset returns a reader of the asset which reads it by ranges
+	OpenAsset(ctx context.Context, assetCID string) (storage.AssetReader, error)
+	// Put uploads the data of r as the asset at path p, the folder of p exists
+	Put(ctx context.Context, p string, r io.Reader) (*storage.UploadResult, error)
+}
+
+type storageBackend struct {
+	storage.Storage
+}
+
+// NewBackend returns the Backend of s, the files are streamed into s by Upload
+func NewBackend(s storage.Storage) Backend {
+	return storageBackend{Storage: s}
+}
+
+func (b storageBackend) Put(ctx context.Context, p string, r io.Reader) (*storage.UploadResult, error) {
+	dir, name := path.Split(p)
+	return b.Upload(ctx, storage.ReaderSource(r), storage.UploadName(name), storage.UploadFolderPath(dir, false))
+}
+
+// FileSystem is the webdav.FileSystem of the titan storage, the files are read by ranges and
+// written by streaming uploads. The encrypted assets are served as they are stored.
+type FileSystem struct {
+	backend Backend
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+// New returns the FileSystem of backend
+func New(backend Backend) *FileSystem {
+	return &FileSystem{backend: backend}
+}
+
+// Mkdir creates the folder name, its parent must exist
+func (fsys *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	// MKCOL names the collection with a trailing slash
+	name = path.Clean(name)
+	if _, err := fsys.backend.Stat(ctx, name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	parent, err := fsys.folder(ctx, "mkdir", path.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	if err = fsys.backend.CreateFolder(ctx, path.Base(name), parent.Folder.ID); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return nil
+}
+
+// folder returns the folder at p, the error is fs.ErrNotExist if it is not a folder
+func (fsys *FileSystem) folder(ctx context.Context, op, p string) (*storage.PathEntry, error) {
+	entry, err := fsys.backend.Stat(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if !entry.IsFolder() {
+		return nil, &fs.PathError{Op: op, Path: p, Err: fs.ErrNotExist}
+	}
+	return entry, nil
+}
+
+// OpenFile opens the folder or asset name to read, or creates the asset name to write.
+// The written asset is uploaded when the file is closed and replaces the old one.
+func (fsys *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = path.Clean(name)
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		entry, err := fsys.backend.Stat(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if entry.IsFolder() {
+			return &dirFile{ctx: ctx, fsys: fsys, entry: entry}, nil
+		}
+		return &assetFile{ctx: ctx, fsys: fsys, entry: entry}, nil
+	}
+
+	// an asset can only be written as a whole
+	if flag&os.O_CREATE == 0 || flag&os.O_TRUNC == 0 || flag&os.O_APPEND != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+
+	if _, err := fsys.folder(ctx, "open", path.Dir(name)); err != nil {
+		return nil, err
+	}
+
+	old, err := fsys.backend.Stat(ctx, name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if old != nil && old.IsFolder() {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsFolder}
+	}
+	if old != nil && flag&os.O_EXCL != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	}
+
+	return newUploadFile(ctx, fsys, name, old), nil
+}
+
+// RemoveAll deletes the asset or the folder name with everything in it
+func (fsys *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = path.Clean(name)
+	if name == "/" {
+		return &fs.PathError{Op: "removeall", Path: name, Err: fs.ErrPermission}
+	}
+	return fsys.backend.RemoveAll(ctx, name)
+}
+
+// Rename renames or moves the folder or asset oldName to newName
+func (fsys *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	return fsys.backend.Rename(ctx, path.Clean(oldName), path.Clean(newName))
+}
+
+// Stat returns the os.FileInfo of the folder or asset name
+func (fsys *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	entry, err := fsys.backend.Stat(ctx, path.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{entry: entry}, nil
+}
@@ -0,0 +1,385 @@
+package webdavfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	storage "github.com/Titannet-dao/titan-storage-sdk"
+	"github.com/Titannet-dao/titan-storage-sdk/client"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"golang.org/x/net/webdav"
+)
+
+// fakeBackend is an in-memory Backend, the folders are kept by their paths with their ids,
+// the paths are not cleaned so FileSystem must pass them clean
+type fakeBackend struct {
+	lock    sync.Mutex
+	folders map[string]int
+	files   map[string][]byte
+	nextID  int
+	deleted []string
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{folders: map[string]int{"/": 0}, files: make(map[string][]byte), nextID: 1}
+}
+
+func dataCID(data []byte) string {
+	hash, _ := multihash.Sum(data, multihash.SHA2_256, -1)
+	return cid.NewCidV1(cid.Raw, hash).String()
+}
+
+func (b *fakeBackend) entry(p string) (*storage.PathEntry, bool) {
+	if id, ok := b.folders[p]; ok {
+		return &storage.PathEntry{Path: p, Folder: &client.AssetGroup{ID: id, Name: path.Base(p)}}, true
+	}
+	if data, ok := b.files[p]; ok {
+		return &storage.PathEntry{Path: p, Asset: &client.AssetOverview{
+			AssetRecord:     &client.AssetRecord{CID: dataCID(data)},
+			UserAssetDetail: &client.UserAssetDetail{AssetName: path.Base(p), TotalSize: int64(len(data))},
+		}}, true
+	}
+	return nil, false
+}
+
+func (b *fakeBackend) Stat(ctx context.Context, p string) (*storage.PathEntry, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if entry, ok := b.entry(p); ok {
+		return entry, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: p, Err: fs.ErrNotExist}
+}
+
+func (b *fakeBackend) ReadDir(ctx context.Context, p string) ([]*storage.PathEntry, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.folders[p]; !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: p, Err: fs.ErrNotExist}
+	}
+
+	var paths []string
+	for folder := range b.folders {
+		if folder != "/" && path.Dir(folder) == p {
+			paths = append(paths, folder)
+		}
+	}
+	for file := range b.files {
+		if path.Dir(file) == p {
+			paths = append(paths, file)
+		}
+	}
+	sort.Strings(paths)
+
+	var entries []*storage.PathEntry
+	for _, child := range paths {
+		entry, _ := b.entry(child)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (b *fakeBackend) CreateFolder(ctx context.Context, name string, parentID int) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for p, id := range b.folders {
+		if id == parentID {
+			b.folders[path.Join(p, name)] = b.nextID
+			b.nextID++
+			return nil
+		}
+	}
+	return fmt.Errorf("folder %d not found", parentID)
+}
+
+// children returns the folders and files in p and under its subfolders
+func (b *fakeBackend) children(p string) (folders, files []string) {
+	for folder := range b.folders {
+		if strings.HasPrefix(folder, p+"/") {
+			folders = append(folders, folder)
+		}
+	}
+	for file := range b.files {
+		if strings.HasPrefix(file, p+"/") {
+			files = append(files, file)
+		}
+	}
+	return folders, files
+}
+
+func (b *fakeBackend) RemoveAll(ctx context.Context, p string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	folders, files := b.children(p)
+	for _, folder := range folders {
+		delete(b.folders, folder)
+	}
+	for _, file := range append(files, p) {
+		if data, ok := b.files[file]; ok {
+			b.deleted = append(b.deleted, dataCID(data))
+			delete(b.files, file)
+		}
+	}
+	delete(b.folders, p)
+	return nil
+}
+
+func (b *fakeBackend) Rename(ctx context.Context, oldPath, newPath string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.folders[path.Dir(newPath)]; !ok {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: fs.ErrNotExist}
+	}
+	if _, ok := b.entry(newPath); ok {
+		return &fs.PathError{Op: "rename", Path: newPath, Err: fs.ErrExist}
+	}
+
+	if data, ok := b.files[oldPath]; ok {
+		delete(b.files, oldPath)
+		b.files[newPath] = data
+		return nil
+	}
+
+	id, ok := b.folders[oldPath]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: fs.ErrNotExist}
+	}
+
+	folders, files := b.children(oldPath)
+	for _, folder := range folders {
+		b.folders[newPath+strings.TrimPrefix(folder, oldPath)] = b.folders[folder]
+		delete(b.folders, folder)
+	}
+	for _, file := range files {
+		b.files[newPath+strings.TrimPrefix(file, oldPath)] = b.files[file]
+		delete(b.files, file)
+	}
+	delete(b.folders, oldPath)
+	b.folders[newPath] = id
+	return nil
+}
+
+func (b *fakeBackend) DeleteAsset(ctx context.Context, assetCID string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for p, data := range b.files {
+		if dataCID(data) == assetCID {
+			delete(b.files, p)
+		}
+	}
+	b.deleted = append(b.deleted, assetCID)
+	return nil
+}
+
+type memAsset struct {
+	*bytes.Reader
+}
+
+func (memAsset) Close() error {
+	return nil
+}
+
+func (b *fakeBackend) OpenAsset(ctx context.Context, assetCID string) (storage.AssetReader, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, data := range b.files {
+		if dataCID(data) == assetCID {
+			return memAsset{bytes.NewReader(data)}, nil
+		}
+	}
+	return nil, fmt.Errorf("asset %s not found", assetCID)
+}
+
+func (b *fakeBackend) Put(ctx context.Context, p string, r io.Reader) (*storage.UploadResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.folders[path.Dir(p)]; !ok {
+		return nil, &fs.PathError{Op: "put", Path: p, Err: fs.ErrNotExist}
+	}
+	b.files[p] = data
+
+	root, err := cid.Decode(dataCID(data))
+	if err != nil {
+		return nil, err
+	}
+	return &storage.UploadResult{CID: root, Name: path.Base(p), Size: int64(len(data))}, nil
+}
+
+func doRequest(t *testing.T, method, url string, body []byte, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+
+	data, err := io.ReadAll(rsp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsp, data
+}
+
+func TestWebDAV(t *testing.T) {
+	b := newFakeBackend()
+	handler := &webdav.Handler{FileSystem: New(b), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	check := func(name string, rsp *http.Response, status int) {
+		t.Helper()
+		if rsp.StatusCode != status {
+			t.Fatalf("%s: status %d, want %d", name, rsp.StatusCode, status)
+		}
+	}
+
+	rsp, _ := doRequest(t, "MKCOL", srv.URL+"/docs", nil, nil)
+	check("mkcol", rsp, http.StatusCreated)
+	rsp, _ = doRequest(t, "MKCOL", srv.URL+"/docs", nil, nil)
+	check("mkcol existing", rsp, http.StatusMethodNotAllowed)
+	rsp, _ = doRequest(t, "MKCOL", srv.URL+"/missing/sub", nil, nil)
+	check("mkcol without parent", rsp, http.StatusConflict)
+	rsp, _ = doRequest(t, "MKCOL", srv.URL+"/docs/sub/", nil, nil)
+	check("mkcol with trailing slash", rsp, http.StatusCreated)
+	if _, ok := b.folders["/docs/sub"]; !ok {
+		t.Fatalf("mkcol with trailing slash: folders %v", b.folders)
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	rsp, _ = doRequest(t, http.MethodPut, srv.URL+"/docs/a.txt", data, nil)
+	check("put", rsp, http.StatusCreated)
+	if !bytes.Equal(b.files["/docs/a.txt"], data) {
+		t.Fatal("put: the asset is not uploaded")
+	}
+
+	rsp, _ = doRequest(t, http.MethodPut, srv.URL+"/missing/a.txt", data, nil)
+	check("put without folder", rsp, http.StatusConflict)
+
+	// the replaced asset is deleted
+	oldCID := dataCID(data)
+	data = append(data, "!"...)
+	rsp, _ = doRequest(t, http.MethodPut, srv.URL+"/docs/a.txt", data, nil)
+	check("put again", rsp, http.StatusCreated)
+	if len(b.deleted) != 1 || b.deleted[0] != oldCID {
+		t.Fatalf("put again: deleted %v, want %s", b.deleted, oldCID)
+	}
+
+	rsp, body := doRequest(t, http.MethodGet, srv.URL+"/docs/a.txt", nil, map[string]string{"Range": "bytes=100-199"})
+	check("get range", rsp, http.StatusPartialContent)
+	if !bytes.Equal(body, data[100:200]) {
+		t.Fatalf("get range: %q", body)
+	}
+	if etag := rsp.Header.Get("ETag"); etag != `"`+dataCID(data)+`"` {
+		t.Fatalf("get range: etag %s", etag)
+	}
+	if contentType := rsp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Fatalf("get range: content type %s", contentType)
+	}
+
+	rsp, body = doRequest(t, http.MethodGet, srv.URL+"/docs/a.txt", nil, nil)
+	check("get", rsp, http.StatusOK)
+	if !bytes.Equal(body, data) {
+		t.Fatal("get: the data is not the same")
+	}
+
+	rsp, body = doRequest(t, "PROPFIND", srv.URL+"/docs/", nil, map[string]string{"Depth": "1"})
+	check("propfind", rsp, http.StatusMultiStatus)
+	for _, want := range []string{"/docs/a.txt", "<D:getcontentlength>10001</D:getcontentlength>", "<D:collection"} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("propfind: %s not found in %s", want, body)
+		}
+	}
+
+	rsp, _ = doRequest(t, "MOVE", srv.URL+"/docs/a.txt", nil, map[string]string{"Destination": srv.URL + "/b.txt"})
+	check("move", rsp, http.StatusCreated)
+	if _, ok := b.files["/b.txt"]; !ok {
+		t.Fatal("move: the asset is not moved")
+	}
+
+	rsp, _ = doRequest(t, "MOVE", srv.URL+"/docs", nil, map[string]string{"Destination": srv.URL + "/papers"})
+	check("move folder", rsp, http.StatusCreated)
+	if _, ok := b.folders["/papers"]; !ok {
+		t.Fatal("move folder: the folder is not moved")
+	}
+
+	rsp, _ = doRequest(t, http.MethodDelete, srv.URL+"/b.txt", nil, nil)
+	check("delete", rsp, http.StatusNoContent)
+	rsp, _ = doRequest(t, http.MethodDelete, srv.URL+"/papers", nil, nil)
+	check("delete folder", rsp, http.StatusNoContent)
+	rsp, _ = doRequest(t, http.MethodGet, srv.URL+"/b.txt", nil, nil)
+	check("get deleted", rsp, http.StatusNotFound)
+
+	if len(b.files) != 0 || len(b.folders) != 1 {
+		t.Fatalf("delete: files %d, folders %d are left", len(b.files), len(b.folders))
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	handler := &webdav.Handler{FileSystem: New(newFakeBackend()), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(BasicAuth(handler, "user", "secret"))
+	defer srv.Close()
+
+	for _, c := range []struct {
+		username, password string
+		status             int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"user", "wrong", http.StatusUnauthorized},
+		{"user", "secret", http.StatusMultiStatus},
+	} {
+		req, err := http.NewRequest("PROPFIND", srv.URL+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Depth", "0")
+		if len(c.username) > 0 {
+			req.SetBasicAuth(c.username, c.password)
+		}
+
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+
+		if rsp.StatusCode != c.status {
+			t.Fatalf("%s:%s: status %d, want %d", c.username, c.password, rsp.StatusCode, c.status)
+		}
+		if c.status == http.StatusUnauthorized && len(rsp.Header.Get("WWW-Authenticate")) == 0 {
+			t.Fatal("WWW-Authenticate is not set")
+		}
+	}
+}